@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/api"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/sirupsen/logrus"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Serves the database read-only over HTTP (JSON), so other services do not need to open the SQLite file directly.
+// The routes are documented in the OpenAPI document, served at /openapi.json.
+// Can serve the ETL database while imports are running, or a snapshot. The database is opened read-only (it is never
+// migrated), so it must be at the current schema version.
+func main() {
+	addr := flag.String("addr", ":8080", "address to listen on")
+	databasePath := flag.String("database", database.DefaultRepositoryConfig().DatabaseLocation, "path to the ETL database (or a snapshot)")
+	flag.Parse()
+
+	config := database.DefaultRepositoryConfig()
+	config.DatabaseLocation = *databasePath
+	logger := logrus.New()
+	etlDatabase, err := database.NewReadOnlyRepository(config, logger)
+	if err != nil {
+		log.Fatalf("Unable to open/load database - %v", err)
+	}
+	defer etlDatabase.Close()
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           api.NewServer(etlDatabase, logger),
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      60 * time.Second,
+	}
+	logger.Infof("Serving %s on %s", *databasePath, *addr)
+	log.Fatal(server.ListenAndServe())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/overrides"
+	"github.com/sirupsen/logrus"
+	"log"
+)
+
+// Applies the curation overrides file (see the overrides package) to the database. Overrides are also applied at the
+// end of every import, this is only needed after editing the overrides file.
+// With -validate-only, the file is checked against the database (every targeted organization & endpoint must exist),
+// and nothing is written, eg. before committing a change to the overrides file.
+func main() {
+	filePath := flag.String("file", overrides.DefaultPath, "curation overrides file (YAML or JSON)")
+	validateOnly := flag.Bool("validate-only", false, "validate the overrides, without writing to the database")
+	flag.Parse()
+
+	curatedOverrides, err := overrides.Load(*filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	if *validateOnly {
+		errs := curatedOverrides.Validate(etlDatabase)
+		for _, err := range errs {
+			log.Printf("invalid override: %v", err)
+		}
+		if len(errs) > 0 {
+			log.Fatalf("%d invalid overrides in %s", len(errs), *filePath)
+		}
+		log.Printf("%d organization & %d endpoint overrides are valid", len(curatedOverrides.Organizations), len(curatedOverrides.Endpoints))
+		return
+	}
+
+	summary, err := curatedOverrides.Apply(etlDatabase)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Applied overrides to %d organizations & %d endpoints", summary.Organizations, summary.Endpoints)
+}
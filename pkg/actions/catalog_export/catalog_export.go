@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/export"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+	"log"
+)
+
+// Exports organizations with endpoints in the fasten-sources catalog format (catalog_brands.json, catalog_portals.json
+// & catalog_endpoints.json), consumed by the Fasten app. The output is sorted & contains no export timestamps, so
+// releases can be diffed.
+func main() {
+	outputDir := flag.String("output", "data/catalog", "directory to write the catalog files")
+	batchSize := flag.Int("batch-size", 1000, "number of organizations to load from the database at a time")
+	flag.Parse()
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	exporter, err := export.NewCatalogExporter(*outputDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = etlDatabase.FindOrganizationsWithEndpointsInBatches(*batchSize, func(orgs []models.Organization) error {
+		for ndx := range orgs {
+			exporter.ExportOrganization(&orgs[ndx])
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	summary, err := exporter.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Exported %d brands, %d portals & %d endpoints to %s", summary.Brands, summary.Portals, summary.Endpoints, *outputDir)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/importers/cms"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/overrides"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/validation"
+	progressbar "github.com/schollz/progressbar/v3"
+	"github.com/sirupsen/logrus"
+	"log"
+	"strings"
+	"time"
+)
+
+// Enriches organizations with the facility type, ownership, bed count, emergency services & CCN from a CMS facility
+// dataset (Provider of Services file or Hospital General Information), downloaded as a CSV file.
+// Facilities are matched to existing organizations by CCN, name & address (see cms.MatchFacility), unmatched
+// facilities are skipped. Should be run after the NPPES extract.
+// The release date of the dataset is recorded as provenance, and decides which dataset's facility fields are kept (see
+// models.MergeStrategyPreferNewest).
+// With -dry-run, the changes that would be made to matched organizations are printed, and nothing is written.
+func main() {
+	dataset := flag.String("dataset", "", fmt.Sprintf("facility importer to use (%s)", strings.Join(cms.ImporterNames(), ", ")))
+	filePath := flag.String("file", "", "path to the downloaded dataset (CSV)")
+	releaseDateFlag := flag.String("release-date", "", "the date the dataset was released by CMS (YYYY-MM-DD)")
+	dryRun := flag.Bool("dry-run", false, "print the merge plan for each matched organization, without writing to the database")
+	overridesPath := flag.String("overrides", overrides.DefaultPath, "curation overrides file (YAML or JSON), applied after the import")
+	validationPolicy := flag.String("validation-policy", "", "comma separated overrides of the default validation policy, eg. error=reject,invalid_state=keep")
+	mergePoliciesPath := flag.String("merge-policies", "", "merge policy file (YAML or JSON), the default merge policies are used if empty")
+	flag.Parse()
+
+	policy, err := validation.ParsePolicy(*validationPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	importer, err := cms.GetImporter(*dataset)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *filePath == "" {
+		log.Fatal("-file is required")
+	}
+	releaseDate, err := time.Parse("2006-01-02", *releaseDateFlag)
+	if err != nil {
+		log.Fatalf("-release-date is required (YYYY-MM-DD) - %v", err)
+	}
+
+	facilities, err := importer.Import(*filePath, releaseDate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("found %d %s facilities", len(facilities), importer.Name())
+
+	repositoryConfig := database.DefaultRepositoryConfig()
+	repositoryConfig.MergePoliciesPath = *mergePoliciesPath
+	openRepository := database.NewRepository
+	if *dryRun {
+		//dry runs never write to the database, not even migrations
+		openRepository = database.NewReadOnlyRepository
+	}
+	etlDatabase, err := openRepository(repositoryConfig, logrus.New())
+	if err != nil {
+		log.Fatalf("Unable to open/load database - %v", err)
+	}
+	defer etlDatabase.Close()
+
+	validator := validation.NewValidator(etlDatabase, policy)
+	matched := map[cms.MatchMethod]int{}
+	unmatched := 0
+	progress := progressbar.Default(int64(len(facilities)))
+	for ndx := range facilities {
+		facility := &facilities[ndx]
+		progress.Add(1)
+		progress.Describe(fmt.Sprintf("Processing %s", facility.Name))
+
+		foundOrg, method, err := cms.MatchFacility(etlDatabase, facility)
+		if err != nil {
+			log.Fatal(err)
+		} else if foundOrg == nil {
+			unmatched++
+			continue
+		}
+		matched[method]++
+
+		org, err := facility.Organization(foundOrg.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *dryRun {
+			_, result, err := etlDatabase.PlanMergeOrganization(org, importer.Name())
+			if err != nil {
+				log.Fatal(err)
+			}
+			if plan := result.Plan(); len(plan) > 0 {
+				fmt.Printf("\nmerge %s (CCN %s, by %s) into %s (%s)\n", facility.Name, facility.CCN, method, foundOrg.ID, foundOrg.Name)
+				for _, line := range plan {
+					fmt.Printf("    %s\n", line)
+				}
+			}
+			continue
+		}
+
+		admitted, err := validator.Admit(org, importer.Name())
+		if err != nil {
+			log.Fatal(err)
+		} else if !admitted {
+			continue
+		}
+		_, _, err = etlDatabase.MergeOrganization(org, importer.Name())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Matched %d facilities (%d by CCN, %d by name & address, %d by name & ZIP code), %d unmatched",
+		len(facilities)-unmatched, matched[cms.MatchMethodCCN], matched[cms.MatchMethodNameAddress], matched[cms.MatchMethodNameZip], unmatched)
+	if !*dryRun {
+		overridesSummary, err := overrides.ApplyFile(etlDatabase, *overridesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Applied overrides to %d organizations & %d endpoints", overridesSummary.Organizations, overridesSummary.Endpoints)
+	}
+	log.Printf("FINISHED IMPORTING %s FACILITIES", strings.ToUpper(importer.Name()))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/importers/endpoints"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/overrides"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/validation"
+	progressbar "github.com/schollz/progressbar/v3"
+	"github.com/sirupsen/logrus"
+	"log"
+	"strings"
+)
+
+// Imports a vendor-published FHIR endpoint directory (eg. Epic, Cerner) from a local file.
+// Organizations are merged into the database using the same path as the NPPES extract.
+// With -dry-run, the changes that would be made to existing organizations are printed, and nothing is written.
+// Records with validation findings are kept, flagged, quarantined or rejected according to -validation-policy.
+func main() {
+	vendor := flag.String("vendor", "", fmt.Sprintf("endpoint importer to use (%s)", strings.Join(endpoints.ImporterNames(), ", ")))
+	filePath := flag.String("file", "", "path to the downloaded endpoint directory (FHIR Bundle)")
+	dryRun := flag.Bool("dry-run", false, "print the merge plan for each organization, without writing to the database")
+	overridesPath := flag.String("overrides", overrides.DefaultPath, "curation overrides file (YAML or JSON), applied after the import")
+	validationPolicy := flag.String("validation-policy", "", "comma separated overrides of the default validation policy, eg. error=reject,invalid_state=keep")
+	mergePoliciesPath := flag.String("merge-policies", "", "merge policy file (YAML or JSON), the default merge policies are used if empty")
+	flag.Parse()
+
+	policy, err := validation.ParsePolicy(*validationPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	importer, err := endpoints.GetImporter(*vendor)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *filePath == "" {
+		log.Fatal("-file is required")
+	}
+
+	orgs, err := importer.Import(*filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("found %d %s organizations with endpoints", len(orgs), importer.Name())
+
+	repositoryConfig := database.DefaultRepositoryConfig()
+	repositoryConfig.MergePoliciesPath = *mergePoliciesPath
+	openRepository := database.NewRepository
+	if *dryRun {
+		//dry runs never write to the database, not even migrations
+		openRepository = database.NewReadOnlyRepository
+	}
+	etlDatabase, err := openRepository(repositoryConfig, logrus.New())
+	if err != nil {
+		log.Fatalf("Unable to open/load database - %v", err)
+	}
+	defer etlDatabase.Close()
+
+	if *dryRun {
+		printMergePlan(etlDatabase, orgs, importer.Name(), policy)
+		return
+	}
+
+	validator := validation.NewValidator(etlDatabase, policy)
+	progress := progressbar.Default(int64(len(orgs)))
+	for _, org := range orgs {
+		progress.Add(1)
+		progress.Describe(fmt.Sprintf("Processing %s", org.Name))
+
+		admitted, err := validator.Admit(org, importer.Name())
+		if err != nil {
+			log.Fatal(err)
+		} else if !admitted {
+			continue
+		}
+
+		_, _, err = etlDatabase.MergeOrganization(org, importer.Name())
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = etlDatabase.ValidateLocations()
+	if err != nil {
+		log.Fatal(err)
+	}
+	overridesSummary, err := overrides.ApplyFile(etlDatabase, *overridesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Applied overrides to %d organizations & %d endpoints", overridesSummary.Organizations, overridesSummary.Endpoints)
+	log.Printf("Validation (%s): %d kept, %d flagged, %d quarantined, %d rejected", policy,
+		validator.Summary.Kept, validator.Summary.Flagged, validator.Summary.Quarantined, validator.Summary.Rejected)
+	log.Printf("FINISHED IMPORTING %s ENDPOINTS", strings.ToUpper(importer.Name()))
+}
+
+func printMergePlan(etlDatabase *database.SqliteRepository, orgs []*models.Organization, source string, policy validation.Policy) {
+	created, updated, unchanged, skipped := 0, 0, 0, 0
+	for _, org := range orgs {
+		if action := policy.Decide(org.ValidationFindings); action == validation.ActionQuarantine || action == validation.ActionReject {
+			skipped++
+			fmt.Printf("%s %s (%s)\n", action, org.Name, org.ID)
+			for _, finding := range org.ValidationFindings {
+				fmt.Printf("    ! %s\n", finding)
+			}
+			continue
+		}
+
+		existingOrg, result, err := etlDatabase.PlanMergeOrganization(org, source)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if existingOrg == nil {
+			created++
+			fmt.Printf("create %s (%d endpoints)\n", org.Name, len(org.Endpoints))
+			continue
+		}
+		plan := result.Plan()
+		if len(plan) == 0 {
+			unchanged++
+			continue
+		}
+		if result.HasChanges() {
+			updated++
+		} else {
+			unchanged++
+		}
+		fmt.Printf("merge %s into %s (%s)\n", org.Name, existingOrg.ID, existingOrg.Name)
+		for _, line := range plan {
+			fmt.Printf("    %s\n", line)
+		}
+	}
+	fmt.Printf("%d created, %d updated, %d unchanged, %d quarantined or rejected\n", created, updated, unchanged, skipped)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/prober"
+	"github.com/sirupsen/logrus"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Probes every endpoint in the database, and records the result in the endpoint's status history
+func main() {
+	workers := flag.Int("workers", 10, "number of endpoints to probe concurrently")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout for each request")
+	flag.Parse()
+
+	logger := logrus.New()
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logger)
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	endpointProber := prober.NewProber(&http.Client{Timeout: *timeout}, logger)
+
+	endpointQueue := make(chan models.Endpoint)
+	probeResults := make(chan *models.EndpointProbe)
+
+	var probeWaitGroup sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		probeWaitGroup.Add(1)
+		go func() {
+			defer probeWaitGroup.Done()
+			for endpoint := range endpointQueue {
+				probeResults <- endpointProber.Probe(context.Background(), &endpoint)
+			}
+		}()
+	}
+
+	//all writes happen on this goroutine, the database only supports a single writer
+	var writerWaitGroup sync.WaitGroup
+	writerWaitGroup.Add(1)
+	go func() {
+		defer writerWaitGroup.Done()
+		count := 0
+		failures := 0
+		for probe := range probeResults {
+			count += 1
+			if probe.Status != models.EndpointProbeStatusOk {
+				failures += 1
+			}
+			err := etlDatabase.CreateEndpointProbe(probe)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		log.Printf("FINISHED PROBING %d ENDPOINTS (%d failed)", count, failures)
+	}()
+
+	err = etlDatabase.FindEndpointsInBatches(100, func(endpoints []models.Endpoint) error {
+		for _, endpoint := range endpoints {
+			endpointQueue <- endpoint
+		}
+		return nil
+	})
+	close(endpointQueue)
+	probeWaitGroup.Wait()
+	close(probeResults)
+	writerWaitGroup.Wait()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
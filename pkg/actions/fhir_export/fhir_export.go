@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/export"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+	"log"
+)
+
+// Exports all organizations, locations and endpoints as FHIR R4 resources (Bulk Data style NDJSON files)
+func main() {
+	outputDir := flag.String("output", "data/fhir_export", "directory to write the NDJSON files & manifest")
+	batchSize := flag.Int("batch-size", 1000, "number of organizations to load from the database at a time")
+	flag.Parse()
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	exporter, err := export.NewFhirExporter(*outputDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = etlDatabase.FindOrganizationsInBatches(*batchSize, func(orgs []models.Organization) error {
+		for ndx := range orgs {
+			err := exporter.ExportOrganization(&orgs[ndx])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifest, err := exporter.Close("fasten-sources-etl fhir_export")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, output := range manifest.Output {
+		log.Printf("Exported %d %s resources", output.Count, output.Type)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/clustering"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Groups organizations (NPIs) into health systems by the EINs, parent organization fields & practice locations they
+// share. Should be run after every NPPES extract & endpoint import.
+//
+//	health_system_cluster                        rebuilds every health system
+//	health_system_cluster -top 20                lists the largest health systems
+//	health_system_cluster -system hs-1234567890  lists the members of a health system
+//	health_system_cluster -org 1234567890        lists the members of the organization's health system
+func main() {
+	config := clustering.DefaultClustererConfig()
+	tinWeight := flag.Float64("tin-weight", config.Weights[clustering.SignalTIN], "score contributed by a shared EIN/parent TIN")
+	parentLbnWeight := flag.Float64("parent-lbn-weight", config.Weights[clustering.SignalParentLBN], "score contributed by a shared parent organization name")
+	addressWeight := flag.Float64("address-weight", config.Weights[clustering.SignalAddress], "score contributed by a shared practice location")
+	flag.Float64Var(&config.Threshold, "threshold", config.Threshold, "minimum score to cluster two organizations together")
+	flag.IntVar(&config.MaxPairwiseMembers, "max-pairwise-members", config.MaxPairwiseMembers, "signals shared by more organizations than this are only used if their weight reaches the threshold")
+	flag.IntVar(&config.MinMembers, "min-members", config.MinMembers, "minimum number of members in a health system")
+	top := flag.Int("top", 0, "list the largest health systems, instead of clustering")
+	systemId := flag.String("system", "", "list the members of the health system, instead of clustering")
+	orgId := flag.String("org", "", "list the members of the organization's health system, instead of clustering")
+	flag.Parse()
+	config.Weights[clustering.SignalTIN] = *tinWeight
+	config.Weights[clustering.SignalParentLBN] = *parentLbnWeight
+	config.Weights[clustering.SignalAddress] = *addressWeight
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	if *top > 0 {
+		printHealthSystems(etlDatabase, *top)
+		return
+	} else if *systemId != "" || *orgId != "" {
+		var system *models.HealthSystem
+		if *systemId != "" {
+			system, err = etlDatabase.FindHealthSystemById(*systemId)
+		} else {
+			system, err = etlDatabase.FindHealthSystemByOrganizationId(*orgId)
+		}
+		if err != nil {
+			log.Fatalf("Unable to find health system - %v", err)
+		}
+		printHealthSystemMembers(etlDatabase, system)
+		return
+	}
+
+	summary, err := clustering.NewClusterer(etlDatabase, config, logrus.New()).Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Clustered %d organizations into %d health systems: %d members, largest system has %d members",
+		summary.Organizations, summary.Systems, summary.Members, summary.LargestSystem)
+}
+
+func printHealthSystems(etlDatabase *database.SqliteRepository, limit int) {
+	systems, err := etlDatabase.ListHealthSystems(0, limit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "SYSTEM\tMEMBERS\tNAME")
+	for _, system := range systems {
+		fmt.Fprintf(writer, "%s\t%d\t%s\n", system.ID, system.MemberCount, system.Name)
+	}
+	writer.Flush()
+}
+
+func printHealthSystemMembers(etlDatabase *database.SqliteRepository, system *models.HealthSystem) {
+	var orgIds []string
+	for _, member := range system.Members {
+		orgIds = append(orgIds, member.OrganizationID)
+	}
+	orgs, err := etlDatabase.FindOrganizationsByIds(orgIds)
+	if err != nil {
+		log.Fatal(err)
+	}
+	orgNames := map[string]string{}
+	for _, org := range orgs {
+		orgNames[org.ID] = org.Name
+	}
+
+	fmt.Printf("%s: %s (%d members)\n", system.ID, system.Name, system.MemberCount)
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ORGANIZATION\tNAME\tSIGNALS")
+	for _, member := range system.Members {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", member.OrganizationID, orgNames[member.OrganizationID], strings.Join(member.Signals, ", "))
+	}
+	writer.Flush()
+}
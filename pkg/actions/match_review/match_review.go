@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Reviews the organization matches queued by organization_match.
+//
+//	match_review                  lists pending matches
+//	match_review -accept 12       links the organizations, and rejects the other candidates
+//	match_review -reject 13       the candidate will not be proposed again
+func main() {
+	status := flag.String("status", string(models.OrganizationMatchStatusPending), "list matches with this status (pending, accepted, rejected, auto_linked)")
+	acceptId := flag.Uint("accept", 0, "accept the match with this id")
+	rejectId := flag.Uint("reject", 0, "reject the match with this id")
+	flag.Parse()
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	if *acceptId != 0 || *rejectId != 0 {
+		matchId, reviewStatus := *acceptId, models.OrganizationMatchStatusAccepted
+		if *rejectId != 0 {
+			matchId, reviewStatus = *rejectId, models.OrganizationMatchStatusRejected
+		}
+		match, err := etlDatabase.ReviewOrganizationMatch(matchId, reviewStatus)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Match %d (%s -> %s) %s", match.ID, match.SourceOrganizationID, match.CandidateOrganizationID, match.Status)
+		return
+	}
+
+	matches, err := etlDatabase.ListOrganizationMatches("", models.OrganizationMatchStatus(*status))
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "ID\tSCORE\tSOURCE\tCANDIDATE\tCANDIDATE NAME\tREASONS")
+	for _, match := range matches {
+		candidateName := ""
+		if candidateOrg, err := etlDatabase.FindOrganizationById(match.CandidateOrganizationID); err == nil {
+			candidateName = candidateOrg.Name
+		}
+		fmt.Fprintf(writer, "%d\t%.2f\t%s (%s)\t%s\t%s\t%s\n",
+			match.ID, match.Score, match.SourceOrganizationName, match.SourceOrganizationID, match.CandidateOrganizationID, candidateName, strings.Join(match.Reasons, "; "))
+	}
+	writer.Flush()
+	log.Printf("%d %s matches", len(matches), *status)
+}
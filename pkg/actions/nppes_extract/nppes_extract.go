@@ -2,16 +2,21 @@ package main
 
 import (
 	"encoding/csv"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
 	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/overrides"
 	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/validation"
 	progressbar "github.com/schollz/progressbar/v3"
 	"github.com/sirupsen/logrus"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -63,6 +68,16 @@ const (
 	NPPESColumTypeHealthcareProviderTaxonomyCode_14 NPPESColumnType = 99  //"Healthcare Provider Taxonomy Code_14"
 	NPPESColumTypeHealthcareProviderTaxonomyCode_15 NPPESColumnType = 103 //"Healthcare Provider Taxonomy Code_15"
 
+	// the license columns repeat (every 4 columns) for each of the 15 taxonomy codes
+	NPPESColumTypeProviderLicenseNumber_1          NPPESColumnType = 48 //"Provider License Number_1"
+	NPPESColumTypeProviderLicenseNumberStateCode_1 NPPESColumnType = 49 //"Provider License Number State Code_1"
+
+	// the other provider identifier columns repeat (every 4 columns) 50 times, up to "Other Provider Identifier Issuer_50" (306)
+	NPPESColumTypeOtherProviderIdentifier_1         NPPESColumnType = 107 //"Other Provider Identifier_1"
+	NPPESColumTypeOtherProviderIdentifierTypeCode_1 NPPESColumnType = 108 //"Other Provider Identifier Type Code_1"
+	NPPESColumTypeOtherProviderIdentifierState_1    NPPESColumnType = 109 //"Other Provider Identifier State_1"
+	NPPESColumTypeOtherProviderIdentifierIssuer_1   NPPESColumnType = 110 //"Other Provider Identifier Issuer_1"
+
 	NPPESColumTypeIsSoleProprietor      NPPESColumnType = 307 //"Is Sole Proprietor"
 	NPPESColumTypeIsOrganizationSubpart NPPESColumnType = 308 //"Is Organization Subpart"
 	NPPESColumTypeParentOrganizationLBN NPPESColumnType = 309 //"Parent Organization LBN"
@@ -87,12 +102,23 @@ const (
 )
 
 func main() {
+	mergePoliciesPath := flag.String("merge-policies", "", "merge policy file (YAML or JSON), the default merge policies are used if empty")
+	flag.Parse()
+
 	filePath := "/Users/jason/Downloads/NPPES_Data_Dissemination_September_2022/npidata_pfile_20050523-20220911	.csv"
+	releaseDate, err := nppesReleaseDate(filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	//every pass opens its own repository, but all revisions are recorded under the same run id
+	repositoryConfig := database.BulkLoadRepositoryConfig()
+	repositoryConfig.RunID = database.GenerateRunId()
+	repositoryConfig.MergePoliciesPath = *mergePoliciesPath
 
 	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 	// First pass, add all Primary Organizations and Individual Providers to database
 	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-	err := nppesProcessor(filePath, func(progress *progressbar.ProgressBar, nppesDatabase *database.SqliteRepository, csvReader *csv.Reader) error {
+	err = nppesProcessor(filePath, repositoryConfig, func(progress *progressbar.ProgressBar, nppesDatabase *database.SqliteRepository, csvReader *csv.Reader) error {
 		orgSubpartsPath := "data/org_subparts.csv"
 		orgSubpartsFile, err := os.OpenFile(orgSubpartsPath, os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
@@ -100,6 +126,7 @@ func main() {
 		}
 		defer orgSubpartsFile.Close()
 		csvSubpartsWriter := csv.NewWriter(orgSubpartsFile)
+		validator := validation.NewValidator(nppesDatabase, validation.DefaultPolicy())
 
 		count := 0
 		for {
@@ -133,46 +160,41 @@ func main() {
 			}
 
 			//5. first pass, skip if Organization Subpart (index 308, "Is Organization Subpart")
+			//the original line number is appended as an additional (last) column, so provenance can reference the NPPES file
+			sourceRow, _ := csvReader.FieldPos(0)
+
 			if rec[NPPESColumTypeIsOrganizationSubpart] == "Y" {
-				csvSubpartsWriter.Write(rec)
+				csvSubpartsWriter.Write(append(rec, strconv.Itoa(sourceRow)))
 				csvSubpartsWriter.Flush()
 				continue
 			}
 
-			org, err := nppesRowToOrganization(rec)
+			org, err := nppesRowToOrganization(rec, models.Provenance{
+				SourceDataset: models.SourceNPPES,
+				SourceFile:    filepath.Base(filePath),
+				SourceRow:     sourceRow,
+				ReleaseDate:   releaseDate,
+			})
 			if err != nil {
 				log.Fatal(err)
 			}
 
 			progress.Describe(fmt.Sprintf("Processing %s", org.Name))
 
-			//Optomistic Insert.
-			//Attempt to creat the organization, if it fails, then we need to update it.
-			err = nppesDatabase.CreateOrganization(org)
+			admitted, err := validator.Admit(org, models.SourceNPPES)
 			if err != nil {
-				//organization may already exist
-				foundOrg, err := nppesDatabase.FindOrganizationByIdentifiers(org.OrganizationIdentifiers)
-
-				//only organizations can have multiple identifiers, so if we find an individual or sole practitioner, we should skip (we cant process this)
-				if foundOrg.OrganizationType == models.OrganizationTypeTypeIndividual {
-					continue
-				}
+				log.Fatal(err)
+			} else if !admitted {
+				continue
+			}
 
-				foundOrgJson, _ := json.Marshal(foundOrg)
-				log.Printf("Found Existing Organization: %v", string(foundOrgJson))
-
-				//check if they are exact matches.
-				if foundOrg.MergeHasChanges(org) {
-					updatedOrgJson, _ := json.Marshal(foundOrg)
-					log.Fatalf("Updating Organization %v", string(updatedOrgJson))
-					err = nppesDatabase.UpdateOrganization(org)
-					if err != nil {
-						log.Fatal(err)
-					}
-				}
+			_, _, err = nppesDatabase.MergeOrganization(org, models.SourceNPPES)
+			if err != nil {
+				log.Fatal(err)
 			}
 		}
 		log.Printf("FINISHED PROCESSING RECORDs %d", count)
+		logValidationSummary(validator)
 		return nil
 	})
 	if err != nil {
@@ -182,7 +204,8 @@ func main() {
 	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 	// Second pass, add all Organization Subparts to database
 	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-	err = nppesProcessor("data/org_subparts.csv", func(progress *progressbar.ProgressBar, nppesDatabase *database.SqliteRepository, csvReader *csv.Reader) error {
+	err = nppesProcessor("data/org_subparts.csv", repositoryConfig, func(progress *progressbar.ProgressBar, nppesDatabase *database.SqliteRepository, csvReader *csv.Reader) error {
+		validator := validation.NewValidator(nppesDatabase, validation.DefaultPolicy())
 		count := 0
 		for {
 			count += 1
@@ -203,49 +226,71 @@ func main() {
 			//5. all entries are Organization Subpart (index 308, "Is Organization Subpart")
 
 			//start processing entry
-			org, err := nppesRowToOrganization(rec)
+			sourceRow, err := strconv.Atoi(rec[len(rec)-1])
+			if err != nil {
+				log.Fatal(err)
+			}
+			org, err := nppesRowToOrganization(rec, models.Provenance{
+				SourceDataset: models.SourceNPPES,
+				SourceFile:    filepath.Base(filePath),
+				SourceRow:     sourceRow,
+				ReleaseDate:   releaseDate,
+			})
 			if err != nil {
 				log.Fatal(err)
 			}
 
 			progress.Describe(fmt.Sprintf("Processing %s", org.Name))
 
-			//Find organization By NPI
-			foundOrg, err := nppesDatabase.FindOrganizationByIdentifiers(org.OrganizationIdentifiers)
+			admitted, err := validator.Admit(org, models.SourceNPPES)
 			if err != nil {
-
-				//only organizations can have multiple identifiers, so if we find an individual or sole practitioner, we should skip (we cant process this)
-				if foundOrg.OrganizationType == models.OrganizationTypeTypeIndividual {
-					continue
-				}
-
-				//foundOrgJson, _ := json.Marshal(foundOrg)
-				//log.Printf("Found Existing Organization: %v", string(foundOrgJson))
-
-				//check if they are exact matches.
-				if foundOrg.MergeHasChanges(org) {
-					updatedOrgJson, _ := json.Marshal(foundOrg)
-					log.Fatalf("Updating Organization %v", string(updatedOrgJson))
-					err = nppesDatabase.UpdateOrganization(org)
-					if err != nil {
-						log.Fatal(err)
-					}
-				}
-			} else {
-				//we could not find the organization (something is wrong)
-				log.Fatalf("Could not find organization %v", org)
+				log.Fatal(err)
+			} else if !admitted {
+				continue
 			}
 
+			//subparts are merged into the organization that shares one of their merge keys (usually the parent, by name), or created
+			_, _, err = nppesDatabase.MergeOrganization(org, models.SourceNPPES)
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 		log.Printf("FINISHED PROCESSING RECORDs %d", count)
+		logValidationSummary(validator)
 		return nil
 	})
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	// Post-load, validate locations, apply curation overrides, update query planner statistics & compact the database
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	nppesDatabase, err := database.NewRepository(repositoryConfig, logrus.New())
+	if err != nil {
+		log.Fatalf("Unable to open/load database - %v", err)
+	}
+	defer nppesDatabase.Close()
+	err = nppesDatabase.SetMetadata(models.DatabaseMetadataKeyNPPESReleaseDate, releaseDate.Format("2006-01-02"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = nppesDatabase.ValidateLocations()
+	if err != nil {
+		log.Fatal(err)
+	}
+	overridesSummary, err := overrides.ApplyFile(nppesDatabase, overrides.DefaultPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Applied overrides to %d organizations & %d endpoints", overridesSummary.Organizations, overridesSummary.Endpoints)
+	err = nppesDatabase.Optimize(true)
+	if err != nil {
+		log.Fatal(err)
+	}
 }
 
-func nppesProcessor(csvPath string, processorBlock func(progress *progressbar.ProgressBar, nppesDatabase *database.SqliteRepository, csvReader *csv.Reader) error) error {
+func nppesProcessor(csvPath string, repositoryConfig database.RepositoryConfig, processorBlock func(progress *progressbar.ProgressBar, nppesDatabase *database.SqliteRepository, csvReader *csv.Reader) error) error {
 
 	// setup reader
 	lines, err := utils.FileLineCount(csvPath)
@@ -264,15 +309,40 @@ func nppesProcessor(csvPath string, processorBlock func(progress *progressbar.Pr
 	r := csv.NewReader(csvIn)
 
 	// setup database
-	nppesDatabase, err := database.NewRepository(logrus.New())
+	nppesDatabase, err := database.NewRepository(repositoryConfig, logrus.New())
 	if err != nil {
-		log.Fatal("Unable to open/load database")
+		log.Fatalf("Unable to open/load database - %v", err)
 	}
+	defer nppesDatabase.Close()
 
 	return processorBlock(bar, nppesDatabase, r)
 }
 
-func nppesRowToOrganization(rec []string) (*models.Organization, error) {
+func logValidationSummary(validator *validation.Validator) {
+	log.Printf("Validation (%s): %d kept, %d flagged, %d quarantined, %d rejected", validator.Policy,
+		validator.Summary.Kept, validator.Summary.Flagged, validator.Summary.Quarantined, validator.Summary.Rejected)
+}
+
+// nppesReleaseDate parses the release date from the NPPES data dissemination filename,
+// eg. npidata_pfile_20050523-20220911.csv was released on 2022-09-11
+func nppesReleaseDate(filePath string) (time.Time, error) {
+	matches := regexp.MustCompile(`(\d{8})-(\d{8})`).FindStringSubmatch(filepath.Base(filePath))
+	if len(matches) != 3 {
+		return time.Time{}, fmt.Errorf("could not determine NPPES release date from filename: %s", filePath)
+	}
+	return time.Parse("20060102", matches[2])
+}
+
+// nppesLastUpdateDate returns the "Last Update Date" of the NPPES record (MM/DD/YYYY), or the release date if it is missing
+func nppesLastUpdateDate(rec []string, releaseDate time.Time) time.Time {
+	lastUpdateDate, err := time.Parse("01/02/2006", rec[NPPESColumTypeLastUpdateDate])
+	if err != nil {
+		return releaseDate
+	}
+	return lastUpdateDate
+}
+
+func nppesRowToOrganization(rec []string, provenance models.Provenance) (*models.Organization, error) {
 	var name string
 	var alias string
 	if rec[NPPESColumnTypeEntityTypeCode] == string(models.OrganizationTypeTypeOrganization) { //organization
@@ -303,8 +373,6 @@ func nppesRowToOrganization(rec []string) (*models.Organization, error) {
 	}
 
 	//log.Printf("Is Organization Subpart: %s", rec[NPPESColumTypeIsOrganizationSubpart])
-	//log.Printf("Parent Organization LBN: %s", rec[NPPESColumTypeParentOrganizationLBN])
-	//log.Printf("Parent Organization TIN: %s", rec[NPPESColumTypeParentOrganizationTIN])
 
 	orgName, err := utils.NormalizeOrganizationName(name)
 	if err != nil {
@@ -338,13 +406,17 @@ func nppesRowToOrganization(rec []string) (*models.Organization, error) {
 		}
 	}
 
-	if len(rec[NPPESColumnTypeEIN]) > 0 {
+	//NPPES no longer publishes EINs, most records have the <UNAVAIL> placeholder
+	if len(rec[NPPESColumnTypeEIN]) > 0 && rec[NPPESColumnTypeEIN] != "<UNAVAIL>" {
 		identifiers = append(identifiers, models.OrganizationIdentifier{
 			IdentifierValue: rec[NPPESColumnTypeEIN],
 			IdentifierType:  models.OrganizationIdentifierTypeEIN,
 		})
 	}
 
+	identifiers = append(identifiers, licenseIdentifiers(rec)...)
+	identifiers = append(identifiers, otherProviderIdentifiers(rec)...)
+
 	address := models.Location{
 		Line: deleteEmpty([]string{
 			rec[NPPESColumnTypeProviderFirstLineBusinessPracticeLocationAddress],
@@ -356,6 +428,24 @@ func nppesRowToOrganization(rec []string) (*models.Organization, error) {
 		Country:    rec[NPPESColumnTypeProviderBusinessPracticeLocationAddressCountryCode],
 	}
 
+	//add name identifiers
+	if len(alias) > 0 {
+		aliasId, err := utils.NormalizeOrganizationName(alias)
+		if err != nil {
+			return nil, err
+		}
+		if aliasId != orgName {
+			identifiers = append(identifiers, models.OrganizationIdentifier{
+				IdentifierValue:   aliasId,
+				IdentifierType:    models.OrganizationIdentifierTypeName,
+				IdentifierDisplay: alias,
+			})
+		}
+	}
+
+	//EINs, state licenses & other provider identifiers are not merge keys, they are stored as attributes
+	keyIdentifiers, attributeIdentifiers := models.SplitAttributeIdentifiers(identifiers)
+
 	org := models.Organization{
 		ID:               rec[NPPESColumnTypeNPI],
 		OrganizationType: models.OrganizationTypeType(rec[1]),
@@ -364,23 +454,23 @@ func nppesRowToOrganization(rec []string) (*models.Organization, error) {
 		CreatedAt:        time.Now(),
 		Taxonomy:         taxonomyCodes(rec),
 		IsSoleProprietor: rec[NPPESColumTypeIsSoleProprietor] == "Y",
+		Source:           provenance.SourceDataset,
+		SourceUpdatedAt:  nppesLastUpdateDate(rec, provenance.ReleaseDate),
+
+		// only populated for organization subparts
+		ParentOrganizationLBN: strings.TrimSpace(rec[NPPESColumTypeParentOrganizationLBN]),
+		ParentOrganizationTIN: strings.TrimSpace(rec[NPPESColumTypeParentOrganizationTIN]),
 
 		//Links
-		OrganizationIdentifiers: identifiers,
+		OrganizationIdentifiers: keyIdentifiers,
+		AttributeIdentifiers:    attributeIdentifiers,
 		Locations:               []models.Location{address},
 	}
+	org.ValidationFindings = validation.ValidateOrganization(&org)
 
-	//add name identifiers
-	if len(alias) > 0 {
-		aliasId, err := utils.NormalizeOrganizationName(alias)
-		if err != nil {
-			return nil, err
-		}
-		identifiers = append(identifiers, models.OrganizationIdentifier{
-			IdentifierValue:   aliasId,
-			IdentifierType:    models.OrganizationIdentifierTypeName,
-			IdentifierDisplay: alias,
-		})
+	err = org.AddProvenance(provenance)
+	if err != nil {
+		return nil, err
 	}
 	return &org, nil
 }
@@ -430,6 +520,102 @@ func taxonomyCodes(record []string) []string {
 	return codes
 }
 
+// licenseIdentifiers returns the state licenses listed alongside the taxonomy codes
+func licenseIdentifiers(record []string) []models.OrganizationIdentifier {
+	var identifiers []models.OrganizationIdentifier
+	for ndx := 0; ndx < 15; ndx++ {
+		license := strings.TrimSpace(record[int(NPPESColumTypeProviderLicenseNumber_1)+ndx*4])
+		state := strings.TrimSpace(record[int(NPPESColumTypeProviderLicenseNumberStateCode_1)+ndx*4])
+		if license == "" {
+			continue
+		}
+		identifiers = appendIdentifier(identifiers, models.OrganizationIdentifier{
+			IdentifierType:    models.OrganizationIdentifierTypeStateLicense,
+			IdentifierValue:   models.ScopedIdentifierValue(models.OrganizationIdentifierTypeStateLicense, license, state, ""),
+			IdentifierDisplay: license,
+			IdentifierState:   state,
+		})
+	}
+	return identifiers
+}
+
+// otherProviderIdentifiers returns the "Other Provider Identifier" columns (Medicaid ids, Medicare ids, payer ids, etc)
+func otherProviderIdentifiers(record []string) []models.OrganizationIdentifier {
+	var identifiers []models.OrganizationIdentifier
+	for ndx := 0; ndx < 50; ndx++ {
+		value := strings.TrimSpace(record[int(NPPESColumTypeOtherProviderIdentifier_1)+ndx*4])
+		typeCode := strings.TrimSpace(record[int(NPPESColumTypeOtherProviderIdentifierTypeCode_1)+ndx*4])
+		state := strings.TrimSpace(record[int(NPPESColumTypeOtherProviderIdentifierState_1)+ndx*4])
+		issuer := strings.TrimSpace(record[int(NPPESColumTypeOtherProviderIdentifierIssuer_1)+ndx*4])
+		if value == "" {
+			continue
+		}
+		identifierType, defaultIssuer := otherProviderIdentifierType(typeCode, value, issuer)
+		if issuer == "" {
+			issuer = defaultIssuer
+		}
+		identifiers = appendIdentifier(identifiers, models.OrganizationIdentifier{
+			IdentifierType:    identifierType,
+			IdentifierValue:   models.ScopedIdentifierValue(identifierType, value, state, issuer),
+			IdentifierDisplay: value,
+			IdentifierIssuer:  issuer,
+			IdentifierState:   state,
+		})
+	}
+	return identifiers
+}
+
+var (
+	cliaRegex = regexp.MustCompile(`^\d{2}D\d{7}$`)
+	oidRegex  = regexp.MustCompile(`^[0-2](\.\d+)+$`)
+)
+
+// otherProviderIdentifierType maps the NPPES "Other Provider Identifier Type Code" to an identifier type (and the issuer,
+// for codes that imply one). "Other" (01) identifiers are classified by their issuer & format.
+func otherProviderIdentifierType(typeCode string, value string, issuer string) (models.OrganizationIdentifierType, string) {
+	switch typeCode {
+	case "02":
+		return models.OrganizationIdentifierTypeOther, "MEDICARE UPIN"
+	case "04":
+		return models.OrganizationIdentifierTypeOther, "MEDICARE"
+	case "05":
+		return models.OrganizationIdentifierTypeMedicaidStateID, "MEDICAID"
+	case "06":
+		return models.OrganizationIdentifierTypeCCN, "MEDICARE OSCAR/CERTIFICATION"
+	case "07":
+		return models.OrganizationIdentifierTypeOther, "MEDICARE NSC"
+	case "08":
+		return models.OrganizationIdentifierTypePTAN, "MEDICARE PIN"
+	}
+
+	upperIssuer := strings.ToUpper(issuer)
+	switch {
+	case strings.Contains(upperIssuer, "CLIA") || cliaRegex.MatchString(strings.ToUpper(value)):
+		return models.OrganizationIdentifierTypeCLIA, ""
+	case strings.Contains(upperIssuer, "OID") || oidRegex.MatchString(value):
+		return models.OrganizationIdentifierTypeOID, ""
+	case strings.Contains(upperIssuer, "CCN") || strings.Contains(upperIssuer, "OSCAR") || strings.Contains(upperIssuer, "CERTIFICATION NUMBER"):
+		return models.OrganizationIdentifierTypeCCN, ""
+	case strings.Contains(upperIssuer, "PTAN"):
+		return models.OrganizationIdentifierTypePTAN, ""
+	case strings.Contains(upperIssuer, "MEDICAID"):
+		return models.OrganizationIdentifierTypeMedicaidStateID, ""
+	case strings.Contains(upperIssuer, "LICENSE"):
+		return models.OrganizationIdentifierTypeStateLicense, ""
+	}
+	return models.OrganizationIdentifierTypeOther, ""
+}
+
+// appendIdentifier appends the identifier, unless an equal identifier is already present (NPPES records often repeat ids)
+func appendIdentifier(identifiers []models.OrganizationIdentifier, identifier models.OrganizationIdentifier) []models.OrganizationIdentifier {
+	for _, existing := range identifiers {
+		if existing.Equal(&identifier) {
+			return identifiers
+		}
+	}
+	return append(identifiers, identifier)
+}
+
 func deleteEmpty(s []string) []string {
 	var r []string
 	for _, str := range s {
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/matching"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/overrides"
+	"github.com/sirupsen/logrus"
+	"log"
+)
+
+// Matches organizations imported from vendor endpoint directories to NPPES organizations.
+// Should be run after every endpoint import. Ambiguous matches are queued for review (see match_review).
+func main() {
+	config := matching.DefaultMatcherConfig()
+	flag.Float64Var(&config.AutoLinkThreshold, "auto-link-threshold", config.AutoLinkThreshold, "minimum score (0-1) to link organizations without review")
+	flag.Float64Var(&config.AutoLinkMargin, "auto-link-margin", config.AutoLinkMargin, "minimum score difference between the best and next best candidate to link without review")
+	flag.Float64Var(&config.ReviewThreshold, "review-threshold", config.ReviewThreshold, "minimum score (0-1) to queue a candidate for review")
+	flag.IntVar(&config.MaxCandidates, "max-candidates", config.MaxCandidates, "maximum number of candidates scored per organization")
+	flag.IntVar(&config.MaxPostings, "max-postings", config.MaxPostings, "name words shared by more organizations than this are not used to find candidates")
+	overridesPath := flag.String("overrides", overrides.DefaultPath, "curation overrides file (YAML or JSON), applied after matching")
+	flag.Parse()
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	summary, err := matching.NewMatcher(etlDatabase, config, logrus.New()).Run()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Matched %d unlinked organizations: %d auto-linked, %d re-linked, %d queued for review, %d unmatched",
+		summary.Unlinked, summary.AutoLinked, summary.Relinked, summary.Review, summary.Unmatched)
+
+	overridesSummary, err := overrides.ApplyFile(etlDatabase, *overridesPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Applied overrides to %d organizations & %d endpoints", overridesSummary.Organizations, overridesSummary.Endpoints)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/sirupsen/logrus"
+	"log"
+)
+
+// Re-canonicalizes the stored organization names, after the name canonicalization rules change (see
+// database.RecomputeOrganizationNames). Nothing is modified if the names are already up to date, unless -force is set.
+// Names whose canonical value already belongs to another organization are not recomputed, they are listed for review.
+func main() {
+	force := flag.Bool("force", false, "recompute the names, even if the canonicalization rules have not changed")
+	flag.Parse()
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	collisions, err := etlDatabase.RecomputeOrganizationNames(*force)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, collision := range collisions {
+		log.Printf("name collision, not recomputed: %v", collision.Error())
+	}
+	log.Printf("%d organization name collisions", len(collisions))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/sirupsen/logrus"
+	"log"
+	"time"
+)
+
+// Creates a compacted, read-only copy of the ETL database for distribution to downstream apps, along with a manifest.
+func main() {
+	snapshotPath := flag.String("output", fmt.Sprintf("data/snapshots/fasten-sources-%s.db", time.Now().UTC().Format("20060102")), "path to write the snapshot database")
+	flag.Parse()
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	manifest, err := etlDatabase.Snapshot(*snapshotPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	manifestJson, _ := json.MarshalIndent(manifest, "", "  ")
+	log.Printf("Created snapshot %s: %s", *snapshotPath, string(manifestJson))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Splits identifiers, locations & endpoints that were wrongly merged into an organization out into a new (or restored)
+// organization. The organizations will not be joined again by future imports or matcher runs.
+//
+//	unmerge -org 1234567890                           lists the revisions of the organization
+//	unmerge -org 1234567890 -revision 42              splits out everything the merge revision added
+//	unmerge -org 1234567890 -endpoints https://a/fhir/ -identifiers OrganizationIdentifierTypeName:FOO CLINIC
+func main() {
+	orgId := flag.String("org", "", "the organization to unmerge")
+	revisionId := flag.Uint("revision", 0, "the merge revision to undo")
+	targetOrgId := flag.String("target", "", "the organization to split into (defaults to the organization merged in by -revision)")
+	identifiers := flag.String("identifiers", "", "comma separated identifiers to split out (type:value)")
+	locations := flag.String("locations", "", "comma separated location ids to split out")
+	endpointIds := flag.String("endpoints", "", "comma separated endpoint ids to split out")
+	reason := flag.String("reason", "", "why the organizations were unmerged")
+	flag.Parse()
+	if *orgId == "" {
+		log.Fatal("-org is required")
+	}
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	request := database.UnmergeRequest{
+		OrganizationID:       *orgId,
+		RevisionID:           *revisionId,
+		TargetOrganizationID: *targetOrgId,
+		LocationIDs:          splitList(*locations),
+		EndpointIDs:          splitList(*endpointIds),
+		Reason:               *reason,
+	}
+	for _, identifier := range splitList(*identifiers) {
+		identifierType, identifierValue, found := strings.Cut(identifier, ":")
+		if !found {
+			log.Fatalf("invalid identifier (%s), expected type:value", identifier)
+		}
+		request.Identifiers = append(request.Identifiers, models.OrganizationIdentifier{
+			IdentifierType:  models.OrganizationIdentifierType(identifierType),
+			IdentifierValue: identifierValue,
+		})
+	}
+
+	if request.RevisionID == 0 && len(request.Identifiers) == 0 && len(request.LocationIDs) == 0 && len(request.EndpointIDs) == 0 {
+		printRevisions(etlDatabase, *orgId)
+		return
+	}
+
+	unmergedOrg, err := etlDatabase.UnmergeOrganization(request, models.SourceUnmerge)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Unmerged %s (%s) from %s: %d identifiers, %d locations, %d endpoints",
+		unmergedOrg.ID, unmergedOrg.Name, *orgId, len(unmergedOrg.OrganizationIdentifiers), len(unmergedOrg.Locations), len(unmergedOrg.Endpoints))
+}
+
+func printRevisions(etlDatabase *database.SqliteRepository, orgId string) {
+	revisions, err := etlDatabase.ListOrganizationRevisions(orgId)
+	if err != nil {
+		log.Fatal(err)
+	}
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "REVISION\tCREATED\tACTION\tSOURCE\tRELATED\tADDED IDENTIFIERS\tADDED LOCATIONS\tADDED ENDPOINTS")
+	for _, revision := range revisions {
+		var addedIdentifiers []string
+		for _, identifier := range revision.Diff.AddedOrganizationIdentifiers {
+			addedIdentifiers = append(addedIdentifiers, models.IdentifierProvenanceKey(&identifier))
+		}
+		fmt.Fprintf(writer, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n",
+			revision.ID, revision.CreatedAt.Format("2006-01-02 15:04"), revision.Action, revision.Source, revision.RelatedOrganizationID,
+			strings.Join(addedIdentifiers, ", "), len(revision.Diff.AddedLocations), len(revision.Diff.AddedEndpoints))
+	}
+	writer.Flush()
+}
+
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/importers/websites"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/overrides"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/validation"
+	progressbar "github.com/schollz/progressbar/v3"
+	"github.com/sirupsen/logrus"
+	"log"
+	"strings"
+	"time"
+)
+
+// Adds related urls (homepages, patient portals, billing & scheduling pages) to organizations from a curated website
+// list, either a CSV file (npi, ein, name & url columns) or a JSON array of {npi, ein, name, url|urls} objects.
+// Records are matched to existing organizations by NPI, EIN or name (see websites.MatchWebsiteRecord), unmatched
+// records are skipped. Urls are classified by kind & portal vendor when they are read (api) or exported.
+// With -dry-run, the changes that would be made to matched organizations are printed, and nothing is written.
+func main() {
+	filePath := flag.String("file", "", "path to the website list (CSV or JSON)")
+	releaseDateFlag := flag.String("release-date", "", "the date the website list was published (YYYY-MM-DD)")
+	dryRun := flag.Bool("dry-run", false, "print the merge plan for each matched organization, without writing to the database")
+	overridesPath := flag.String("overrides", overrides.DefaultPath, "curation overrides file (YAML or JSON), applied after the import")
+	validationPolicy := flag.String("validation-policy", "", "comma separated overrides of the default validation policy, eg. error=reject,invalid_state=keep")
+	mergePoliciesPath := flag.String("merge-policies", "", "merge policy file (YAML or JSON), the default merge policies are used if empty")
+	flag.Parse()
+
+	policy, err := validation.ParsePolicy(*validationPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *filePath == "" {
+		log.Fatal("-file is required")
+	}
+	releaseDate, err := time.Parse("2006-01-02", *releaseDateFlag)
+	if err != nil {
+		log.Fatalf("-release-date is required (YYYY-MM-DD) - %v", err)
+	}
+
+	records, err := websites.Import(*filePath, releaseDate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("found %d website records", len(records))
+
+	repositoryConfig := database.DefaultRepositoryConfig()
+	repositoryConfig.MergePoliciesPath = *mergePoliciesPath
+	openRepository := database.NewRepository
+	if *dryRun {
+		//dry runs never write to the database, not even migrations
+		openRepository = database.NewReadOnlyRepository
+	}
+	etlDatabase, err := openRepository(repositoryConfig, logrus.New())
+	if err != nil {
+		log.Fatalf("Unable to open/load database - %v", err)
+	}
+	defer etlDatabase.Close()
+
+	validator := validation.NewValidator(etlDatabase, policy)
+	matched := map[websites.MatchMethod]int{}
+	unmatched := 0
+	progress := progressbar.Default(int64(len(records)))
+	for ndx := range records {
+		record := &records[ndx]
+		progress.Add(1)
+		progress.Describe(fmt.Sprintf("Processing %s", strings.Join(record.URLs, ", ")))
+
+		foundOrg, method, err := websites.MatchWebsiteRecord(etlDatabase, record)
+		if err != nil {
+			log.Fatal(err)
+		} else if foundOrg == nil {
+			unmatched++
+			continue
+		}
+		matched[method]++
+
+		org, err := record.Organization(foundOrg.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *dryRun {
+			_, result, err := etlDatabase.PlanMergeOrganization(org, models.SourceWebsites)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if plan := result.Plan(); len(plan) > 0 {
+				fmt.Printf("\nmerge website record (row %d, by %s) into %s (%s)\n", record.Provenance.SourceRow, method, foundOrg.ID, foundOrg.Name)
+				for _, line := range plan {
+					fmt.Printf("    %s\n", line)
+				}
+				for _, relatedUrl := range models.ClassifyRelatedUrls(record.URLs) {
+					fmt.Printf("    %s: %s %s\n", relatedUrl.URL, relatedUrl.Kind, relatedUrl.PortalVendor)
+				}
+			}
+			continue
+		}
+
+		admitted, err := validator.Admit(org, models.SourceWebsites)
+		if err != nil {
+			log.Fatal(err)
+		} else if !admitted {
+			continue
+		}
+		_, _, err = etlDatabase.MergeOrganization(org, models.SourceWebsites)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("Matched %d website records (%d by NPI, %d by EIN, %d by name), %d unmatched",
+		len(records)-unmatched, matched[websites.MatchMethodNPI], matched[websites.MatchMethodEIN], matched[websites.MatchMethodName], unmatched)
+	if !*dryRun {
+		overridesSummary, err := overrides.ApplyFile(etlDatabase, *overridesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Applied overrides to %d organizations & %d endpoints", overridesSummary.Organizations, overridesSummary.Endpoints)
+	}
+	log.Printf("FINISHED IMPORTING WEBSITES")
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// accepted header names for each column, so that the common free ZIP code datasets can be imported without conversion
+var zipCodeColumns = map[string][]string{
+	"zip":               {"zip", "zipcode", "zip_code", "postal_code"},
+	"city":              {"city", "primary_city", "usps_city"},
+	"state":             {"state", "state_code", "state_id"},
+	"acceptable_cities": {"acceptable_cities"},
+}
+
+// Replaces the offline ZIP code reference table from a CSV file (with a header row), then re-validates every location.
+// Required columns: zip, city & state. Optional: acceptable_cities (comma separated)
+func main() {
+	filePath := flag.String("file", "", "path to the ZIP code reference CSV")
+	flag.Parse()
+	if *filePath == "" {
+		log.Fatal("-file is required")
+	}
+
+	zipCodes, err := readZipCodes(*filePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("found %d ZIP code/city combinations", len(zipCodes))
+
+	etlDatabase, err := database.NewRepository(database.DefaultRepositoryConfig(), logrus.New())
+	if err != nil {
+		log.Fatal("Unable to open/load database")
+	}
+	defer etlDatabase.Close()
+
+	err = etlDatabase.ReplaceZipCodes(zipCodes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = etlDatabase.ValidateLocations()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readZipCodes(filePath string) ([]models.ZipCode, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	csvReader := csv.NewReader(file)
+	csvReader.FieldsPerRecord = -1
+	header, err := csvReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading ZIP code header: %v", err)
+	}
+	columns := map[string]int{}
+	for ndx, headerName := range header {
+		headerName = strings.ToLower(strings.TrimSpace(headerName))
+		for column, aliases := range zipCodeColumns {
+			for _, alias := range aliases {
+				if headerName == alias {
+					columns[column] = ndx
+				}
+			}
+		}
+	}
+	for _, requiredColumn := range []string{"zip", "city", "state"} {
+		if _, ok := columns[requiredColumn]; !ok {
+			return nil, fmt.Errorf("ZIP code file is missing a %s column (%v)", requiredColumn, zipCodeColumns[requiredColumn])
+		}
+	}
+
+	seen := map[string]bool{}
+	var zipCodes []models.ZipCode
+	for {
+		rec, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if len(rec) <= columns["zip"] || len(rec) <= columns["city"] || len(rec) <= columns["state"] {
+			continue
+		}
+		zip, _ := utils.StandardizePostalCode(rec[columns["zip"]])
+		if len(zip) < 5 && strings.Trim(zip, "0123456789") == "" {
+			//leading zeros are often lost when ZIP codes are stored as numbers
+			zip = strings.Repeat("0", 5-len(zip)) + zip
+		}
+		state := utils.StandardizeState(rec[columns["state"]])
+
+		cities := []string{rec[columns["city"]]}
+		if acceptableNdx, ok := columns["acceptable_cities"]; ok && acceptableNdx < len(rec) {
+			cities = append(cities, strings.Split(rec[acceptableNdx], ",")...)
+		}
+		for ndx, city := range cities {
+			city = utils.StandardizeCity(city)
+			if city == "" || seen[zip+"|"+city] {
+				continue
+			}
+			seen[zip+"|"+city] = true
+			zipCodes = append(zipCodes, models.ZipCode{ZipCode: zip, City: city, State: state, Primary: ndx == 0})
+		}
+	}
+	return zipCodes, nil
+}
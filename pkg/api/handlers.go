@@ -0,0 +1,207 @@
+package api
+
+import (
+	"errors"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// identifierTypes are the short identifier type names accepted by /identifiers, the full type names are also accepted.
+// Only merge key identifiers belong to a single organization, see models.IsMergeKeyIdentifierType.
+var identifierTypes = map[string]models.OrganizationIdentifierType{
+	"npi":  models.OrganizationIdentifierTypeNPI,
+	"ein":  models.OrganizationIdentifierTypeEIN,
+	"name": models.OrganizationIdentifierTypeName,
+	"ccn":  models.OrganizationIdentifierTypeCCN,
+	"clia": models.OrganizationIdentifierTypeCLIA,
+	"oid":  models.OrganizationIdentifierTypeOID,
+}
+
+// organizationResponse is an organization with its related urls classified by kind & portal vendor
+type organizationResponse struct {
+	models.Organization
+	RelatedUrlDetails []models.RelatedUrl `json:"related_url_details,omitempty"`
+}
+
+func newOrganizationResponse(org models.Organization) organizationResponse {
+	return organizationResponse{Organization: org, RelatedUrlDetails: models.ClassifyRelatedUrls(org.RelatedUrls)}
+}
+
+type searchResponse struct {
+	Organizations []organizationResponse `json:"organizations"`
+	Limit         int                    `json:"limit"`
+	Offset        int                    `json:"offset"`
+}
+
+// GET /organizations?name=&state=&postal_code=&has_endpoints=&limit=&offset=
+func (s *Server) searchOrganizations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	search := database.OrganizationSearch{
+		Name:       query.Get("name"),
+		State:      query.Get("state"),
+		PostalCode: query.Get("postal_code"),
+		Limit:      DefaultSearchLimit,
+	}
+	if search.Name == "" && search.State == "" && search.PostalCode == "" {
+		writeError(w, http.StatusBadRequest, "at least one of name, state or postal_code is required")
+		return
+	}
+	var err error
+	if value := query.Get("has_endpoints"); value != "" {
+		if search.HasEndpoints, err = strconv.ParseBool(value); err != nil {
+			writeError(w, http.StatusBadRequest, "has_endpoints must be true or false")
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if search.Limit, err = strconv.Atoi(value); err != nil || search.Limit < 1 || search.Limit > MaxSearchLimit {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(MaxSearchLimit))
+			return
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if search.Offset, err = strconv.Atoi(value); err != nil || search.Offset < 0 {
+			writeError(w, http.StatusBadRequest, "offset must be a positive number")
+			return
+		}
+	}
+
+	orgs, err := s.Repository.SearchOrganizations(search)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := searchResponse{Organizations: []organizationResponse{}, Limit: search.Limit, Offset: search.Offset}
+	for _, org := range orgs {
+		response.Organizations = append(response.Organizations, newOrganizationResponse(org))
+	}
+	writeJSON(w, r, response)
+}
+
+// GET /organizations/{npi}, /organizations/{npi}/identifiers, /organizations/{npi}/locations & /organizations/{npi}/endpoints
+// The organization is found by any of its NPIs (primary or not), hidden organizations & endpoints are not returned.
+func (s *Server) getOrganization(w http.ResponseWriter, r *http.Request) {
+	npi, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/organizations/"), "/")
+	if npi == "" {
+		writeError(w, http.StatusNotFound, "organization npi is required")
+		return
+	}
+	org, err := s.Repository.FindOrganizationByNPI(npi)
+	if errors.Is(err, database.ErrOrganizationNotFound) || (err == nil && org.Hidden) {
+		writeError(w, http.StatusNotFound, "organization ("+npi+") not found")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch resource {
+	case "":
+		writeJSON(w, r, newOrganizationResponse(*org))
+	case "identifiers":
+		writeJSON(w, r, nonNil(org.AllIdentifiers()))
+	case "locations":
+		writeJSON(w, r, nonNil(org.Locations))
+	case "endpoints":
+		writeJSON(w, r, nonNil(visibleEndpoints(org.Endpoints)))
+	default:
+		writeError(w, http.StatusNotFound, "unknown organization resource ("+resource+")")
+	}
+}
+
+// GET /identifiers?type=&value=
+// Returns the organization that owns the identifier, unless it is hidden. State scoped & issuer scoped identifiers
+// (eg. state licenses) are not unique, so they cannot be looked up.
+func (s *Server) lookupIdentifier(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	identifierType, ok := identifierTypes[strings.ToLower(query.Get("type"))]
+	if !ok {
+		identifierType = models.OrganizationIdentifierType(query.Get("type"))
+		if !strings.HasPrefix(string(identifierType), "OrganizationIdentifierType") {
+			writeError(w, http.StatusBadRequest, "unknown identifier type ("+query.Get("type")+")")
+			return
+		}
+	}
+	if !models.IsMergeKeyIdentifierType(identifierType) {
+		writeError(w, http.StatusBadRequest, "identifier type ("+query.Get("type")+") is not unique to an organization, it cannot be looked up")
+		return
+	}
+	value := query.Get("value")
+	if value == "" {
+		writeError(w, http.StatusBadRequest, "value is required")
+		return
+	}
+	if identifierType == models.OrganizationIdentifierTypeName {
+		normalizedName, err := utils.NormalizeOrganizationName(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		value = normalizedName
+	} else {
+		value = strings.TrimSpace(value)
+	}
+
+	org, err := s.Repository.FindOrganizationByIdentifiers([]models.OrganizationIdentifier{{
+		IdentifierType:  identifierType,
+		IdentifierValue: value,
+	}})
+	if errors.Is(err, database.ErrOrganizationNotFound) || (err == nil && org.Hidden) {
+		writeError(w, http.StatusNotFound, "no organization found with identifier ("+value+")")
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, r, newOrganizationResponse(*org))
+}
+
+// GET /endpoints?url=
+// Hidden endpoints, and endpoints of hidden organizations, are not returned.
+func (s *Server) getEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpointUrl := r.URL.Query().Get("url")
+	if endpointUrl == "" {
+		writeError(w, http.StatusBadRequest, "url is required")
+		return
+	}
+	endpoints, err := s.Repository.FindEndpointsByIds([]string{utils.NormalizeEndpointId(endpointUrl)})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if len(endpoints) == 0 || endpoints[0].Hidden {
+		writeError(w, http.StatusNotFound, "endpoint ("+endpointUrl+") not found")
+		return
+	}
+	orgs, err := s.Repository.FindOrganizationsByIds([]string{endpoints[0].OrganizationID})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	} else if len(orgs) == 0 || orgs[0].Hidden {
+		writeError(w, http.StatusNotFound, "endpoint ("+endpointUrl+") not found")
+		return
+	}
+	writeJSON(w, r, endpoints[0])
+}
+
+// visibleEndpoints filters out the endpoints hidden by an override
+func visibleEndpoints(endpoints []models.Endpoint) []models.Endpoint {
+	var visible []models.Endpoint
+	for _, end := range endpoints {
+		if !end.Hidden {
+			visible = append(visible, end)
+		}
+	}
+	return visible
+}
+
+// nonNil returns an empty (rather than nil) slice, so empty lists are serialized as [] instead of null
+func nonNil[T any](values []T) []T {
+	if values == nil {
+		return []T{}
+	}
+	return values
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+)
+
+// openAPIDocument describes every route & response schema. Must be updated whenever a route, or the json tags of a
+// returned model, change.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// GET /openapi.json
+func (s *Server) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, json.RawMessage(openAPIDocument))
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// Server exposes the repository over HTTP, read-only. Every response is JSON (using the model json tags), with a strong
+// ETag so clients can revalidate cached responses with If-None-Match.
+// See openapi.json for the routes.
+type Server struct {
+	Repository *database.SqliteRepository
+	Logger     logrus.FieldLogger
+
+	mux *http.ServeMux
+}
+
+func NewServer(repository *database.SqliteRepository, logger logrus.FieldLogger) *Server {
+	server := Server{Repository: repository, Logger: logger, mux: http.NewServeMux()}
+	server.mux.HandleFunc("/openapi.json", server.getOpenAPI)
+	server.mux.HandleFunc("/organizations", server.searchOrganizations)
+	server.mux.HandleFunc("/organizations/", server.getOrganization)
+	server.mux.HandleFunc("/identifiers", server.lookupIdentifier)
+	server.mux.HandleFunc("/endpoints", server.getEndpoint)
+	return &server
+}
+
+// ServeHTTP rejects any request that could modify the repository, and logs every request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		recorder.Header().Set("Allow", "GET, HEAD")
+		writeError(recorder, http.StatusMethodNotAllowed, "the api is read-only")
+	} else {
+		s.mux.ServeHTTP(recorder, r)
+	}
+	s.Logger.WithFields(logrus.Fields{
+		"method":   r.Method,
+		"path":     r.URL.RequestURI(),
+		"status":   recorder.status,
+		"bytes":    recorder.bytes,
+		"duration": time.Since(start).String(),
+		"remote":   r.RemoteAddr,
+	}).Info("api request")
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(body []byte) (int, error) {
+	written, err := sr.ResponseWriter.Write(body)
+	sr.bytes += written
+	return written, err
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes the value with an ETag (a hash of the body). If the request's If-None-Match matches the ETag,
+// a 304 is returned instead of the body.
+func writeJSON(w http.ResponseWriter, r *http.Request, value interface{}) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	hash := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%s"`, hex.EncodeToString(hash[:16]))
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write(body)
+	}
+}
+
+// etagMatches implements the If-None-Match comparison (weak comparison, any listed tag or *)
+func etagMatches(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	body, _ := json.Marshal(errorResponse{Error: message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
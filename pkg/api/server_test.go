@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// newTestServer creates a server for a new (empty) database, with the organizations merged into it.
+// Organizations are hidden (along with their endpoints) with an override, since imports never change visibility.
+func newTestServer(t *testing.T, orgs ...models.Organization) *Server {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	config := database.DefaultRepositoryConfig()
+	config.DatabaseLocation = filepath.Join(t.TempDir(), "api-test.db")
+	repository, err := database.NewRepository(config, logger)
+	if err != nil {
+		t.Fatalf("failed to create the test database: %v", err)
+	}
+	t.Cleanup(func() { repository.Close() })
+
+	for ndx := range orgs {
+		org := orgs[ndx]
+		if _, _, err := repository.MergeOrganization(&org, "test"); err != nil {
+			t.Fatalf("failed to merge organization (%s): %v", org.ID, err)
+		}
+		if org.Hidden || len(visibleEndpoints(org.Endpoints)) != len(org.Endpoints) {
+			if _, err := repository.OverrideOrganization(&orgs[ndx], models.SourceOverrides); err != nil {
+				t.Fatalf("failed to override organization (%s): %v", org.ID, err)
+			}
+		}
+	}
+	return NewServer(repository, logger)
+}
+
+func testOrganizations() []models.Organization {
+	return []models.Organization{
+		{
+			ID:     "org-1",
+			Name:   "ALPHA CLINIC",
+			Source: "test",
+			OrganizationIdentifiers: []models.OrganizationIdentifier{
+				{IdentifierType: models.OrganizationIdentifierTypeName, IdentifierValue: "ALPHA CLINIC"},
+				{IdentifierType: models.OrganizationIdentifierTypePrimaryNPI, IdentifierValue: "1111111111"},
+				{IdentifierType: models.OrganizationIdentifierTypeNPI, IdentifierValue: "1222222222"},
+			},
+			Endpoints: []models.Endpoint{
+				{URL: "https://fhir.alpha.example.com/r4/", PlatformType: "epic"},
+				{URL: "https://fhir.alpha.example.com/legacy/", PlatformType: "epic", Hidden: true},
+			},
+		},
+		{
+			ID:     "org-2",
+			Name:   "BETA HOSPITAL",
+			Source: "test",
+			Hidden: true,
+			OrganizationIdentifiers: []models.OrganizationIdentifier{
+				{IdentifierType: models.OrganizationIdentifierTypePrimaryNPI, IdentifierValue: "1333333333"},
+				{IdentifierType: models.OrganizationIdentifierTypeNPI, IdentifierValue: "1444444444"},
+			},
+			Endpoints: []models.Endpoint{
+				{URL: "https://fhir.beta.example.com/r4/", PlatformType: "cerner"},
+			},
+		},
+		{
+			ID:     "org-3",
+			Name:   "ALPHA LABS",
+			Source: "test",
+			OrganizationIdentifiers: []models.OrganizationIdentifier{
+				{IdentifierType: models.OrganizationIdentifierTypeName, IdentifierValue: "ALPHA LABS"},
+				{IdentifierType: models.OrganizationIdentifierTypePrimaryNPI, IdentifierValue: "1555555555"},
+			},
+			Endpoints: []models.Endpoint{
+				{URL: "https://fhir.alphalabs.example.com/r4/", PlatformType: "epic", Hidden: true},
+			},
+		},
+	}
+}
+
+func serve(server *Server, method string, target string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, nil)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestGetOrganization_ByNPI(t *testing.T) {
+	server := newTestServer(t, testOrganizations()...)
+
+	// the primary & other NPIs resolve to the same organization, the organization id is not an NPI
+	for _, npi := range []string{"1111111111", "1222222222"} {
+		response := serve(server, http.MethodGet, "/organizations/"+npi, nil)
+		if response.Code != http.StatusOK {
+			t.Fatalf("expected status 200 for npi %s, got %d (%s)", npi, response.Code, response.Body.String())
+		}
+		var org models.Organization
+		if err := json.Unmarshal(response.Body.Bytes(), &org); err != nil {
+			t.Fatalf("failed to parse the response: %v", err)
+		}
+		if org.ID != "org-1" {
+			t.Errorf("expected organization org-1 for npi %s, got %q", npi, org.ID)
+		}
+	}
+	if response := serve(server, http.MethodGet, "/organizations/org-1", nil); response.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for an organization id, got %d", response.Code)
+	}
+}
+
+func TestGetOrganization_ETag(t *testing.T) {
+	server := newTestServer(t, testOrganizations()...)
+
+	response := serve(server, http.MethodGet, "/organizations/1111111111", nil)
+	etag := response.Header().Get("ETag")
+	if response.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected status 200 with an ETag, got %d (%q)", response.Code, etag)
+	}
+
+	for _, ifNoneMatch := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		response = serve(server, http.MethodGet, "/organizations/1111111111", map[string]string{"If-None-Match": ifNoneMatch})
+		if response.Code != http.StatusNotModified {
+			t.Errorf("expected status 304 for If-None-Match %s, got %d", ifNoneMatch, response.Code)
+		}
+		if response.Body.Len() != 0 {
+			t.Errorf("expected an empty body for If-None-Match %s, got %q", ifNoneMatch, response.Body.String())
+		}
+		if response.Header().Get("ETag") != etag {
+			t.Errorf("expected ETag %s for If-None-Match %s, got %q", etag, ifNoneMatch, response.Header().Get("ETag"))
+		}
+	}
+
+	response = serve(server, http.MethodGet, "/organizations/1111111111", map[string]string{"If-None-Match": `"stale"`})
+	if response.Code != http.StatusOK || response.Body.Len() == 0 {
+		t.Errorf("expected status 200 with a body for a stale ETag, got %d", response.Code)
+	}
+}
+
+func TestHead(t *testing.T) {
+	server := newTestServer(t, testOrganizations()...)
+
+	get := serve(server, http.MethodGet, "/organizations/1111111111/endpoints", nil)
+	head := serve(server, http.MethodHead, "/organizations/1111111111/endpoints", nil)
+	if head.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", head.Code)
+	}
+	if head.Body.Len() != 0 {
+		t.Errorf("expected an empty body, got %q", head.Body.String())
+	}
+	if head.Header().Get("ETag") == "" || head.Header().Get("ETag") != get.Header().Get("ETag") {
+		t.Errorf("expected the GET ETag %q, got %q", get.Header().Get("ETag"), head.Header().Get("ETag"))
+	}
+	if head.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected content type application/json, got %q", head.Header().Get("Content-Type"))
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	server := newTestServer(t, testOrganizations()...)
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		response := serve(server, method, "/organizations/1111111111", nil)
+		if response.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405 for %s, got %d", method, response.Code)
+		}
+		if allow := response.Header().Get("Allow"); allow != "GET, HEAD" {
+			t.Errorf("expected Allow GET, HEAD for %s, got %q", method, allow)
+		}
+	}
+}
+
+func TestHidden(t *testing.T) {
+	server := newTestServer(t, testOrganizations()...)
+
+	notFound := []string{
+		"/organizations/1333333333",
+		"/organizations/1333333333/endpoints",
+		"/identifiers?type=npi&value=1444444444",
+		"/endpoints?url=https://fhir.beta.example.com/r4/",
+		"/endpoints?url=https://fhir.alpha.example.com/legacy/",
+	}
+	for _, target := range notFound {
+		if response := serve(server, http.MethodGet, target, nil); response.Code != http.StatusNotFound {
+			t.Errorf("expected status 404 for %s, got %d", target, response.Code)
+		}
+	}
+	if response := serve(server, http.MethodGet, "/endpoints?url=https://fhir.alpha.example.com/r4/", nil); response.Code != http.StatusOK {
+		t.Errorf("expected status 200 for a visible endpoint, got %d", response.Code)
+	}
+
+	response := serve(server, http.MethodGet, "/organizations/1111111111/endpoints", nil)
+	var endpoints []models.Endpoint
+	if err := json.Unmarshal(response.Body.Bytes(), &endpoints); err != nil {
+		t.Fatalf("failed to parse the response: %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].URL != "https://fhir.alpha.example.com/r4/" {
+		t.Errorf("expected only the visible endpoint, got %v", endpoints)
+	}
+
+	// org-3 only has a hidden endpoint
+	for _, testCase := range []struct {
+		target   string
+		expected []string
+	}{
+		{"/organizations?name=alpha", []string{"org-1", "org-3"}},
+		{"/organizations?name=alpha&has_endpoints=true", []string{"org-1"}},
+	} {
+		response := serve(server, http.MethodGet, testCase.target, nil)
+		var search searchResponse
+		if err := json.Unmarshal(response.Body.Bytes(), &search); err != nil {
+			t.Fatalf("failed to parse the response: %v", err)
+		}
+		var orgIds []string
+		for _, org := range search.Organizations {
+			orgIds = append(orgIds, org.ID)
+		}
+		if strings.Join(orgIds, ",") != strings.Join(testCase.expected, ",") {
+			t.Errorf("expected organizations %v for %s, got %v", testCase.expected, testCase.target, orgIds)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package clustering
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+// Signal is a kind of evidence that two organizations belong to the same health system
+type Signal string
+
+const (
+	// SignalTIN organizations share an EIN, or an organization's parent TIN is another organization's EIN
+	SignalTIN Signal = "tin"
+	// SignalParentLBN an organization's parent LBN is another organization's name (or both have the same parent LBN)
+	SignalParentLBN Signal = "parent_lbn"
+	// SignalAddress organizations share a practice location
+	SignalAddress Signal = "address"
+)
+
+type ClustererConfig struct {
+	// the score each shared signal contributes to a pair of organizations. Each signal is counted at most once per pair.
+	Weights map[Signal]float64
+	// pairs of organizations scoring at least Threshold are clustered together
+	Threshold float64
+	// signals shared by more organizations than this (eg. a large medical office building) are only used if their weight
+	// reaches the Threshold on its own, since scoring every pair would be too slow & too noisy.
+	MaxPairwiseMembers int
+	// clusters with fewer members than this are not saved as health systems
+	MinMembers int
+}
+
+func DefaultClustererConfig() ClustererConfig {
+	return ClustererConfig{
+		Weights: map[Signal]float64{
+			SignalTIN:       1.0,
+			SignalParentLBN: 0.6,
+			SignalAddress:   0.4,
+		},
+		Threshold:          1.0,
+		MaxPairwiseMembers: 50,
+		MinMembers:         2,
+	}
+}
+
+// ClusterSummary counts the outcome of a clustering run
+type ClusterSummary struct {
+	Organizations int // organizations considered (individual providers are skipped)
+	Systems       int
+	Members       int // organizations that belong to a health system
+	LargestSystem int
+}
+
+// Clusterer groups organizations (NPIs) into health systems, using the EINs, parent organization fields & practice
+// locations they share.
+type Clusterer struct {
+	Logger     logrus.FieldLogger
+	Repository *database.SqliteRepository
+	Config     ClustererConfig
+}
+
+func NewClusterer(repository *database.SqliteRepository, config ClustererConfig, logger logrus.FieldLogger) *Clusterer {
+	return &Clusterer{Logger: logger, Repository: repository, Config: config}
+}
+
+// clusterOrganization is the subset of an organization kept in memory while clustering
+type clusterOrganization struct {
+	ID        string
+	Name      string
+	ParentLBN string
+}
+
+// signalMember is an organization sharing a signal key. viaParent is true if the key came from the organization's
+// parent organization fields, rather than its own name or EIN.
+type signalMember struct {
+	ndx       int
+	viaParent bool
+}
+
+type signalKey struct {
+	Signal Signal
+	Value  string
+}
+
+func (key signalKey) String() string {
+	return fmt.Sprintf("%s:%s", key.Signal, key.Value)
+}
+
+// Run rebuilds every health system
+func (c *Clusterer) Run() (*ClusterSummary, error) {
+	summary := ClusterSummary{}
+
+	var orgs []clusterOrganization
+	keyMembers := map[signalKey][]signalMember{}
+	err := c.Repository.FindOrganizationClusterSignalsInBatches(1000, func(batch []models.Organization) error {
+		for ndx := range batch {
+			org := &batch[ndx]
+			if org.OrganizationType == models.OrganizationTypeTypeIndividual {
+				continue
+			}
+			orgNdx := len(orgs)
+			orgs = append(orgs, clusterOrganization{ID: org.ID, Name: org.Name, ParentLBN: org.ParentOrganizationLBN})
+			for key, viaParent := range organizationSignalKeys(org) {
+				keyMembers[key] = append(keyMembers[key], signalMember{ndx: orgNdx, viaParent: viaParent})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find organizations - %v", err)
+	}
+	summary.Organizations = len(orgs)
+	c.Logger.Infof("Clustering %d organizations using %d shared signals", len(orgs), len(keyMembers))
+
+	uf := newUnionFind(len(orgs))
+	pairSignals := map[[2]int]map[Signal]bool{}
+	for key, members := range keyMembers {
+		if len(members) < 2 || !c.usable(key, members) {
+			continue
+		}
+		if c.Config.Weights[key.Signal] >= c.Config.Threshold {
+			for _, member := range members[1:] {
+				uf.union(members[0].ndx, member.ndx)
+			}
+			continue
+		}
+		if c.Config.Weights[key.Signal] <= 0 || len(members) > c.Config.MaxPairwiseMembers {
+			continue
+		}
+		for i := 0; i < len(members); i++ {
+			for j := i + 1; j < len(members); j++ {
+				if key.Signal == SignalParentLBN && !members[i].viaParent && !members[j].viaParent {
+					continue
+				}
+				pair := [2]int{members[i].ndx, members[j].ndx}
+				if pairSignals[pair] == nil {
+					pairSignals[pair] = map[Signal]bool{}
+				}
+				pairSignals[pair][key.Signal] = true
+			}
+		}
+	}
+	for pair, signals := range pairSignals {
+		score := 0.0
+		for signal := range signals {
+			score += c.Config.Weights[signal]
+		}
+		if score >= c.Config.Threshold {
+			uf.union(pair[0], pair[1])
+		}
+	}
+
+	// the signals each organization shares with other members of its cluster
+	memberSignals := map[int][]string{}
+	for key, members := range keyMembers {
+		if len(members) < 2 || !c.usable(key, members) || c.Config.Weights[key.Signal] <= 0 {
+			continue
+		}
+		rootCounts := map[int]int{}
+		for _, member := range members {
+			rootCounts[uf.find(member.ndx)]++
+		}
+		for _, member := range members {
+			if rootCounts[uf.find(member.ndx)] > 1 {
+				memberSignals[member.ndx] = append(memberSignals[member.ndx], key.String())
+			}
+		}
+	}
+
+	clusters := map[int][]int{}
+	for ndx := range orgs {
+		root := uf.find(ndx)
+		clusters[root] = append(clusters[root], ndx)
+	}
+	minMembers := c.Config.MinMembers
+	if minMembers < 2 {
+		minMembers = 2
+	}
+	var systems []models.HealthSystem
+	for _, memberNdxs := range clusters {
+		if len(memberNdxs) < minMembers {
+			continue
+		}
+		system := models.HealthSystem{MemberCount: len(memberNdxs)}
+		var members []*clusterOrganization
+		for _, ndx := range memberNdxs {
+			members = append(members, &orgs[ndx])
+			signals := memberSignals[ndx]
+			sort.Strings(signals)
+			system.Members = append(system.Members, models.HealthSystemMember{OrganizationID: orgs[ndx].ID, Signals: signals})
+		}
+		sort.Slice(system.Members, func(i, j int) bool {
+			return system.Members[i].OrganizationID < system.Members[j].OrganizationID
+		})
+		system.ID = "hs-" + system.Members[0].OrganizationID
+		for ndx := range system.Members {
+			system.Members[ndx].HealthSystemID = system.ID
+		}
+		system.Name = representativeName(members)
+
+		systems = append(systems, system)
+		summary.Members += system.MemberCount
+		if system.MemberCount > summary.LargestSystem {
+			summary.LargestSystem = system.MemberCount
+		}
+	}
+	sort.Slice(systems, func(i, j int) bool {
+		return systems[i].ID < systems[j].ID
+	})
+	summary.Systems = len(systems)
+
+	err = c.Repository.ReplaceHealthSystems(systems)
+	if err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// usable returns false for parent LBN keys that no organization references as its parent: organizations that merely
+// have the same name (eg. "FAMILY PRACTICE") are not evidence of a shared health system.
+func (c *Clusterer) usable(key signalKey, members []signalMember) bool {
+	if key.Signal != SignalParentLBN {
+		return true
+	}
+	for _, member := range members {
+		if member.viaParent {
+			return true
+		}
+	}
+	return false
+}
+
+// organizationSignalKeys returns the signal keys of an organization. The value is true if the key only came from the
+// organization's parent organization fields.
+func organizationSignalKeys(org *models.Organization) map[signalKey]bool {
+	keys := map[signalKey]bool{}
+	add := func(key signalKey, viaParent bool) {
+		if key.Value == "" {
+			return
+		}
+		if existingViaParent, found := keys[key]; found {
+			viaParent = viaParent && existingViaParent
+		}
+		keys[key] = viaParent
+	}
+
+	//EINs are shared by many organizations, so they are attribute identifiers (see models.IsMergeKeyIdentifierType)
+	for _, identifier := range org.AttributeIdentifiers {
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeEIN {
+			add(signalKey{SignalTIN, normalizeTIN(identifier.IdentifierValue)}, false)
+		}
+	}
+	add(signalKey{SignalTIN, normalizeTIN(org.ParentOrganizationTIN)}, true)
+
+	if name, err := utils.NormalizeOrganizationName(org.Name); err == nil {
+		add(signalKey{SignalParentLBN, name}, false)
+	}
+	if org.ParentOrganizationLBN != "" {
+		if parentName, err := utils.NormalizeOrganizationName(org.ParentOrganizationLBN); err == nil {
+			add(signalKey{SignalParentLBN, parentName}, true)
+		}
+	}
+
+	for _, location := range org.Locations {
+		add(signalKey{SignalAddress, location.ID}, false)
+	}
+	return keys
+}
+
+// normalizeTIN strips the formatting from an EIN/TIN (eg. 12-3456789). Anything other than 9 digits is ignored.
+func normalizeTIN(tin string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, tin)
+	if len(digits) != 9 || digits == "000000000" {
+		return ""
+	}
+	return digits
+}
+
+// representativeName picks the display name of a health system: the name referenced as a parent LBN by the most
+// members (weighted double), or failing that, the most common member name. Ties are broken alphabetically.
+func representativeName(members []*clusterOrganization) string {
+	scores := map[string]int{}
+	displayNames := map[string]string{}
+	score := func(name string, points int) {
+		normalized, err := utils.NormalizeOrganizationName(name)
+		if err != nil || normalized == "" {
+			return
+		}
+		scores[normalized] += points
+		if _, found := displayNames[normalized]; !found {
+			displayNames[normalized] = strings.TrimSpace(name)
+		}
+	}
+	for _, member := range members {
+		score(member.Name, 1)
+		if member.ParentLBN != "" {
+			score(member.ParentLBN, 2)
+		}
+	}
+
+	bestName := ""
+	for normalized, points := range scores {
+		if bestName == "" || points > scores[bestName] || (points == scores[bestName] && normalized < bestName) {
+			bestName = normalized
+		}
+	}
+	return displayNames[bestName]
+}
@@ -0,0 +1,103 @@
+package clustering
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+// testNPPESRecord is an NPPES organization record, with its identifiers split the same way as the NPPES extract
+func testNPPESRecord(npi string, name string, ein string, parentTIN string) *models.Organization {
+	identifiers := []models.OrganizationIdentifier{
+		{IdentifierType: models.OrganizationIdentifierTypeName, IdentifierValue: name},
+		{IdentifierType: models.OrganizationIdentifierTypePrimaryNPI, IdentifierValue: npi},
+		{IdentifierType: models.OrganizationIdentifierTypeNPI, IdentifierValue: npi},
+	}
+	if ein != "" {
+		identifiers = append(identifiers, models.OrganizationIdentifier{IdentifierType: models.OrganizationIdentifierTypeEIN, IdentifierValue: ein})
+	}
+	keyIdentifiers, attributeIdentifiers := models.SplitAttributeIdentifiers(identifiers)
+	return &models.Organization{
+		ID:                      npi,
+		OrganizationType:        models.OrganizationTypeTypeOrganization,
+		Name:                    name,
+		ParentOrganizationTIN:   parentTIN,
+		OrganizationIdentifiers: keyIdentifiers,
+		AttributeIdentifiers:    attributeIdentifiers,
+	}
+}
+
+func TestClusterer_TIN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		records []*models.Organization
+		signals []string
+	}{
+		{
+			"organizations share an EIN",
+			[]*models.Organization{
+				testNPPESRecord("1111111111", "ALPHA HOSPITAL", "12-3456789", ""),
+				testNPPESRecord("1222222222", "ALPHA URGENT CARE", "123456789", ""),
+			},
+			[]string{"tin:123456789"},
+		},
+		{
+			"parent TIN is another organization's EIN",
+			[]*models.Organization{
+				testNPPESRecord("1111111111", "ALPHA HOSPITAL", "123456789", ""),
+				testNPPESRecord("1222222222", "ALPHA URGENT CARE", "", "12-3456789"),
+			},
+			[]string{"tin:123456789"},
+		},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			logger := logrus.New()
+			logger.SetOutput(io.Discard)
+			config := database.DefaultRepositoryConfig()
+			config.DatabaseLocation = filepath.Join(t.TempDir(), "clustering-test.db")
+			repository, err := database.NewRepository(config, logger)
+			if err != nil {
+				t.Fatalf("failed to create the test database: %v", err)
+			}
+			defer repository.Close()
+
+			records := append(testCase.records, testNPPESRecord("1333333333", "BETA CLINIC", "987654321", ""))
+			for _, record := range records {
+				written, _, err := repository.MergeOrganization(record, models.SourceNPPES)
+				if err != nil {
+					t.Fatalf("failed to merge organization (%s): %v", record.ID, err)
+				}
+				// a shared EIN is not a merge key, every NPI remains a separate organization
+				if written.ID != record.ID {
+					t.Fatalf("expected organization %s, got %s", record.ID, written.ID)
+				}
+			}
+
+			summary, err := NewClusterer(repository, DefaultClustererConfig(), logger).Run()
+			if err != nil {
+				t.Fatalf("failed to cluster: %v", err)
+			}
+			if summary.Organizations != 3 || summary.Systems != 1 || summary.Members != 2 {
+				t.Errorf("expected 3 organizations in 1 system of 2 members, got %+v", summary)
+			}
+
+			system, err := repository.FindHealthSystemByOrganizationId("1111111111")
+			if err != nil {
+				t.Fatalf("failed to find the health system: %v", err)
+			}
+			if len(system.Members) != 2 || system.Members[1].OrganizationID != "1222222222" {
+				t.Fatalf("expected members 1111111111 & 1222222222, got %v", system.Members)
+			}
+			for _, member := range system.Members {
+				if len(member.Signals) != len(testCase.signals) || member.Signals[0] != testCase.signals[0] {
+					t.Errorf("expected signals %v for %s, got %v", testCase.signals, member.OrganizationID, member.Signals)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package clustering
+
+// unionFind is a disjoint-set forest over organization indexes, with path compression & union by size
+type unionFind struct {
+	parent []int
+	size   []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := unionFind{parent: make([]int, n), size: make([]int, n)}
+	for ndx := range uf.parent {
+		uf.parent[ndx] = ndx
+		uf.size[ndx] = 1
+	}
+	return &uf
+}
+
+func (uf *unionFind) find(ndx int) int {
+	for uf.parent[ndx] != ndx {
+		uf.parent[ndx] = uf.parent[uf.parent[ndx]]
+		ndx = uf.parent[ndx]
+	}
+	return ndx
+}
+
+func (uf *unionFind) union(a int, b int) {
+	rootA, rootB := uf.find(a), uf.find(b)
+	if rootA == rootB {
+		return
+	}
+	if uf.size[rootA] < uf.size[rootB] {
+		rootA, rootB = rootB, rootA
+	}
+	uf.parent[rootB] = rootA
+	uf.size[rootA] += uf.size[rootB]
+}
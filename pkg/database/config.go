@@ -0,0 +1,77 @@
+package database
+
+type PragmaProfile string
+
+const (
+	// PragmaProfileBulkLoad trades durability for throughput, and should only be used for (restartable) multi-hour ETL loads.
+	PragmaProfileBulkLoad PragmaProfile = "bulk_load"
+	// PragmaProfileServing is a safe profile, for long-running processes reading & occasionally writing to the database.
+	PragmaProfileServing PragmaProfile = "serving"
+)
+
+type RepositoryConfig struct {
+	DatabaseLocation string
+	PragmaProfile    PragmaProfile
+
+	// SQLite only supports a single writer, so all writes are serialized through a single connection.
+	// Reads are handled by a separate pool of (query_only) connections.
+	MaxReadConnections int
+
+	// RunID is recorded on every organization revision (and quarantined organization) written through the repository.
+	// A new run id is generated if empty. Processes that open the database more than once (eg. one repository per
+	// import pass) should generate a single run id (see GenerateRunId), and pass it to every repository.
+	RunID string
+
+	// MergePoliciesPath is a merge policy file (see models.LoadMergePolicySet), the default policies are used if empty.
+	MergePoliciesPath string
+}
+
+func DefaultRepositoryConfig() RepositoryConfig {
+	return RepositoryConfig{
+		DatabaseLocation:   "data/fasten-etl-database.db",
+		PragmaProfile:      PragmaProfileServing,
+		MaxReadConnections: 4,
+	}
+}
+
+func BulkLoadRepositoryConfig() RepositoryConfig {
+	config := DefaultRepositoryConfig()
+	config.PragmaProfile = PragmaProfileBulkLoad
+	return config
+}
+
+// Pragmas returns the pragmas that are applied to every connection opened with this profile.
+// See https://www.sqlite.org/pragma.html
+func (profile PragmaProfile) Pragmas() map[string]string {
+	pragmas := map[string]string{
+		// When a transaction cannot lock the database, because it is already locked by another one,
+		// SQLite by default throws an error: database is locked. This behavior is usually not appropriate when
+		// concurrent access is needed, typically when multiple processes write to the same database.
+		// PRAGMA busy_timeout lets you set a timeout or a handler for these events. When setting a timeout,
+		// SQLite will try the transaction multiple times within this timeout.
+		// fixes #341
+		// https://rsqlite.r-dbi.org/reference/sqlitesetbusyhandler
+		// retrying for 30000 milliseconds, 30seconds - this would be unreasonable for a distributed multi-tenant application,
+		// but should be fine for local usage.
+		"busy_timeout": "30000",
+		"foreign_keys": "ON",
+		// WAL allows readers to continue while the (single) writer is committing.
+		"journal_mode": "WAL",
+	}
+
+	switch profile {
+	case PragmaProfileBulkLoad:
+		// in WAL mode, synchronous=NORMAL is still consistent, but a power loss may roll back the last few transactions.
+		pragmas["synchronous"] = "NORMAL"
+		pragmas["cache_size"] = "-262144"   // 256MB (negative values are KiB)
+		pragmas["mmap_size"] = "1073741824" // 1GB
+		pragmas["temp_store"] = "MEMORY"
+		// checkpoint less often, the WAL is truncated by Optimize() once the load is complete.
+		pragmas["wal_autocheckpoint"] = "10000"
+	default:
+		pragmas["synchronous"] = "FULL"
+		pragmas["cache_size"] = "-16384"   // 16MB
+		pragmas["mmap_size"] = "268435456" // 256MB
+	}
+	return pragmas
+}
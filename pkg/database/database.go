@@ -1,142 +1,950 @@
 package database
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
 	"github.com/glebarez/sqlite"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
-func NewRepository(globalLogger logrus.FieldLogger) (*SqliteRepository, error) {
+func NewRepository(config RepositoryConfig, globalLogger logrus.FieldLogger) (*SqliteRepository, error) {
 	//backgroundContext := context.Background()
-	databaseLocation := "data/fasten-etl-database.db"
+	databaseLocation := config.DatabaseLocation
 
 	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 	// Gorm/SQLite setup
 	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-	globalLogger.Infof("Trying to connect to sqlite db: %s\n", databaseLocation)
-
-	// When a transaction cannot lock the database, because it is already locked by another one,
-	// SQLite by default throws an error: database is locked. This behavior is usually not appropriate when
-	// concurrent access is needed, typically when multiple processes write to the same database.
-	// PRAGMA busy_timeout lets you set a timeout or a handler for these events. When setting a timeout,
-	// SQLite will try the transaction multiple times within this timeout.
-	// fixes #341
-	// https://rsqlite.r-dbi.org/reference/sqlitesetbusyhandler
-	// retrying for 30000 milliseconds, 30seconds - this would be unreasonable for a distributed multi-tenant application,
-	// but should be fine for local usage.
-	pragmaStr := sqlitePragmaString(map[string]string{
-		"busy_timeout": "30000",
-		"foreign_keys": "ON",
-	})
-	database, err := gorm.Open(sqlite.Open(databaseLocation+pragmaStr), &gorm.Config{
-		//TODO: figure out how to log database queries again.
-		//Logger: Logger
-		DisableForeignKeyConstraintWhenMigrating: true,
-	})
+	globalLogger.Infof("Trying to connect to sqlite db: %s (%s)\n", databaseLocation, config.PragmaProfile)
 
-	if strings.ToUpper("INFO") == "DEBUG" {
-		database = database.Debug() //set debug globally
+	pragmas := config.PragmaProfile.Pragmas()
+	database, err := openDatabase(databaseLocation, pragmas)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to database! - %v", err)
 	}
-
+	writeDB, err := database.DB()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to connect to database! - %v", err)
 	}
-	globalLogger.Infof("Successfully connected to fasten sqlite db: %s\n", databaseLocation)
+	// SQLite only allows a single writer, additional connections would just wait on the busy_timeout.
+	writeDB.SetMaxOpenConns(1)
+	writeDB.SetMaxIdleConns(1)
+	writeDB.SetConnMaxLifetime(0)
 
+	runId := config.RunID
+	if runId == "" {
+		runId = GenerateRunId()
+	}
+	mergePolicies := models.DefaultMergePolicySet()
+	if config.MergePoliciesPath != "" {
+		mergePolicies, err = models.LoadMergePolicySet(config.MergePoliciesPath)
+		if err != nil {
+			writeDB.Close()
+			return nil, err
+		}
+	}
 	deviceRepo := SqliteRepository{
-		Logger:     globalLogger,
-		GormClient: database,
+		Logger:        globalLogger,
+		GormClient:    database,
+		RunID:         runId,
+		MergePolicies: mergePolicies,
 	}
 
 	//TODO: automigrate for now
 	err = deviceRepo.Migrate()
 	if err != nil {
+		deviceRepo.Close()
 		return nil, err
 	}
 
+	// the reader pool is opened after migration, so the schema (and WAL journal mode) already exist.
+	delete(pragmas, "journal_mode")
+	pragmas["query_only"] = "ON"
+	readDatabase, err := openDatabase(databaseLocation, pragmas)
+	if err != nil {
+		deviceRepo.Close()
+		return nil, fmt.Errorf("Failed to connect to database (readers)! - %v", err)
+	}
+	deviceRepo.GormReadClient = readDatabase
+	readDB, err := readDatabase.DB()
+	if err != nil {
+		deviceRepo.Close()
+		return nil, fmt.Errorf("Failed to connect to database (readers)! - %v", err)
+	}
+	readDB.SetMaxOpenConns(config.MaxReadConnections)
+	readDB.SetMaxIdleConns(config.MaxReadConnections)
+
+	globalLogger.Infof("Successfully connected to fasten sqlite db: %s\n", databaseLocation)
 	return &deviceRepo, nil
 }
 
+// NewReadOnlyRepository opens an existing database (or snapshot) read-only, eg. for dry runs & the api server. Migrations
+// are not run, so the database must already be at SchemaVersion (NewRepository migrates it). Every connection is opened
+// with mode=ro & query_only, so read-only files (eg. 0444 snapshots) can be opened.
+func NewReadOnlyRepository(config RepositoryConfig, globalLogger logrus.FieldLogger) (*SqliteRepository, error) {
+	databaseLocation := config.DatabaseLocation
+	globalLogger.Infof("Trying to connect to sqlite db (read-only): %s (%s)\n", databaseLocation, config.PragmaProfile)
+	if _, err := os.Stat(databaseLocation); err != nil {
+		return nil, fmt.Errorf("Failed to connect to database! - %v", err)
+	}
+
+	pragmas := config.PragmaProfile.Pragmas()
+	delete(pragmas, "journal_mode")
+	pragmas["query_only"] = "ON"
+	readOnlyLocation := "file:" + databaseLocation + "?mode=ro"
+
+	mergePolicies := models.DefaultMergePolicySet()
+	if config.MergePoliciesPath != "" {
+		var err error
+		mergePolicies, err = models.LoadMergePolicySet(config.MergePoliciesPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	deviceRepo := SqliteRepository{
+		Logger:        globalLogger,
+		RunID:         config.RunID,
+		MergePolicies: mergePolicies,
+	}
+	for _, connection := range []struct {
+		client         **gorm.DB
+		maxConnections int
+	}{
+		{&deviceRepo.GormClient, 1},
+		{&deviceRepo.GormReadClient, config.MaxReadConnections},
+	} {
+		database, err := openDatabase(readOnlyLocation, pragmas)
+		if err != nil {
+			deviceRepo.Close()
+			return nil, fmt.Errorf("Failed to connect to database! - %v", err)
+		}
+		*connection.client = database
+		sqlDB, err := database.DB()
+		if err != nil {
+			deviceRepo.Close()
+			return nil, fmt.Errorf("Failed to connect to database! - %v", err)
+		}
+		sqlDB.SetMaxOpenConns(connection.maxConnections)
+		sqlDB.SetMaxIdleConns(connection.maxConnections)
+	}
+
+	storedVersion, err := deviceRepo.storedSchemaVersion()
+	if err == nil && storedVersion != SchemaVersion {
+		err = fmt.Errorf("Database schema version (%d) does not match the supported schema version (%d), it must be migrated before it can be opened read-only", storedVersion, SchemaVersion)
+	}
+	if err != nil {
+		deviceRepo.Close()
+		return nil, err
+	}
+
+	globalLogger.Infof("Successfully connected to fasten sqlite db (read-only): %s\n", databaseLocation)
+	return &deviceRepo, nil
+}
+
+func openDatabase(databaseLocation string, pragmas map[string]string) (*gorm.DB, error) {
+	database, err := gorm.Open(sqlite.Open(databaseLocation+sqlitePragmaString(databaseLocation, pragmas)), &gorm.Config{
+		//TODO: figure out how to log database queries again.
+		//Logger: Logger
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ToUpper("INFO") == "DEBUG" {
+		database = database.Debug() //set debug globally
+	}
+	return database, nil
+}
+
 type SqliteRepository struct {
 	Logger logrus.FieldLogger
 
+	// GormClient is the single writer connection. It should also be used for reads within write transactions.
 	GormClient *gorm.DB
+	// GormReadClient is a pool of query_only connections
+	GormReadClient *gorm.DB
+
+	// RunID identifies all organization revisions written by this process, see RepositoryConfig.RunID
+	RunID string
+
+	// MergePolicies configures how MergeOrganization merges organizations that already exist
+	MergePolicies models.MergePolicySet
 }
 
+// SchemaVersion must be incremented whenever the schema changes in a way that is visible to database consumers
+// (see Snapshot), or that requires a data migration (see migrations).
+//
+// 2: hashed location ids, ZIP+4 extension stored separately
+// 3: organization source & parent organization fields, health systems
+// 4: organization validation findings
+// 5: identifier issuer & state, CCN/PTAN/Medicaid/CLIA/OID/state license identifier types
+// 6: organization facility type, ownership, bed count & emergency services
+// 7: related url details (kind & portal vendor)
+// 8: organization & endpoint hidden flags (curation overrides)
+// 9: provenance unique per value, source dataset & file (rather than source row)
+// 10: canonical endpoint ids & urls (see utils.CanonicalizeEndpointURL)
+// 11: state scoped & issuer scoped identifiers stored as organization attribute identifiers (not merge keys)
+// 12: canonical facility types (see models.FacilityType)
+// 13: related url details are no longer stored (see models.ClassifyRelatedUrls)
+// 14: endpoint ids preserve the path case of the endpoint url (see utils.NormalizeEndpointId)
+// 15: EINs stored as organization attribute identifiers (not merge keys)
+const SchemaVersion = 15
+
 func (sr *SqliteRepository) Migrate() error {
-	err := sr.GormClient.AutoMigrate(
+	fromVersion, err := sr.storedSchemaVersion()
+	if err != nil {
+		return err
+	}
+	err = sr.migrateSchema(fromVersion)
+	if err != nil {
+		return err
+	}
+
+	err = sr.GormClient.AutoMigrate(
 		&models.Organization{},
 		&models.Location{},
 		&models.Endpoint{},
 		&models.OrganizationIdentifier{},
+		&models.OrganizationAttributeIdentifier{},
+		&models.OrganizationRevision{},
+		&models.OrganizationProvenance{},
+		&models.DatabaseMetadata{},
+		&models.EndpointProbe{},
+		&models.OrganizationMatch{},
+		&models.ZipCode{},
+		&models.OrganizationMergeBlock{},
+		&models.HealthSystem{},
+		&models.HealthSystemMember{},
+		&models.QuarantinedOrganization{},
 	)
 	if err != nil {
 		return fmt.Errorf("Failed to automigrate! - %v", err)
 	}
+	err = sr.migrateData(fromVersion)
+	if err != nil {
+		return err
+	}
+	err = sr.SetMetadata(models.DatabaseMetadataKeySchemaVersion, strconv.Itoa(SchemaVersion))
+	if err != nil {
+		return err
+	}
+	return sr.checkNameCanonicalizationVersion(fromVersion == 0)
+}
+
+// checkNameCanonicalizationVersion warns if the stored names were canonicalized with older rules, see
+// RecomputeOrganizationNames. A new database has no names yet, so it's marked as up to date.
+func (sr *SqliteRepository) checkNameCanonicalizationVersion(newDatabase bool) error {
+	currentVersion := strconv.Itoa(utils.DefaultNameCanonicalizer.Version())
+	if newDatabase {
+		return sr.SetMetadata(models.DatabaseMetadataKeyNameCanonicalizationVersion, currentVersion)
+	}
+	storedVersion, err := sr.GetMetadata(models.DatabaseMetadataKeyNameCanonicalizationVersion)
+	if err != nil {
+		return err
+	}
+	if storedVersion != currentVersion {
+		sr.Logger.Warnf("Organization names were canonicalized with version %q (current version %s), run recompute_organization_names", storedVersion, currentVersion)
+	}
 	return nil
 }
 
+func (sr *SqliteRepository) SetMetadata(key string, value string) error {
+	return sr.GormClient.
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&models.DatabaseMetadata{Key: key, Value: value}).Error
+}
+
+// GetMetadata returns an empty string if the key has never been set.
+func (sr *SqliteRepository) GetMetadata(key string) (string, error) {
+	var metadata models.DatabaseMetadata
+	err := sr.GormClient.Limit(1).Find(&metadata, "key = ?", key).Error
+	return metadata.Value, err
+}
+
 func (sr *SqliteRepository) Close() error {
+	var closeErr error
+	for _, gormClient := range []*gorm.DB{sr.GormReadClient, sr.GormClient} {
+		if gormClient == nil {
+			continue
+		}
+		sqlDB, err := gormClient.DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("Failed to close database - %v", err)
+		}
+	}
+	return closeErr
+}
+
+// Optimize should be run after a bulk load. It updates the query planner statistics and checkpoints the WAL.
+// VACUUM rebuilds the entire database file, and may take a long time on large databases.
+func (sr *SqliteRepository) Optimize(vacuum bool) error {
+	sr.Logger.Infof("Analyzing database")
+	err := sr.GormClient.Exec("ANALYZE").Error
+	if err != nil {
+		return fmt.Errorf("Failed to analyze database - %v", err)
+	}
+	err = sr.GormClient.Exec("PRAGMA optimize").Error
+	if err != nil {
+		return fmt.Errorf("Failed to optimize database - %v", err)
+	}
+
+	if vacuum {
+		sr.Logger.Infof("Vacuuming database")
+		err = sr.GormClient.Exec("VACUUM").Error
+		if err != nil {
+			return fmt.Errorf("Failed to vacuum database - %v", err)
+		}
+	}
+
+	err = sr.GormClient.Exec("PRAGMA wal_checkpoint(TRUNCATE)").Error
+	if err != nil {
+		return fmt.Errorf("Failed to checkpoint database - %v", err)
+	}
 	return nil
 }
 
-func (sr *SqliteRepository) CreateOrganization(org *models.Organization) error {
-	return sr.GormClient.Create(org).Error
+// CreateOrganization inserts a new organization. Locations are shared between organizations, so existing locations are
+// upserted rather than causing the insert to fail. Identifiers & endpoints that already belong to another organization
+// are not linked (they are never reassigned), and are logged as association conflicts.
+func (sr *SqliteRepository) CreateOrganization(org *models.Organization, source string) error {
+	return sr.createOrganization(org, source, false)
+}
+
+// createOrganization is CreateOrganization. If failOnMergeKeyConflict is set, nothing is written if an identifier (a merge
+// key) already belongs to another organization, and the conflict is returned as the error, since the organization
+// should be merged into the owner instead.
+func (sr *SqliteRepository) createOrganization(org *models.Organization, source string, failOnMergeKeyConflict bool) error {
+	return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit(clause.Associations).Create(org).Error
+		if err != nil {
+			return err
+		}
+		conflicts, err := upsertOrganizationAssociations(tx, org)
+		if err != nil {
+			return err
+		}
+		if failOnMergeKeyConflict {
+			for _, conflict := range conflicts {
+				if conflict.FieldType != models.ProvenanceFieldTypeEndpoint {
+					return conflict
+				}
+			}
+		}
+		sr.logAssociationConflicts(conflicts)
+
+		var written models.Organization
+		err = preloadOrganization(tx).First(&written, "id = ?", org.ID).Error
+		if err != nil {
+			return err
+		}
+		return sr.createOrganizationRevision(tx, nil, &written, source, "")
+	})
 }
 
 func (sr *SqliteRepository) FindOrganizationById(orgId string) (*models.Organization, error) {
 	var org models.Organization
-	err := sr.GormClient.First(&org, "id = ?", orgId).Error
+	err := sr.GormReadClient.First(&org, "id = ?", orgId).Error
 	if err != nil {
 		return nil, err
 	}
 	return &org, nil
 }
 
+// ErrOrganizationNotFound is returned (wrapped) by FindOrganizationByIdentifiers if none of the identifiers belong to an
+// organization.
+var ErrOrganizationNotFound = errors.New("organization not found")
+
+// FindOrganizationByIdentifiers returns the organization that owns the first identifier (in order) that belongs to an
+// organization, skipping organizations that the identifiers are blocked from (see OrganizationMergeBlock).
+// Identifiers that are not merge keys (see models.IsMergeKeyIdentifierType) are ignored.
+// Returns ErrOrganizationNotFound if no organization is found.
 func (sr *SqliteRepository) FindOrganizationByIdentifiers(identifiers []models.OrganizationIdentifier) (*models.Organization, error) {
 
-	var orgIdentifier models.OrganizationIdentifier
 	for _, identifier := range identifiers {
-		err := sr.GormClient.Preload("Organization").
+		if !models.IsMergeKeyIdentifierType(identifier.IdentifierType) {
+			continue
+		}
+		var orgIdentifier models.OrganizationIdentifier
+		err := sr.GormReadClient.Preload("Organization").
 			Preload("Organization.Locations").
 			Preload("Organization.Endpoints").
 			Preload("Organization.OrganizationIdentifiers").
+			Preload("Organization.AttributeIdentifiers").
+			Preload("Organization.Provenance").
 			Where(models.OrganizationIdentifier{IdentifierType: identifier.IdentifierType, IdentifierValue: identifier.IdentifierValue}).
-			First(&orgIdentifier).Error
+			Limit(1).
+			Find(&orgIdentifier).Error
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find organization by identifier (%s) - %v", identifier.IdentifierValue, err)
+		} else if orgIdentifier.OrganizationID == "" || orgIdentifier.Organization == nil {
+			continue
+		}
 
-		if err == nil {
-			break
+		blocked, err := sr.organizationMergeBlocked(orgIdentifier.OrganizationID, &identifier, identifiers)
+		if err != nil {
+			return nil, err
+		} else if blocked {
+			continue
 		}
+		return orgIdentifier.Organization, nil
 	}
 
-	if orgIdentifier.OrganizationID != "" {
-		return orgIdentifier.Organization, nil
+	return nil, fmt.Errorf("No organization found for identifiers: %v - %w", identifiers, ErrOrganizationNotFound)
+}
+
+// FindOrganizationByNPI returns the organization that owns the NPI (as its primary NPI, or as one of its NPIs), with all
+// associations preloaded. Organizations are not always keyed by their NPI (eg. merged & vendor organizations), so the
+// NPI is resolved through the NPI identifiers, not the organization id.
+// Returns ErrOrganizationNotFound if no organization owns the NPI.
+func (sr *SqliteRepository) FindOrganizationByNPI(npi string) (*models.Organization, error) {
+	orgId, err := sr.FindIdentifierOwner(models.OrganizationIdentifier{IdentifierType: models.OrganizationIdentifierTypePrimaryNPI, IdentifierValue: npi})
+	if err == nil && orgId == "" {
+		orgId, err = sr.FindIdentifierOwner(models.OrganizationIdentifier{IdentifierType: models.OrganizationIdentifierTypeNPI, IdentifierValue: npi})
+	}
+	if err != nil {
+		return nil, err
+	} else if orgId == "" {
+		return nil, fmt.Errorf("No organization found for NPI (%s) - %w", npi, ErrOrganizationNotFound)
+	}
+	var org models.Organization
+	err = preloadOrganization(sr.GormReadClient).First(&org, "id = ?", orgId).Error
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find organization (%s) for NPI (%s) - %v", orgId, npi, err)
 	}
+	return &org, nil
+}
+
+// FindIdentifierOwner returns the id of the organization that owns the (merge key) identifier, or "" if the identifier
+// does not belong to any organization. Unlike FindOrganizationByIdentifiers, merge blocks are not considered.
+func (sr *SqliteRepository) FindIdentifierOwner(identifier models.OrganizationIdentifier) (string, error) {
+	var owner models.OrganizationIdentifier
+	err := sr.GormReadClient.Select("organization_id").
+		Where("identifier_type = ? AND identifier_value = ?", identifier.IdentifierType, identifier.IdentifierValue).
+		Limit(1).Find(&owner).Error
+	if err != nil {
+		return "", fmt.Errorf("Failed to find organization identifier (%s: %s) - %v", identifier.IdentifierType, identifier.IdentifierValue, err)
+	}
+	return owner.OrganizationID, nil
+}
+
+// FindOrganizationsInBatches iterates over every organization (ordered by id), with all associations preloaded.
+func (sr *SqliteRepository) FindOrganizationsInBatches(batchSize int, callback func(orgs []models.Organization) error) error {
+	var orgs []models.Organization
+	return preloadOrganization(sr.GormReadClient).
+		FindInBatches(&orgs, batchSize, func(tx *gorm.DB, batch int) error {
+			return callback(orgs)
+		}).Error
+}
 
-	return nil, fmt.Errorf("No organization found for identifiers: %v", identifiers)
+// FindOrganizationsWithEndpointsInBatches iterates over every organization that has at least one endpoint (ordered by id),
+// with all associations preloaded.
+func (sr *SqliteRepository) FindOrganizationsWithEndpointsInBatches(batchSize int, callback func(orgs []models.Organization) error) error {
+	var orgs []models.Organization
+	return preloadOrganization(sr.GormReadClient).
+		Where("id IN (SELECT organization_id FROM endpoints WHERE deleted_at IS NULL)").
+		FindInBatches(&orgs, batchSize, func(tx *gorm.DB, batch int) error {
+			return callback(orgs)
+		}).Error
+}
+
+// FindEndpointsInBatches iterates over every endpoint (ordered by id)
+func (sr *SqliteRepository) FindEndpointsInBatches(batchSize int, callback func(endpoints []models.Endpoint) error) error {
+	var endpoints []models.Endpoint
+	return sr.GormReadClient.
+		FindInBatches(&endpoints, batchSize, func(tx *gorm.DB, batch int) error {
+			return callback(endpoints)
+		}).Error
+}
+
+func (sr *SqliteRepository) CreateEndpointProbe(probe *models.EndpointProbe) error {
+	return sr.GormClient.Create(probe).Error
+}
+
+// ListEndpointProbes returns the status history of an endpoint, newest first.
+func (sr *SqliteRepository) ListEndpointProbes(endpointId string) ([]models.EndpointProbe, error) {
+	var probes []models.EndpointProbe
+	err := sr.GormReadClient.
+		Where(models.EndpointProbe{EndpointID: endpointId}).
+		Order("id desc").
+		Find(&probes).Error
+	return probes, err
 }
 
 func (sr *SqliteRepository) UpdateOrganization(org *models.Organization) error {
 	return sr.GormClient.Updates(org).Error
 }
 
+// MergeOrganization is the shared create-or-merge path used by every importer.
+// An optimistic insert is attempted first. If it fails (the id exists, or one of its merge key identifiers belongs to
+// another organization), the organization may already exist, so it is looked up by its identifiers, merged into the
+// existing organization and upserted.
+// Fields are merged using sr.MergePolicies. Returns the persisted organization, and the merge result (nil if the
+// organization was created).
+func (sr *SqliteRepository) MergeOrganization(org *models.Organization, source string) (*models.Organization, *models.MergeResult, error) {
+	if org.Source == "" {
+		org.Source = source
+	}
+
+	//organizations that were linked to another organization (see LinkOrganizations) are merged into it, not re-created
+	linkedOrg, err := sr.findLinkedOrganization(org)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//Optomistic Insert.
+	//Attempt to creat the organization, if it fails (the id or one of its merge keys exists), then we need to update it.
+	var createErr error
+	if linkedOrg == nil {
+		createErr = sr.createOrganization(org, source, true)
+		if createErr == nil {
+			return org, nil, nil
+		}
+	}
+
+	//organization may already exist
+	foundOrg, result, err := sr.mergeExistingOrganization(org)
+	if err != nil {
+		return nil, nil, err
+	} else if foundOrg == nil {
+		//the merge keys only belong to organizations they are blocked from (see UnmergeOrganization), so it is created
+		//without them
+		var conflict AssociationConflict
+		if createErr == nil || errors.As(createErr, &conflict) {
+			err = sr.createOrganization(org, source, false)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Failed to create organization (%s) - %v", org.ID, err)
+			}
+			return org, nil, nil
+		}
+		return nil, nil, fmt.Errorf("Failed to create organization (%s) - %v", org.ID, createErr)
+	}
+
+	//check if they are exact matches.
+	if !result.HasChanges() {
+		return foundOrg, result, nil
+	}
+	updatedOrg, err := sr.upsertOrganization(foundOrg, source, org.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	sr.Logger.Debugf("Updated Organization %s from %s", updatedOrg.ID, source)
+	return updatedOrg, result, nil
+}
+
+// PlanMergeOrganization is a dry run of MergeOrganization, nothing is written.
+// Returns the existing organization (with the merge applied in memory) and the merge result, or nil for both if the
+// organization would be created.
+func (sr *SqliteRepository) PlanMergeOrganization(org *models.Organization, source string) (*models.Organization, *models.MergeResult, error) {
+	if org.Source == "" {
+		org.Source = source
+	}
+	return sr.mergeExistingOrganization(org)
+}
+
+// mergeExistingOrganization finds the existing organization (by id, then the organization it was linked to, then by
+// identifiers), and merges the organization into it (in memory). Returns nil if there is no existing organization.
+func (sr *SqliteRepository) mergeExistingOrganization(org *models.Organization) (*models.Organization, *models.MergeResult, error) {
+	var foundOrg *models.Organization
+	var existingOrg models.Organization
+	err := preloadOrganization(sr.GormReadClient).Limit(1).Find(&existingOrg, "id = ?", org.ID).Error
+	if err != nil {
+		return nil, nil, err
+	} else if existingOrg.ID != "" {
+		foundOrg = &existingOrg
+	} else if foundOrg, err = sr.findLinkedOrganization(org); err != nil {
+		return nil, nil, err
+	} else if foundOrg == nil {
+		foundOrg, err = sr.FindOrganizationByIdentifiers(org.OrganizationIdentifiers)
+		if errors.Is(err, ErrOrganizationNotFound) {
+			return nil, nil, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	//only organizations can have multiple identifiers, so if we find an individual or sole practitioner, we should skip (we cant process this)
+	if foundOrg.OrganizationType == models.OrganizationTypeTypeIndividual {
+		return foundOrg, &models.MergeResult{}, nil
+	}
+
+	result, err := foundOrg.Merge(org, sr.MergePolicies)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to merge organization (%s) - %v", foundOrg.ID, err)
+	}
+	return foundOrg, result, nil
+}
+
+// UpsertOrganization persists the organization and all of its associations (Locations, Endpoints and
+// OrganizationIdentifiers) in a single transaction.
+// Existing associations are left untouched, new associations are added without duplicating existing rows.
+// Locations & Endpoints that are no longer associated with the organization (eg. replaced by a merge policy) are removed.
+// The organization is re-read from the database after writing, so the returned record is exactly what was persisted.
+func (sr *SqliteRepository) UpsertOrganization(org *models.Organization, source string) (*models.Organization, error) {
+	return sr.upsertOrganization(org, source, "")
+}
+
+// upsertOrganization is UpsertOrganization, recording the id of the organization that was merged into org (if any)
+func (sr *SqliteRepository) upsertOrganization(org *models.Organization, source string, mergedOrgId string) (*models.Organization, error) {
+	var written models.Organization
+	err := sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		var existing *models.Organization
+		var existingOrg models.Organization
+		err := preloadOrganization(tx).Limit(1).Find(&existingOrg, "id = ?", org.ID).Error
+		if err != nil {
+			return err
+		} else if existingOrg.ID != "" {
+			existing = &existingOrg
+		}
+
+		err = tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(org).Error
+		if err != nil {
+			return fmt.Errorf("Failed to upsert organization (%s) - %v", org.ID, err)
+		}
+
+		conflicts, err := upsertOrganizationAssociations(tx, org)
+		if err != nil {
+			return err
+		}
+		sr.logAssociationConflicts(conflicts)
+		if existing != nil {
+			err = removeOrganizationAssociations(tx, existing, org)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = preloadOrganization(tx).First(&written, "id = ?", org.ID).Error
+		if err != nil {
+			return err
+		}
+		return sr.createOrganizationRevision(tx, existing, &written, source, mergedOrgId)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &written, nil
+}
+
+// FindOrganizationProvenance returns all provenance entries matching the non-zero fields of the query,
+// eg. every taxonomy sourced from a specific NPPES file.
+func (sr *SqliteRepository) FindOrganizationProvenance(query models.OrganizationProvenance) ([]models.OrganizationProvenance, error) {
+	var provenance []models.OrganizationProvenance
+	err := sr.GormReadClient.
+		Where(query).
+		Order("organization_id asc, field_type asc, field_key asc, id asc").
+		Find(&provenance).Error
+	return provenance, err
+}
+
+// ListOrganizationRevisions returns the full revision history of an organization, oldest first.
+func (sr *SqliteRepository) ListOrganizationRevisions(orgId string) ([]models.OrganizationRevision, error) {
+	var revisions []models.OrganizationRevision
+	err := sr.GormReadClient.
+		Where(models.OrganizationRevision{OrganizationID: orgId}).
+		Order("id asc").
+		Find(&revisions).Error
+	return revisions, err
+}
+
+// FindOrganizationAtRevision reconstructs the organization as it existed immediately after the specified revision,
+// by replaying every revision up to (and including) it.
+func (sr *SqliteRepository) FindOrganizationAtRevision(orgId string, revisionId uint) (*models.Organization, error) {
+	var revisions []models.OrganizationRevision
+	err := sr.GormReadClient.
+		Where(models.OrganizationRevision{OrganizationID: orgId}).
+		Where("id <= ?", revisionId).
+		Order("id asc").
+		Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(revisions) == 0 || revisions[len(revisions)-1].ID != revisionId {
+		return nil, fmt.Errorf("No revision %d found for organization: %s", revisionId, orgId)
+	}
+
+	org := models.Organization{ID: orgId}
+	for _, revision := range revisions {
+		err = org.ApplyDiff(revision.Diff)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to apply revision %d to organization (%s) - %v", revision.ID, orgId, err)
+		}
+		if revision.Action == models.OrganizationRevisionActionCreate {
+			org.CreatedAt = revision.CreatedAt
+		}
+		org.UpdatedAt = revision.CreatedAt
+	}
+	return &org, nil
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // Utilities
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 
-func sqlitePragmaString(pragmas map[string]string) string {
+// createOrganizationRevision records the difference between the existing (nil for new organizations) and written organization.
+// mergedOrgId is the id of the organization that was merged into the written organization (if any).
+// No revision is recorded if nothing changed.
+func (sr *SqliteRepository) createOrganizationRevision(tx *gorm.DB, existing *models.Organization, written *models.Organization, source string, mergedOrgId string) error {
+	action := models.OrganizationRevisionActionMerge
+	if existing == nil {
+		action = models.OrganizationRevisionActionCreate
+	}
+	return sr.recordOrganizationRevision(tx, action, existing, written, source, mergedOrgId)
+}
+
+// recordOrganizationRevision is createOrganizationRevision, with an explicit action.
+// relatedOrgId is the organization merged into (or split from) the written organization.
+func (sr *SqliteRepository) recordOrganizationRevision(tx *gorm.DB, action models.OrganizationRevisionAction, existing *models.Organization, written *models.Organization, source string, relatedOrgId string) error {
+	diff, err := models.DiffOrganizations(existing, written)
+	if err != nil {
+		return fmt.Errorf("Failed to diff organization (%s) - %v", written.ID, err)
+	}
+	if existing != nil && diff.IsEmpty() {
+		return nil
+	}
+	if relatedOrgId == written.ID {
+		relatedOrgId = ""
+	}
+
+	return tx.Create(&models.OrganizationRevision{
+		OrganizationID:        written.ID,
+		RunID:                 sr.RunID,
+		Source:                source,
+		RelatedOrganizationID: relatedOrgId,
+		Action:                action,
+		Diff:                  diff,
+	}).Error
+}
+
+func preloadOrganization(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Locations").
+		Preload("Endpoints").
+		Preload("OrganizationIdentifiers").
+		Preload("AttributeIdentifiers").
+		Preload("Provenance")
+}
+
+// AssociationConflict is an identifier or endpoint that was not linked to an organization, because it already belongs to
+// another organization. Identifiers & endpoints are unique, they are never taken away from the organization that owns them.
+type AssociationConflict struct {
+	OrganizationID      string
+	OwnerOrganizationID string
+	FieldType           models.ProvenanceFieldType // identifier, name or endpoint
+	FieldKey            string                     // the provenance key, see models.IdentifierProvenanceKey
+}
+
+func (conflict AssociationConflict) Error() string {
+	return fmt.Sprintf("%s (%s) of organization (%s) already belongs to organization (%s)", conflict.FieldType, conflict.FieldKey, conflict.OrganizationID, conflict.OwnerOrganizationID)
+}
+
+func (sr *SqliteRepository) logAssociationConflicts(conflicts []AssociationConflict) {
+	for _, conflict := range conflicts {
+		sr.Logger.Warnf("Association conflict, not linked: %s", conflict.Error())
+	}
+}
+
+// upsertOrganizationAssociations inserts any associations that do not exist yet, and links them to the organization.
+// Rows that already exist (shared locations, existing join rows, endpoints & identifiers) are not modified, except for
+// the source row & release date of existing provenance entries.
+// Identifiers & endpoints that belong to another organization are returned as conflicts, and their provenance is skipped.
+// Attribute identifiers are unique per organization, so they never conflict.
+func upsertOrganizationAssociations(tx *gorm.DB, org *models.Organization) ([]AssociationConflict, error) {
+	err := upsertOrganizationLocations(tx, org)
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []AssociationConflict
+	conflictKeys := map[string]bool{}
+	addConflict := func(fieldType models.ProvenanceFieldType, fieldKey string, ownerOrgId string) {
+		conflicts = append(conflicts, AssociationConflict{OrganizationID: org.ID, OwnerOrganizationID: ownerOrgId, FieldType: fieldType, FieldKey: fieldKey})
+		conflictKeys[string(fieldType)+"|"+fieldKey] = true
+	}
+
+	for ndx := range org.Endpoints {
+		end := &org.Endpoints[ndx]
+		end.OrganizationID = org.ID
+		result := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(end)
+		if result.Error != nil {
+			return nil, fmt.Errorf("Failed to upsert endpoint (%s) - %v", end.URL, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			continue
+		}
+		var owner models.Endpoint
+		err = tx.Select("id", "organization_id").Where("id = ? OR url = ?", end.ID, end.URL).Limit(1).Find(&owner).Error
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find endpoint (%s) - %v", end.URL, err)
+		}
+		if owner.ID != "" && owner.OrganizationID != org.ID {
+			addConflict(models.ProvenanceFieldTypeEndpoint, end.ID, owner.OrganizationID)
+		}
+	}
+
+	for ndx := range org.OrganizationIdentifiers {
+		identifier := &org.OrganizationIdentifiers[ndx]
+		identifier.OrganizationID = org.ID
+		result := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(identifier)
+		if result.Error != nil {
+			return nil, fmt.Errorf("Failed to upsert organization identifier (%s: %s) - %v", identifier.IdentifierType, identifier.IdentifierValue, result.Error)
+		}
+		if result.RowsAffected > 0 {
+			continue
+		}
+		var owner models.OrganizationIdentifier
+		err = tx.Select("organization_id").
+			Where("identifier_type = ? AND identifier_value = ?", identifier.IdentifierType, identifier.IdentifierValue).
+			Limit(1).Find(&owner).Error
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find organization identifier (%s: %s) - %v", identifier.IdentifierType, identifier.IdentifierValue, err)
+		}
+		if owner.OrganizationID != "" && owner.OrganizationID != org.ID {
+			if identifier.IdentifierType == models.OrganizationIdentifierTypeName {
+				addConflict(models.ProvenanceFieldTypeName, identifier.IdentifierValue, owner.OrganizationID)
+			} else {
+				addConflict(models.ProvenanceFieldTypeIdentifier, models.IdentifierProvenanceKey(identifier), owner.OrganizationID)
+			}
+		}
+	}
+
+	for ndx := range org.AttributeIdentifiers {
+		attr := &org.AttributeIdentifiers[ndx]
+		attr.OrganizationID = org.ID
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(attr).Error
+		if err != nil {
+			return nil, fmt.Errorf("Failed to upsert organization attribute identifier (%s: %s) - %v", attr.IdentifierType, attr.IdentifierValue, err)
+		}
+	}
+
+	for ndx := range org.Provenance {
+		org.Provenance[ndx].OrganizationID = org.ID
+		if conflictKeys[string(org.Provenance[ndx].FieldType)+"|"+org.Provenance[ndx].FieldKey] {
+			continue
+		}
+		// existing entries (with an id) are matched by their unique key, so the row & release date can be updated in place
+		provenance := org.Provenance[ndx]
+		provenance.ID = 0
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "organization_id"}, {Name: "field_type"}, {Name: "field_key"}, {Name: "source_dataset"}, {Name: "source_file"}},
+			DoUpdates: clause.AssignmentColumns([]string{"source_row", "release_date"}),
+		}).Create(&provenance).Error
+		if err != nil {
+			return nil, fmt.Errorf("Failed to upsert organization provenance (%s: %s) - %v", org.Provenance[ndx].FieldType, org.Provenance[ndx].FieldKey, err)
+		}
+	}
+	return conflicts, nil
+}
+
+// removeOrganizationAssociations unlinks locations & deletes endpoints that were associated with the existing organization,
+// but are missing from the updated organization, along with their provenance.
+// Locations are shared between organizations, so only the join rows are removed.
+func removeOrganizationAssociations(tx *gorm.DB, existing *models.Organization, org *models.Organization) error {
+	locationIds := map[string]bool{}
+	for ndx := range org.Locations {
+		locationIds[org.Locations[ndx].ID] = true
+	}
+	for _, loc := range existing.Locations {
+		if locationIds[loc.ID] {
+			continue
+		}
+		err := tx.Exec("DELETE FROM org_locations WHERE organization_id = ? AND location_id = ?", org.ID, loc.ID).Error
+		if err == nil {
+			err = tx.Where(models.OrganizationProvenance{OrganizationID: org.ID, FieldType: models.ProvenanceFieldTypeLocation, FieldKey: loc.ID}).
+				Delete(&models.OrganizationProvenance{}).Error
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to remove location (%s) from organization (%s) - %v", loc.ID, org.ID, err)
+		}
+	}
+
+	endpointIds := map[string]bool{}
+	for ndx := range org.Endpoints {
+		endpointIds[org.Endpoints[ndx].ID] = true
+	}
+	for _, end := range existing.Endpoints {
+		if endpointIds[end.ID] {
+			continue
+		}
+		err := tx.Where("id = ? AND organization_id = ?", end.ID, org.ID).Delete(&models.Endpoint{}).Error
+		if err == nil {
+			err = tx.Where(models.OrganizationProvenance{OrganizationID: org.ID, FieldType: models.ProvenanceFieldTypeEndpoint, FieldKey: end.ID}).
+				Delete(&models.OrganizationProvenance{}).Error
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to remove endpoint (%s) from organization (%s) - %v", end.URL, org.ID, err)
+		}
+	}
+	return nil
+}
+
+// upsertOrganizationLocations inserts locations that do not exist yet, and links every location to the organization.
+// Existing (shared) locations are only updated to add a missing ZIP+4 extension.
+func upsertOrganizationLocations(tx *gorm.DB, org *models.Organization) error {
+	for ndx := range org.Locations {
+		err := tx.Omit(clause.Associations).
+			Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "id"}},
+				DoUpdates: clause.Set{
+					{Column: clause.Column{Name: "postal_code_extension"}, Value: gorm.Expr("CASE WHEN locations.postal_code_extension = '' OR locations.postal_code_extension IS NULL THEN excluded.postal_code_extension ELSE locations.postal_code_extension END")},
+				},
+			}).
+			Create(&org.Locations[ndx]).Error
+		if err != nil {
+			return fmt.Errorf("Failed to upsert location (%v) - %v", org.Locations[ndx].Line, err)
+		}
+
+		err = tx.Table("org_locations").
+			Clauses(clause.OnConflict{DoNothing: true}).
+			Create(map[string]interface{}{
+				"organization_id": org.ID,
+				"location_id":     org.Locations[ndx].ID,
+			}).Error
+		if err != nil {
+			return fmt.Errorf("Failed to link location (%s) to organization (%s) - %v", org.Locations[ndx].ID, org.ID, err)
+		}
+	}
+	return nil
+}
+
+// GenerateRunId returns a unique, sortable identifier for a run, eg. 20221001T120000Z-1a2b3c4d
+func GenerateRunId() string {
+	randomBytes := make([]byte, 4)
+	_, _ = rand.Read(randomBytes)
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102T150405Z"), hex.EncodeToString(randomBytes))
+}
+
+// sqlitePragmaString returns the pragmas as DSN query parameters, appended to any parameters already in the location
+// (eg. mode=ro).
+func sqlitePragmaString(databaseLocation string, pragmas map[string]string) string {
 	q := url.Values{}
 	for key, val := range pragmas {
 		q.Add("_pragma", key+"="+val)
 	}
 
 	queryStr := q.Encode()
-	if len(queryStr) > 0 {
-		return "?" + queryStr
+	if len(queryStr) == 0 {
+		return ""
+	} else if strings.Contains(databaseLocation, "?") {
+		return "&" + queryStr
 	}
-	return ""
+	return "?" + queryStr
 }
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"gorm.io/gorm"
+)
+
+// FindOrganizationClusterSignalsInBatches iterates over every organization (ordered by id), with only the fields used to
+// cluster health systems loaded: name, type, parent organization fields, EIN (attribute) identifiers & locations.
+func (sr *SqliteRepository) FindOrganizationClusterSignalsInBatches(batchSize int, callback func(orgs []models.Organization) error) error {
+	var orgs []models.Organization
+	return sr.GormReadClient.
+		Select("id", "name", "organization_type", "parent_organization_lbn", "parent_organization_tin").
+		Preload("AttributeIdentifiers", "identifier_type = ?", models.OrganizationIdentifierTypeEIN).
+		Preload("Locations").
+		FindInBatches(&orgs, batchSize, func(tx *gorm.DB, batch int) error {
+			return callback(orgs)
+		}).Error
+}
+
+// ReplaceHealthSystems replaces every health system (and member) with the results of a clustering run
+func (sr *SqliteRepository) ReplaceHealthSystems(systems []models.HealthSystem) error {
+	return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&models.HealthSystemMember{}).Error
+		if err == nil {
+			err = tx.Where("1 = 1").Delete(&models.HealthSystem{}).Error
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to remove health systems - %v", err)
+		}
+		for ndx := range systems {
+			systems[ndx].RunID = sr.RunID
+		}
+		if len(systems) == 0 {
+			return nil
+		}
+		err = tx.CreateInBatches(systems, 500).Error
+		if err != nil {
+			return fmt.Errorf("Failed to create health systems - %v", err)
+		}
+		return nil
+	})
+}
+
+// ListHealthSystems returns health systems with at least minMembers members, largest first. Members are not loaded.
+func (sr *SqliteRepository) ListHealthSystems(minMembers int, limit int) ([]models.HealthSystem, error) {
+	var systems []models.HealthSystem
+	query := sr.GormReadClient.
+		Where("member_count >= ?", minMembers).
+		Order("member_count desc, id asc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&systems).Error
+	return systems, err
+}
+
+// FindHealthSystemById returns the health system, with its members
+func (sr *SqliteRepository) FindHealthSystemById(systemId string) (*models.HealthSystem, error) {
+	var system models.HealthSystem
+	err := sr.GormReadClient.
+		Preload("Members", func(db *gorm.DB) *gorm.DB { return db.Order("organization_id asc") }).
+		First(&system, "id = ?", systemId).Error
+	if err != nil {
+		return nil, err
+	}
+	return &system, nil
+}
+
+// FindHealthSystemByOrganizationId returns the health system the organization belongs to, with its members
+func (sr *SqliteRepository) FindHealthSystemByOrganizationId(orgId string) (*models.HealthSystem, error) {
+	var member models.HealthSystemMember
+	err := sr.GormReadClient.First(&member, "organization_id = ?", orgId).Error
+	if err != nil {
+		return nil, err
+	}
+	return sr.FindHealthSystemById(member.HealthSystemID)
+}
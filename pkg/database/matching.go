@@ -0,0 +1,259 @@
+package database
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// FindUnlinkedOrganizations returns every organization with endpoints, but without an NPI.
+// These are typically organizations imported from vendor endpoint directories, which must be matched to NPPES organizations.
+func (sr *SqliteRepository) FindUnlinkedOrganizations() ([]models.Organization, error) {
+	var orgs []models.Organization
+	err := preloadOrganization(sr.GormReadClient).
+		Where("EXISTS (SELECT 1 FROM endpoints WHERE endpoints.organization_id = organizations.id)").
+		Where("NOT EXISTS (SELECT 1 FROM organization_identifiers WHERE organization_identifiers.organization_id = organizations.id AND organization_identifiers.identifier_type IN ?)",
+			[]models.OrganizationIdentifierType{models.OrganizationIdentifierTypeNPI, models.OrganizationIdentifierTypePrimaryNPI}).
+		Order("id asc").
+		Find(&orgs).Error
+	return orgs, err
+}
+
+// findLinkedOrganization returns the organization that an (unlinked) organization was linked to by an accepted or
+// auto linked match, so that re-imported vendor organizations are merged into it rather than created again.
+// Returns nil if the organization has an NPI, was never linked, or the link was since blocked (see UnmergeOrganization).
+func (sr *SqliteRepository) findLinkedOrganization(org *models.Organization) (*models.Organization, error) {
+	for _, identifier := range org.OrganizationIdentifiers {
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeNPI || identifier.IdentifierType == models.OrganizationIdentifierTypePrimaryNPI {
+			return nil, nil
+		}
+	}
+	var match models.OrganizationMatch
+	err := sr.GormReadClient.
+		Where("source_organization_id = ? AND status IN ?", org.ID, []models.OrganizationMatchStatus{models.OrganizationMatchStatusAccepted, models.OrganizationMatchStatusAutoLinked}).
+		Order("id desc").
+		Limit(1).
+		Find(&match).Error
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find organization match (%s) - %v", org.ID, err)
+	} else if match.ID == 0 {
+		return nil, nil
+	}
+
+	var linkedOrg models.Organization
+	err = preloadOrganization(sr.GormReadClient).Limit(1).Find(&linkedOrg, "id = ?", match.CandidateOrganizationID).Error
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find linked organization (%s) - %v", match.CandidateOrganizationID, err)
+	} else if linkedOrg.ID == "" {
+		return nil, nil
+	}
+	blocked, err := sr.IsOrganizationMergeBlocked(org, &linkedOrg)
+	if err != nil || blocked {
+		return nil, err
+	}
+	return &linkedOrg, nil
+}
+
+// FindOrganizationNamesInBatches iterates over every organization (ordered by id), with only the name, type & name
+// identifiers (aliases) loaded. Used to build in-memory name indexes.
+func (sr *SqliteRepository) FindOrganizationNamesInBatches(batchSize int, callback func(orgs []models.Organization) error) error {
+	var orgs []models.Organization
+	return sr.GormReadClient.
+		Select("id", "name", "organization_type").
+		Preload("OrganizationIdentifiers", "identifier_type = ?", models.OrganizationIdentifierTypeName).
+		FindInBatches(&orgs, batchSize, func(tx *gorm.DB, batch int) error {
+			return callback(orgs)
+		}).Error
+}
+
+// FindOrganizationsByIds returns the organizations (ordered by id), with all associations preloaded.
+// Missing organizations are ignored.
+func (sr *SqliteRepository) FindOrganizationsByIds(orgIds []string) ([]models.Organization, error) {
+	if len(orgIds) == 0 {
+		return nil, nil
+	}
+	var orgs []models.Organization
+	err := preloadOrganization(sr.GormReadClient).
+		Where("id IN ?", orgIds).
+		Order("id asc").
+		Find(&orgs).Error
+	return orgs, err
+}
+
+// FindOrganizationsByLocationId returns the organizations at a location (ordered by id), with all associations preloaded.
+func (sr *SqliteRepository) FindOrganizationsByLocationId(locationId string) ([]models.Organization, error) {
+	var orgs []models.Organization
+	err := preloadOrganization(sr.GormReadClient).
+		Where("id IN (?)", sr.GormReadClient.Table("org_locations").Select("organization_id").Where("location_id = ?", locationId)).
+		Order("id asc").
+		Find(&orgs).Error
+	return orgs, err
+}
+
+// FindOrganizationsByAttributeIdentifier returns the organizations with any of the (attribute) identifier values (ordered
+// by id), with all associations preloaded. Attribute identifiers are not unique, so several organizations may be returned.
+func (sr *SqliteRepository) FindOrganizationsByAttributeIdentifier(identifierType models.OrganizationIdentifierType, identifierValues []string) ([]models.Organization, error) {
+	var orgs []models.Organization
+	err := preloadOrganization(sr.GormReadClient).
+		Where("id IN (?)", sr.GormReadClient.Model(&models.OrganizationAttributeIdentifier{}).Select("organization_id").Where("identifier_type = ? AND identifier_value IN ?", identifierType, identifierValues)).
+		Order("id asc").
+		Find(&orgs).Error
+	return orgs, err
+}
+
+// SaveOrganizationMatch records a candidate match. If the match already exists, its score is updated but its status is
+// only changed while it is still pending, so review decisions survive re-runs.
+func (sr *SqliteRepository) SaveOrganizationMatch(match *models.OrganizationMatch) error {
+	return sr.GormClient.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "source_organization_id"}, {Name: "candidate_organization_id"}},
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "updated_at"}, Value: gorm.Expr("excluded.updated_at")},
+			{Column: clause.Column{Name: "source_organization_name"}, Value: gorm.Expr("excluded.source_organization_name")},
+			{Column: clause.Column{Name: "score"}, Value: gorm.Expr("excluded.score")},
+			{Column: clause.Column{Name: "reasons"}, Value: gorm.Expr("excluded.reasons")},
+			{Column: clause.Column{Name: "status"}, Value: gorm.Expr("CASE WHEN organization_matches.status = ? THEN excluded.status ELSE organization_matches.status END", models.OrganizationMatchStatusPending)},
+		},
+	}).Create(match).Error
+}
+
+// ListOrganizationMatches returns all matches for the source organization (or every source organization if empty) with
+// the specified status (or any status if empty), best score first.
+func (sr *SqliteRepository) ListOrganizationMatches(sourceOrgId string, status models.OrganizationMatchStatus) ([]models.OrganizationMatch, error) {
+	var matches []models.OrganizationMatch
+	err := sr.GormReadClient.
+		Where(models.OrganizationMatch{SourceOrganizationID: sourceOrgId, Status: status}).
+		Order("source_organization_id asc, score desc, id asc").
+		Find(&matches).Error
+	return matches, err
+}
+
+// ReviewOrganizationMatch records a review decision. Accepting a match links the organizations, and rejects every other
+// candidate for the same source organization.
+func (sr *SqliteRepository) ReviewOrganizationMatch(matchId uint, status models.OrganizationMatchStatus) (*models.OrganizationMatch, error) {
+	if status != models.OrganizationMatchStatusAccepted && status != models.OrganizationMatchStatusRejected {
+		return nil, fmt.Errorf("Invalid review status: %s", status)
+	}
+
+	var match models.OrganizationMatch
+	err := sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&match, "id = ?", matchId).Error
+		if err != nil {
+			return err
+		}
+		reviewedAt := time.Now()
+		match.Status = status
+		match.ReviewedAt = &reviewedAt
+		err = tx.Save(&match).Error
+		if err != nil {
+			return err
+		}
+		if status != models.OrganizationMatchStatusAccepted {
+			return nil
+		}
+
+		err = tx.Model(&models.OrganizationMatch{}).
+			Where("source_organization_id = ? AND id <> ? AND status = ?", match.SourceOrganizationID, match.ID, models.OrganizationMatchStatusPending).
+			Updates(map[string]interface{}{"status": models.OrganizationMatchStatusRejected, "reviewed_at": reviewedAt}).Error
+		if err != nil {
+			return err
+		}
+		return sr.linkOrganizations(tx, match.SourceOrganizationID, match.CandidateOrganizationID, models.SourceMatching)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &match, nil
+}
+
+// LinkOrganizations merges the source organization into the target organization. The source organization's endpoints,
+// identifiers (including names), locations & provenance are moved to the target, and the source organization is deleted.
+// A link revision is recorded for the deleted source organization, and a merge revision for the target.
+// Linking an organization that no longer exists (eg. linked by a previous run) is a no-op. Once linked, re-imports of
+// the source organization are merged into the target (see MergeOrganization).
+func (sr *SqliteRepository) LinkOrganizations(sourceOrgId string, targetOrgId string, source string) error {
+	return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		return sr.linkOrganizations(tx, sourceOrgId, targetOrgId, source)
+	})
+}
+
+func (sr *SqliteRepository) linkOrganizations(tx *gorm.DB, sourceOrgId string, targetOrgId string, source string) error {
+	if sourceOrgId == targetOrgId {
+		return fmt.Errorf("Cannot link organization (%s) to itself", sourceOrgId)
+	}
+
+	var sourceCount int64
+	err := tx.Model(&models.Organization{}).Where("id = ?", sourceOrgId).Count(&sourceCount).Error
+	if err != nil {
+		return err
+	} else if sourceCount == 0 {
+		return nil
+	}
+
+	var existing models.Organization
+	err = preloadOrganization(tx).First(&existing, "id = ?", targetOrgId).Error
+	if err != nil {
+		return fmt.Errorf("Failed to find organization (%s) to link to - %v", targetOrgId, err)
+	}
+	var sourceOrg models.Organization
+	err = preloadOrganization(tx).First(&sourceOrg, "id = ?", sourceOrgId).Error
+	if err != nil {
+		return err
+	}
+	blocked, err := organizationsMergeBlocked(tx, &sourceOrg, &existing)
+	if err != nil {
+		return err
+	} else if blocked {
+		return fmt.Errorf("Cannot link organization (%s) to (%s), they were unmerged", sourceOrgId, targetOrgId)
+	}
+
+	err = tx.Model(&models.Endpoint{}).
+		Where("organization_id = ?", sourceOrgId).
+		Update("organization_id", targetOrgId).Error
+	if err != nil {
+		return fmt.Errorf("Failed to link endpoints (%s -> %s) - %v", sourceOrgId, targetOrgId, err)
+	}
+	err = tx.Model(&models.OrganizationIdentifier{}).
+		Where("organization_id = ?", sourceOrgId).
+		Update("organization_id", targetOrgId).Error
+	if err != nil {
+		return fmt.Errorf("Failed to link organization identifiers (%s -> %s) - %v", sourceOrgId, targetOrgId, err)
+	}
+
+	// locations, attribute identifiers & provenance may already exist on the target organization, so duplicates are
+	// ignored, then removed.
+	for _, statement := range []string{
+		"INSERT OR IGNORE INTO org_locations (organization_id, location_id) SELECT ?, location_id FROM org_locations WHERE organization_id = ?",
+		"UPDATE OR IGNORE organization_attribute_identifiers SET organization_id = ? WHERE organization_id = ?",
+		"UPDATE OR IGNORE organization_provenances SET organization_id = ? WHERE organization_id = ?",
+	} {
+		err = tx.Exec(statement, targetOrgId, sourceOrgId).Error
+		if err != nil {
+			return fmt.Errorf("Failed to link organization (%s -> %s) - %v", sourceOrgId, targetOrgId, err)
+		}
+	}
+	for _, statement := range []string{
+		"DELETE FROM org_locations WHERE organization_id = ?",
+		"DELETE FROM organization_attribute_identifiers WHERE organization_id = ?",
+		"DELETE FROM organization_provenances WHERE organization_id = ?",
+		"DELETE FROM organizations WHERE id = ?",
+	} {
+		err = tx.Exec(statement, sourceOrgId).Error
+		if err != nil {
+			return fmt.Errorf("Failed to remove linked organization (%s) - %v", sourceOrgId, err)
+		}
+	}
+
+	err = sr.recordOrganizationRevision(tx, models.OrganizationRevisionActionLink, &sourceOrg, &models.Organization{ID: sourceOrgId}, source, targetOrgId)
+	if err != nil {
+		return err
+	}
+
+	var written models.Organization
+	err = preloadOrganization(tx).First(&written, "id = ?", targetOrgId).Error
+	if err != nil {
+		return err
+	}
+	return sr.createOrganizationRevision(tx, &existing, &written, source, sourceOrgId)
+}
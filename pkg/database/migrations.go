@@ -0,0 +1,405 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+// data migrations, keyed by the schema version they migrate to. Schema changes are handled by AutoMigrate, before the
+// data migrations are run.
+var migrations = map[int]func(sr *SqliteRepository) error{
+	2:  (*SqliteRepository).migrateLocationIds,
+	10: (*SqliteRepository).migrateEndpointIds,
+	11: (*SqliteRepository).migrateAttributeIdentifiers,
+	12: (*SqliteRepository).migrateFacilityTypes,
+	14: (*SqliteRepository).migrateEndpointIds,
+	15: (*SqliteRepository).migrateAttributeIdentifiers,
+}
+
+// schema migrations, keyed by the schema version they migrate to. These are run before AutoMigrate, for changes that
+// AutoMigrate cannot make by itself (eg. replacing an index that existing rows would violate). Schema migrations must be
+// idempotent, since the schema version is only recorded once the data migrations for the version have also completed.
+var schemaMigrations = map[int]func(sr *SqliteRepository) error{
+	9:  (*SqliteRepository).migrateProvenanceIndex,
+	13: (*SqliteRepository).dropRelatedUrlDetails,
+}
+
+// storedSchemaVersion returns the schema version recorded in the database, or 0 for new databases.
+// Databases created before the schema version was recorded (they already have an organizations table) are version 1.
+func (sr *SqliteRepository) storedSchemaVersion() (int, error) {
+	storedVersion := ""
+	if sr.GormClient.Migrator().HasTable(&models.DatabaseMetadata{}) {
+		var err error
+		storedVersion, err = sr.GetMetadata(models.DatabaseMetadataKeySchemaVersion)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if storedVersion == "" {
+		if sr.GormClient.Migrator().HasTable(&models.Organization{}) {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	fromVersion, err := strconv.Atoi(storedVersion)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid schema version: %s - %v", storedVersion, err)
+	}
+	if fromVersion > SchemaVersion {
+		return 0, fmt.Errorf("Database schema version (%d) is newer than supported (%d)", fromVersion, SchemaVersion)
+	}
+	return fromVersion, nil
+}
+
+// migrateSchema runs every schema migration newer than the stored schema version. New databases have no stored schema
+// version, and do not need to be migrated.
+func (sr *SqliteRepository) migrateSchema(fromVersion int) error {
+	if fromVersion == 0 {
+		return nil
+	}
+	for version := fromVersion + 1; version <= SchemaVersion; version++ {
+		migration, ok := schemaMigrations[version]
+		if !ok {
+			continue
+		}
+		sr.Logger.Infof("Migrating database schema to schema version %d", version)
+		err := migration(sr)
+		if err != nil {
+			return fmt.Errorf("Failed to migrate database schema to schema version %d - %v", version, err)
+		}
+	}
+	return nil
+}
+
+// migrateData runs every data migration newer than the stored schema version. New databases have no stored schema
+// version, and do not need to be migrated.
+func (sr *SqliteRepository) migrateData(fromVersion int) error {
+	if fromVersion == 0 {
+		return nil
+	}
+	for version := fromVersion + 1; version <= SchemaVersion; version++ {
+		migration, ok := migrations[version]
+		if ok {
+			sr.Logger.Infof("Migrating database to schema version %d", version)
+			err := migration(sr)
+			if err != nil {
+				return fmt.Errorf("Failed to migrate database to schema version %d - %v", version, err)
+			}
+		}
+		// record progress, so completed migrations are not re-run if a later migration fails
+		err := sr.SetMetadata(models.DatabaseMetadataKeySchemaVersion, strconv.Itoa(version))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type locationRow struct {
+	RowID           int64 `gorm:"column:row_id"`
+	models.Location `gorm:"embedded"`
+}
+
+// migrateLocationIds replaces formatted address location ids with hashed ids (see models.Location.ComputeId), and moves
+// ZIP+4 extensions out of the postal code. Locations that now have the same id are merged. Organization links & location
+// provenance are updated, revision history is left as it was recorded.
+func (sr *SqliteRepository) migrateLocationIds() error {
+	migrated := 0
+	lastRowId := int64(0)
+	for {
+		var rows []locationRow
+		err := sr.GormClient.Table("locations").
+			Select("rowid AS row_id, *").
+			Where("rowid > ?", lastRowId).
+			Order("rowid asc").
+			Limit(10000).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastRowId = rows[len(rows)-1].RowID
+
+		err = sr.GormClient.Transaction(func(tx *gorm.DB) error {
+			for ndx := range rows {
+				rowMigrated, err := migrateLocationId(tx, &rows[ndx].Location)
+				if err != nil {
+					return err
+				}
+				if rowMigrated {
+					migrated++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	sr.Logger.Infof("Migrated %d location ids", migrated)
+	return nil
+}
+
+func migrateLocationId(tx *gorm.DB, loc *models.Location) (bool, error) {
+	previousId := loc.ID
+	loc.Standardize()
+	locId, err := loc.ComputeId()
+	if err != nil {
+		return false, err
+	}
+	if locId == previousId {
+		return false, nil
+	}
+
+	var existingCount int64
+	err = tx.Model(&models.Location{}).Where("id = ?", locId).Count(&existingCount).Error
+	if err != nil {
+		return false, err
+	}
+	if existingCount > 0 {
+		// duplicate location, merge into the existing row
+		err = tx.Exec("INSERT OR IGNORE INTO org_locations (organization_id, location_id) SELECT organization_id, ? FROM org_locations WHERE location_id = ?", locId, previousId).Error
+		if err == nil {
+			err = tx.Exec("DELETE FROM org_locations WHERE location_id = ?", previousId).Error
+		}
+		if err == nil {
+			err = tx.Exec("DELETE FROM locations WHERE id = ?", previousId).Error
+		}
+	} else {
+		lineJson, _ := json.Marshal(loc.Line)
+		err = tx.Exec("UPDATE locations SET id = ?, line = ?, city = ?, state = ?, postal_code = ?, postal_code_extension = ?, country = ? WHERE id = ?",
+			locId, string(lineJson), loc.City, loc.State, loc.PostalCode, loc.PostalCodeExtension, loc.Country, previousId).Error
+		if err == nil {
+			err = tx.Exec("UPDATE org_locations SET location_id = ? WHERE location_id = ?", locId, previousId).Error
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to migrate location (%s -> %s) - %v", previousId, locId, err)
+	}
+
+	// location provenance was keyed by the previous location id
+	err = tx.Exec("UPDATE OR IGNORE organization_provenances SET field_key = ? WHERE field_type = ? AND field_key = ?", locId, models.ProvenanceFieldTypeLocation, previousId).Error
+	if err == nil {
+		err = tx.Exec("DELETE FROM organization_provenances WHERE field_type = ? AND field_key = ?", models.ProvenanceFieldTypeLocation, previousId).Error
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to migrate location provenance (%s -> %s) - %v", previousId, locId, err)
+	}
+	return true, nil
+}
+
+// migrateProvenanceIndex replaces the provenance unique index, which included the source row, with an index on the
+// source dataset & file. Only the newest entry (highest id) of each value, dataset & file is kept. The index is
+// re-created by AutoMigrate.
+func (sr *SqliteRepository) migrateProvenanceIndex() error {
+	if !sr.GormClient.Migrator().HasTable(&models.OrganizationProvenance{}) {
+		return nil
+	}
+	return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`DELETE FROM organization_provenances WHERE EXISTS (
+			SELECT 1 FROM organization_provenances newer
+			WHERE newer.organization_id = organization_provenances.organization_id
+				AND newer.field_type = organization_provenances.field_type
+				AND newer.field_key = organization_provenances.field_key
+				AND newer.source_dataset = organization_provenances.source_dataset
+				AND newer.source_file = organization_provenances.source_file
+				AND newer.id > organization_provenances.id)`)
+		if result.Error != nil {
+			return fmt.Errorf("Failed to remove duplicate provenance - %v", result.Error)
+		}
+		sr.Logger.Infof("Removed %d duplicate provenance entries", result.RowsAffected)
+		return tx.Exec("DROP INDEX IF EXISTS idx_organization_provenance").Error
+	})
+}
+
+type endpointRow struct {
+	RowID           int64 `gorm:"column:row_id"`
+	models.Endpoint `gorm:"embedded"`
+}
+
+// migrateEndpointIds replaces endpoint ids & urls with their canonical form (see utils.CanonicalizeEndpointURL). Endpoints
+// that now have the same id are merged, the existing canonical endpoint is kept. Probes & endpoint provenance are updated,
+// revision history is left as it was recorded.
+// Also run for version 14, which no longer lowercases the path of endpoint ids (see utils.NormalizeEndpointId).
+func (sr *SqliteRepository) migrateEndpointIds() error {
+	migrated := 0
+	lastRowId := int64(0)
+	for {
+		var rows []endpointRow
+		err := sr.GormClient.Table("endpoints").
+			Select("rowid AS row_id, *").
+			Where("rowid > ?", lastRowId).
+			Order("rowid asc").
+			Limit(10000).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastRowId = rows[len(rows)-1].RowID
+
+		err = sr.GormClient.Transaction(func(tx *gorm.DB) error {
+			for ndx := range rows {
+				rowMigrated, err := migrateEndpointId(tx, &rows[ndx].Endpoint)
+				if err != nil {
+					return err
+				}
+				if rowMigrated {
+					migrated++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	sr.Logger.Infof("Migrated %d endpoint ids", migrated)
+	return nil
+}
+
+func migrateEndpointId(tx *gorm.DB, end *models.Endpoint) (bool, error) {
+	previousId := end.ID
+	endpointId := utils.NormalizeEndpointId(end.URL)
+	endpointUrl := utils.NormalizeEndpointURL(end.URL)
+	if endpointId == previousId && endpointUrl == end.URL {
+		return false, nil
+	}
+
+	var existing models.Endpoint
+	err := tx.Where("(id = ? OR url = ?) AND id <> ?", endpointId, endpointUrl, previousId).Limit(1).Find(&existing).Error
+	if err != nil {
+		return false, err
+	}
+	if existing.ID != "" {
+		// duplicate endpoint, merge into the existing row
+		err = tx.Exec("DELETE FROM endpoints WHERE id = ?", previousId).Error
+		endpointId = existing.ID
+	} else {
+		err = tx.Exec("UPDATE endpoints SET id = ?, url = ? WHERE id = ?", endpointId, endpointUrl, previousId).Error
+	}
+	if err == nil && endpointId != previousId {
+		err = tx.Exec("UPDATE endpoint_probes SET endpoint_id = ? WHERE endpoint_id = ?", endpointId, previousId).Error
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to migrate endpoint (%s -> %s) - %v", previousId, endpointId, err)
+	}
+	if endpointId == previousId {
+		return true, nil
+	}
+
+	// endpoint provenance was keyed by the previous endpoint id
+	err = tx.Exec("UPDATE OR IGNORE organization_provenances SET field_key = ? WHERE field_type = ? AND field_key = ?", endpointId, models.ProvenanceFieldTypeEndpoint, previousId).Error
+	if err == nil {
+		err = tx.Exec("DELETE FROM organization_provenances WHERE field_type = ? AND field_key = ?", models.ProvenanceFieldTypeEndpoint, previousId).Error
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to migrate endpoint provenance (%s -> %s) - %v", previousId, endpointId, err)
+	}
+	return true, nil
+}
+
+// migrateAttributeIdentifiers moves state scoped & issuer scoped identifiers (PTANs, Medicaid ids, state licenses & Other
+// identifiers) to organization attribute identifiers, so they are no longer merge keys (see models.IsMergeKeyIdentifierType).
+// Their provenance is keyed the same way, so it is left as it was recorded.
+// Also run for version 15, which moves EINs to attribute identifiers. Organizations that were already merged by a
+// shared EIN stay merged (see UnmergeOrganization).
+func (sr *SqliteRepository) migrateAttributeIdentifiers() error {
+	attributeTypes := []models.OrganizationIdentifierType{
+		models.OrganizationIdentifierTypeEIN,
+		models.OrganizationIdentifierTypePTAN,
+		models.OrganizationIdentifierTypeMedicaidStateID,
+		models.OrganizationIdentifierTypeStateLicense,
+		models.OrganizationIdentifierTypeOther,
+	}
+	return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec(`INSERT OR IGNORE INTO organization_attribute_identifiers
+			(created_at, updated_at, organization_id, identifier_type, identifier_value, identifier_display, identifier_issuer, identifier_state)
+			SELECT created_at, updated_at, organization_id, identifier_type, identifier_value, identifier_display, identifier_issuer, identifier_state
+			FROM organization_identifiers WHERE identifier_type IN ? AND deleted_at IS NULL`, attributeTypes)
+		if result.Error != nil {
+			return fmt.Errorf("Failed to migrate attribute identifiers - %v", result.Error)
+		}
+		sr.Logger.Infof("Migrated %d attribute identifiers", result.RowsAffected)
+		return tx.Exec("DELETE FROM organization_identifiers WHERE identifier_type IN ?", attributeTypes).Error
+	})
+}
+
+// legacyFacilityTypes maps the facility types stored before schema version 12 (the Provider of Services labels & the
+// Hospital General Information "Hospital Type" values) to canonical facility types.
+var legacyFacilityTypes = map[string]models.FacilityType{
+	"Hospital":                                         models.FacilityTypeHospital,
+	"Home Health Agency":                               models.FacilityTypeHomeHealthAgency,
+	"End Stage Renal Disease Facility":                 models.FacilityTypeESRDFacility,
+	"Intermediate Care Facility/IID":                   models.FacilityTypeIntermediateCareFacility,
+	"Rural Health Clinic":                              models.FacilityTypeRuralHealthClinic,
+	"Comprehensive Outpatient Rehabilitation Facility": models.FacilityTypeOutpatientRehabilitation,
+	"Ambulatory Surgical Center":                       models.FacilityTypeAmbulatorySurgicalCenter,
+	"Hospice":                                          models.FacilityTypeHospice,
+	"Organ Procurement Organization":                   models.FacilityTypeOrganProcurementOrganization,
+	"Community Mental Health Center":                   models.FacilityTypeCommunityMentalHealthCenter,
+	"Federally Qualified Health Center":                models.FacilityTypeFederallyQualifiedHealthCenter,
+	"Short Term Hospital":                              models.FacilityTypeAcuteCareHospital,
+	"Long Term Hospital":                               models.FacilityTypeLongTermCareHospital,
+	"Religious Non-Medical Health Care Institution":    models.FacilityTypeReligiousNonMedical,
+	"Psychiatric Hospital":                             models.FacilityTypePsychiatricHospital,
+	"Rehabilitation Hospital":                          models.FacilityTypeRehabilitationHospital,
+	"Children's Hospital":                              models.FacilityTypeChildrensHospital,
+	"Distinct Part Psychiatric Hospital":               models.FacilityTypePsychiatricHospital,
+	"Critical Access Hospital":                         models.FacilityTypeCriticalAccessHospital,
+	"Transplant Hospital":                              models.FacilityTypeTransplantHospital,
+	"Medicaid Only Non-Psychiatric Hospital":           models.FacilityTypeHospital,
+	"Medicaid Only Psychiatric Hospital":               models.FacilityTypePsychiatricHospital,
+	"Acute Care Hospitals":                             models.FacilityTypeAcuteCareHospital,
+	"Acute Care - Department of Defense":               models.FacilityTypeAcuteCareHospital,
+	"Acute Care - Veterans Administration":             models.FacilityTypeAcuteCareHospital,
+	"Critical Access Hospitals":                        models.FacilityTypeCriticalAccessHospital,
+	"Childrens":                                        models.FacilityTypeChildrensHospital,
+	"Psychiatric":                                      models.FacilityTypePsychiatricHospital,
+	"Rural Emergency Hospital":                         models.FacilityTypeRuralEmergencyHospital,
+	"Long-term":                                        models.FacilityTypeLongTermCareHospital,
+}
+
+// migrateFacilityTypes replaces the facility types copied from the CMS datasets with canonical facility types. Values
+// that are not in legacyFacilityTypes (eg. "POS provider category 99") become models.FacilityTypeOther.
+func (sr *SqliteRepository) migrateFacilityTypes() error {
+	var facilityTypes []string
+	err := sr.GormClient.Model(&models.Organization{}).Distinct("facility_type").Where("facility_type <> ''").Pluck("facility_type", &facilityTypes).Error
+	if err != nil {
+		return err
+	}
+	return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		for _, facilityType := range facilityTypes {
+			if slices.Contains(models.FacilityTypes, models.FacilityType(facilityType)) {
+				continue
+			}
+			canonicalType, ok := legacyFacilityTypes[facilityType]
+			if !ok {
+				canonicalType = models.FacilityTypeOther
+			}
+			result := tx.Exec("UPDATE organizations SET facility_type = ? WHERE facility_type = ?", canonicalType, facilityType)
+			if result.Error != nil {
+				return fmt.Errorf("Failed to migrate facility type (%s -> %s) - %v", facilityType, canonicalType, result.Error)
+			}
+			sr.Logger.Infof("Migrated %d organizations with facility type (%s) to %s", result.RowsAffected, facilityType, canonicalType)
+		}
+		return nil
+	})
+}
+
+// dropRelatedUrlDetails drops the related url details column, related urls are classified when they are read instead.
+func (sr *SqliteRepository) dropRelatedUrlDetails() error {
+	if !sr.GormClient.Migrator().HasColumn(&models.Organization{}, "related_url_details") {
+		return nil
+	}
+	return sr.GormClient.Migrator().DropColumn(&models.Organization{}, "related_url_details")
+}
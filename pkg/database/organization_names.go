@@ -0,0 +1,133 @@
+package database
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strconv"
+)
+
+const recomputeOrganizationNamesBatchSize = 10000
+
+// RecomputeOrganizationNames re-canonicalizes every stored OrganizationIdentifierTypeName value (and the matching name
+// provenance) using utils.DefaultNameCanonicalizer, if the canonicalization rules have changed since the names were
+// stored (or force is true). Run by the recompute_organization_names action, after the canonicalization rules change.
+//
+// Names are recomputed from the identifier display value (the original name). If the canonical value already belongs
+// to another organization, the name is not recomputed (the stored identifier & provenance are kept), and the collision
+// is returned, so it can be reviewed (eg. merged, or fixed with a curation override).
+func (sr *SqliteRepository) RecomputeOrganizationNames(force bool) ([]AssociationConflict, error) {
+	currentVersion := strconv.Itoa(utils.DefaultNameCanonicalizer.Version())
+	storedVersion, err := sr.GetMetadata(models.DatabaseMetadataKeyNameCanonicalizationVersion)
+	if err != nil {
+		return nil, err
+	}
+	if storedVersion == currentVersion && !force {
+		return nil, nil
+	}
+	sr.Logger.Infof("Recomputing organization names (name canonicalization version %s -> %s)", storedVersion, currentVersion)
+
+	updated := 0
+	var collisions []AssociationConflict
+	lastValue := ""
+	for {
+		//keyset pagination, since identifiers are modified while iterating.
+		var identifiers []models.OrganizationIdentifier
+		err = sr.GormClient.
+			Where("identifier_type = ? AND identifier_value > ?", models.OrganizationIdentifierTypeName, lastValue).
+			Order("identifier_value asc").
+			Limit(recomputeOrganizationNamesBatchSize).
+			Find(&identifiers).Error
+		if err != nil {
+			return nil, fmt.Errorf("Failed to find organization names - %v", err)
+		}
+		if len(identifiers) == 0 {
+			break
+		}
+		lastValue = identifiers[len(identifiers)-1].IdentifierValue
+
+		err = sr.GormClient.Transaction(func(tx *gorm.DB) error {
+			for ndx := range identifiers {
+				identifierUpdated, collision, err := recomputeOrganizationName(tx, &identifiers[ndx])
+				if err != nil {
+					return err
+				}
+				if collision != nil {
+					collisions = append(collisions, *collision)
+				} else if identifierUpdated {
+					updated++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sr.Logger.Infof("Recomputed %d organization names, %d collisions", updated, len(collisions))
+	return collisions, sr.SetMetadata(models.DatabaseMetadataKeyNameCanonicalizationVersion, currentVersion)
+}
+
+// recomputeOrganizationName replaces the name identifier with its canonical value. If the canonical value already belongs
+// to another organization, nothing is modified and the collision is returned.
+func recomputeOrganizationName(tx *gorm.DB, identifier *models.OrganizationIdentifier) (bool, *AssociationConflict, error) {
+	originalName := identifier.IdentifierDisplay
+	if originalName == "" {
+		originalName = identifier.IdentifierValue
+	}
+	canonicalName, err := utils.NormalizeOrganizationName(originalName)
+	if err != nil {
+		return false, nil, err
+	}
+	if canonicalName == "" || canonicalName == identifier.IdentifierValue {
+		return false, nil, nil
+	}
+
+	previousValue := identifier.IdentifierValue
+	recomputed := *identifier
+	recomputed.IdentifierValue = canonicalName
+	recomputed.Organization = nil
+	result := tx.Omit(clause.Associations).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&recomputed)
+	if result.Error != nil {
+		return false, nil, fmt.Errorf("Failed to update organization name (%s -> %s) - %v", previousValue, canonicalName, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// the canonical name already exists, it's only safe to replace the stored name if it belongs to the same organization
+		var owner models.OrganizationIdentifier
+		err = tx.Where("identifier_type = ? AND identifier_value = ?", models.OrganizationIdentifierTypeName, canonicalName).
+			First(&owner).Error
+		if err != nil {
+			return false, nil, fmt.Errorf("Failed to find the owner of organization name (%s) - %v", canonicalName, err)
+		}
+		if owner.OrganizationID != identifier.OrganizationID {
+			return false, &AssociationConflict{
+				OrganizationID:      identifier.OrganizationID,
+				OwnerOrganizationID: owner.OrganizationID,
+				FieldType:           models.ProvenanceFieldTypeName,
+				FieldKey:            canonicalName,
+			}, nil
+		}
+	}
+	err = tx.Where("identifier_type = ? AND identifier_value = ?", models.OrganizationIdentifierTypeName, previousValue).
+		Delete(&models.OrganizationIdentifier{}).Error
+	if err != nil {
+		return false, nil, fmt.Errorf("Failed to update organization name (%s -> %s) - %v", previousValue, canonicalName, err)
+	}
+
+	// provenance may already exist for the canonical name, so duplicates are ignored, then removed.
+	err = tx.Exec("UPDATE OR IGNORE organization_provenances SET field_key = ? WHERE organization_id = ? AND field_type = ? AND field_key = ?",
+		canonicalName, identifier.OrganizationID, models.ProvenanceFieldTypeName, previousValue).Error
+	if err == nil {
+		err = tx.Exec("DELETE FROM organization_provenances WHERE organization_id = ? AND field_type = ? AND field_key = ?",
+			identifier.OrganizationID, models.ProvenanceFieldTypeName, previousValue).Error
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("Failed to update organization name provenance (%s -> %s) - %v", previousValue, canonicalName, err)
+	}
+	return true, nil, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindEndpointsByIds returns the endpoints (ordered by id). Missing endpoints are ignored.
+func (sr *SqliteRepository) FindEndpointsByIds(endpointIds []string) ([]models.Endpoint, error) {
+	if len(endpointIds) == 0 {
+		return nil, nil
+	}
+	var endpoints []models.Endpoint
+	err := sr.GormReadClient.
+		Where("id IN ?", endpointIds).
+		Order("id asc").
+		Find(&endpoints).Error
+	return endpoints, err
+}
+
+// OverrideOrganization persists a hand curated organization, exactly as given: unlike UpsertOrganization, identifiers
+// that are missing from the organization are removed, and the fields of existing endpoints (eg. platform type & hidden)
+// are updated. Endpoints that belong to another organization are moved to this organization.
+// Identifiers (including aliases) that belong to another organization are never moved, the override fails instead.
+// The organization must exist. A revision with the override action is recorded.
+func (sr *SqliteRepository) OverrideOrganization(org *models.Organization, source string) (*models.Organization, error) {
+	var written models.Organization
+	err := sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		var existing models.Organization
+		err := preloadOrganization(tx).First(&existing, "id = ?", org.ID).Error
+		if err != nil {
+			return fmt.Errorf("Failed to find organization (%s) to override - %v", org.ID, err)
+		}
+
+		err = tx.Omit(clause.Associations).Save(org).Error
+		if err != nil {
+			return fmt.Errorf("Failed to override organization (%s) - %v", org.ID, err)
+		}
+		conflicts, err := upsertOrganizationAssociations(tx, org)
+		if err != nil {
+			return err
+		}
+		for _, conflict := range conflicts {
+			//endpoints are moved below
+			if conflict.FieldType != models.ProvenanceFieldTypeEndpoint {
+				return fmt.Errorf("Failed to override organization (%s) - %v", org.ID, conflict)
+			}
+		}
+		for ndx := range org.Endpoints {
+			err = tx.Model(&models.Endpoint{}).
+				Where("id = ?", org.Endpoints[ndx].ID).
+				Updates(map[string]interface{}{
+					"organization_id": org.ID,
+					"platform_type":   org.Endpoints[ndx].PlatformType,
+					"source_url":      org.Endpoints[ndx].SourceUrl,
+					"hidden":          org.Endpoints[ndx].Hidden,
+				}).Error
+			if err != nil {
+				return fmt.Errorf("Failed to override endpoint (%s) - %v", org.Endpoints[ndx].URL, err)
+			}
+		}
+		err = removeOrganizationAssociations(tx, &existing, org)
+		if err != nil {
+			return err
+		}
+		err = removeOrganizationIdentifiers(tx, &existing, org)
+		if err != nil {
+			return err
+		}
+
+		err = preloadOrganization(tx).First(&written, "id = ?", org.ID).Error
+		if err != nil {
+			return err
+		}
+		return sr.recordOrganizationRevision(tx, models.OrganizationRevisionActionOverride, &existing, &written, source, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &written, nil
+}
+
+// removeOrganizationIdentifiers deletes identifiers that were associated with the existing organization, but are missing
+// from the updated organization, along with their provenance.
+func removeOrganizationIdentifiers(tx *gorm.DB, existing *models.Organization, org *models.Organization) error {
+	for _, identifier := range existing.OrganizationIdentifiers {
+		if hasIdentifier(org.OrganizationIdentifiers, &identifier) {
+			continue
+		}
+		err := tx.Where(models.OrganizationIdentifier{OrganizationID: org.ID, IdentifierType: identifier.IdentifierType, IdentifierValue: identifier.IdentifierValue}).
+			Delete(&models.OrganizationIdentifier{}).Error
+		if err == nil {
+			fieldType, fieldKey := models.ProvenanceFieldTypeIdentifier, models.IdentifierProvenanceKey(&identifier)
+			if identifier.IdentifierType == models.OrganizationIdentifierTypeName {
+				fieldType, fieldKey = models.ProvenanceFieldTypeName, identifier.IdentifierValue
+			}
+			err = tx.Where(models.OrganizationProvenance{OrganizationID: org.ID, FieldType: fieldType, FieldKey: fieldKey}).
+				Delete(&models.OrganizationProvenance{}).Error
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to remove organization identifier (%s: %s) from organization (%s) - %v", identifier.IdentifierType, identifier.IdentifierValue, org.ID, err)
+		}
+	}
+	return nil
+}
+
+func hasIdentifier(identifiers []models.OrganizationIdentifier, identifier *models.OrganizationIdentifier) bool {
+	for ndx := range identifiers {
+		if identifiers[ndx].Equal(identifier) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+)
+
+// QuarantineOrganization saves an imported record that failed validation, instead of merging it
+func (sr *SqliteRepository) QuarantineOrganization(org *models.Organization, source string) error {
+	quarantined := models.QuarantinedOrganization{
+		RunID:          sr.RunID,
+		Source:         source,
+		OrganizationID: org.ID,
+		Name:           org.Name,
+		Identifiers:    org.AllIdentifiers(),
+		Locations:      org.Locations,
+		Findings:       org.ValidationFindings,
+	}
+	for _, provenance := range org.Provenance {
+		if !containsProvenance(quarantined.Provenance, &provenance.Provenance) {
+			quarantined.Provenance = append(quarantined.Provenance, provenance.Provenance)
+		}
+	}
+	err := sr.GormClient.Create(&quarantined).Error
+	if err != nil {
+		return fmt.Errorf("Failed to quarantine organization (%s) - %v", org.ID, err)
+	}
+	return nil
+}
+
+// ListQuarantinedOrganizations returns quarantined records, most recent first
+func (sr *SqliteRepository) ListQuarantinedOrganizations(limit int) ([]models.QuarantinedOrganization, error) {
+	var quarantined []models.QuarantinedOrganization
+	query := sr.GormReadClient.Order("id desc")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&quarantined).Error
+	return quarantined, err
+}
+
+func containsProvenance(provenances []models.Provenance, provenance *models.Provenance) bool {
+	for _, existing := range provenances {
+		if existing == *provenance {
+			return true
+		}
+	}
+	return false
+}
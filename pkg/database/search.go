@@ -0,0 +1,59 @@
+package database
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"strings"
+)
+
+// OrganizationSearch filters organizations by name & location. Empty fields are ignored.
+type OrganizationSearch struct {
+	Name         string // matches organizations with a (normalized) name or alias containing the (normalized) value
+	State        string // two-letter state of any location
+	PostalCode   string // 5 digit ZIP code of any location
+	HasEndpoints bool   // only organizations with a visible (not hidden) endpoint
+
+	Limit  int // 0 for no limit
+	Offset int
+}
+
+// SearchOrganizations returns the organizations matching the search (ordered by id), without associations.
+// Hidden organizations are never returned.
+func (sr *SqliteRepository) SearchOrganizations(search OrganizationSearch) ([]models.Organization, error) {
+	query := sr.GormReadClient.Model(&models.Organization{}).Where("hidden IS NULL OR hidden = ?", false)
+
+	if search.Name != "" {
+		name, err := utils.NormalizeOrganizationName(search.Name)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("id IN (SELECT organization_id FROM organization_identifiers WHERE identifier_type = ? AND identifier_value LIKE ? ESCAPE '\\')",
+			models.OrganizationIdentifierTypeName, "%"+escapeLike(name)+"%")
+	}
+	if search.State != "" || search.PostalCode != "" {
+		locations := sr.GormReadClient.Table("locations").Select("org_locations.organization_id").
+			Joins("JOIN org_locations ON org_locations.location_id = locations.id")
+		if search.State != "" {
+			locations = locations.Where("locations.state = ?", utils.StandardizeState(search.State))
+		}
+		if search.PostalCode != "" {
+			zip, _ := utils.StandardizePostalCode(search.PostalCode)
+			locations = locations.Where("locations.postal_code = ?", zip)
+		}
+		query = query.Where("id IN (?)", locations)
+	}
+	if search.HasEndpoints {
+		query = query.Where("id IN (SELECT organization_id FROM endpoints WHERE deleted_at IS NULL AND (hidden IS NULL OR hidden = ?))", false)
+	}
+
+	if search.Limit > 0 {
+		query = query.Limit(search.Limit).Offset(search.Offset)
+	}
+	var orgs []models.Organization
+	err := query.Order("id asc").Find(&orgs).Error
+	return orgs, err
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"gorm.io/gorm"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SnapshotManifest is written alongside every snapshot, as <snapshot>.manifest.json
+type SnapshotManifest struct {
+	Database         string           `json:"database"` //filename of the snapshot, relative to the manifest
+	SchemaVersion    int              `json:"schema_version"`
+	NPPESReleaseDate string           `json:"nppes_release_date"`
+	CreatedAt        time.Time        `json:"created_at"`
+	RowCounts        map[string]int64 `json:"row_counts"`
+	SizeBytes        int64            `json:"size_bytes"`
+	SHA256           string           `json:"sha256"`
+}
+
+// snapshotModels are the only tables (and their indexes) that are included in a snapshot.
+// Working tables (revisions, etc) are only relevant to the ETL process, and are dropped.
+var snapshotModels = []interface{}{
+	&models.Organization{},
+	&models.Location{},
+	&models.Endpoint{},
+	&models.OrganizationIdentifier{},
+	&models.OrganizationAttributeIdentifier{},
+	&models.OrganizationProvenance{},
+	&models.DatabaseMetadata{},
+	&models.HealthSystem{},
+	&models.HealthSystemMember{},
+}
+
+// many2many join tables, which do not have a model
+var snapshotJoinTables = []string{
+	"org_locations",
+}
+
+func SnapshotManifestPath(snapshotPath string) string {
+	return snapshotPath + ".manifest.json"
+}
+
+// Snapshot copies the database into a compacted, read-only artifact at snapshotPath, and writes a manifest alongside it.
+// The snapshot is a standalone SQLite database (no WAL), that consumers can open directly.
+func (sr *SqliteRepository) Snapshot(snapshotPath string) (*SnapshotManifest, error) {
+	if _, err := os.Stat(snapshotPath); err == nil {
+		return nil, fmt.Errorf("Snapshot already exists: %s", snapshotPath)
+	}
+	err := os.MkdirAll(filepath.Dir(snapshotPath), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	schemaVersion, err := sr.GetMetadata(models.DatabaseMetadataKeySchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	nppesReleaseDate, err := sr.GetMetadata(models.DatabaseMetadataKeyNPPESReleaseDate)
+	if err != nil {
+		return nil, err
+	}
+	manifest := SnapshotManifest{
+		Database:         filepath.Base(snapshotPath),
+		NPPESReleaseDate: nppesReleaseDate,
+		CreatedAt:        time.Now().UTC(),
+		RowCounts:        map[string]int64{},
+	}
+	manifest.SchemaVersion, err = strconv.Atoi(schemaVersion)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schema version (%s) - %v", schemaVersion, err)
+	}
+
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	// Copy the database (VACUUM INTO creates a compacted copy, and includes any committed WAL content)
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	sr.Logger.Infof("Copying database to snapshot: %s", snapshotPath)
+	err = sr.GormClient.Exec("VACUUM INTO ?", snapshotPath).Error
+	if err != nil {
+		return nil, fmt.Errorf("Failed to copy database to snapshot - %v", err)
+	}
+
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	// Remove working tables, and compact the snapshot
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	snapshotDatabase, err := openDatabase(snapshotPath, map[string]string{
+		"journal_mode": "DELETE",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open snapshot - %v", err)
+	}
+	err = prepareSnapshot(snapshotDatabase, &manifest)
+	if sqlDB, dbErr := snapshotDatabase.DB(); dbErr == nil {
+		sqlDB.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	// Finalize: read-only file, checksum & manifest
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	err = os.Chmod(snapshotPath, 0444)
+	if err != nil {
+		return nil, err
+	}
+	manifest.SHA256, manifest.SizeBytes, err = sha256File(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	err = os.WriteFile(SnapshotManifestPath(snapshotPath), manifestJson, 0444)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write snapshot manifest - %v", err)
+	}
+	return &manifest, nil
+}
+
+func prepareSnapshot(snapshotDatabase *gorm.DB, manifest *SnapshotManifest) error {
+	keepTables := map[string]bool{}
+	for _, joinTable := range snapshotJoinTables {
+		keepTables[joinTable] = true
+	}
+	for _, model := range snapshotModels {
+		stmt := &gorm.Statement{DB: snapshotDatabase}
+		err := stmt.Parse(model)
+		if err != nil {
+			return err
+		}
+		keepTables[stmt.Schema.Table] = true
+	}
+
+	var existingTables []string
+	err := snapshotDatabase.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").
+		Scan(&existingTables).Error
+	if err != nil {
+		return err
+	}
+	for _, table := range existingTables {
+		if keepTables[table] {
+			continue
+		}
+		//dropping the table also drops its indexes
+		err = snapshotDatabase.Migrator().DropTable(table)
+		if err != nil {
+			return fmt.Errorf("Failed to drop table (%s) from snapshot - %v", table, err)
+		}
+	}
+
+	for table := range keepTables {
+		var count int64
+		err = snapshotDatabase.Table(table).Count(&count).Error
+		if err != nil {
+			return fmt.Errorf("Failed to count rows in table (%s) - %v", table, err)
+		}
+		manifest.RowCounts[table] = count
+	}
+
+	for _, statement := range []string{"ANALYZE", "VACUUM"} {
+		err = snapshotDatabase.Exec(statement).Error
+		if err != nil {
+			return fmt.Errorf("Failed to %s snapshot - %v", strings.ToLower(statement), err)
+		}
+	}
+	return nil
+}
+
+func sha256File(filePath string) (string, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
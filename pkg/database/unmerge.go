@@ -0,0 +1,339 @@
+package database
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// UnmergeRequest selects the identifiers, locations & endpoints to split out of an organization.
+type UnmergeRequest struct {
+	OrganizationID string // the organization to split
+
+	// RevisionID is the (bad) merge revision of the organization. Everything it added, that is still associated with the
+	// organization, is split out. The organization that was merged in is restored, if its id is known.
+	RevisionID uint
+	// TargetOrganizationID is the organization to split into, it is created if it does not exist.
+	// Defaults to the organization that was merged in by RevisionID, otherwise a new id is generated.
+	TargetOrganizationID string
+
+	// additional identifiers, locations & endpoints to split out
+	Identifiers []models.OrganizationIdentifier
+	LocationIDs []string
+	EndpointIDs []string
+
+	Reason string
+}
+
+// UnmergeOrganization splits the selected identifiers, locations & endpoints (and their provenance) out of an organization,
+// into a new or restored organization. Both organizations are blocked from being joined again (see OrganizationMergeBlock),
+// and any match between them is rejected. Returns the split out organization.
+func (sr *SqliteRepository) UnmergeOrganization(request UnmergeRequest, source string) (*models.Organization, error) {
+	var written models.Organization
+	err := sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		var existing models.Organization
+		err := preloadOrganization(tx).First(&existing, "id = ?", request.OrganizationID).Error
+		if err != nil {
+			return fmt.Errorf("Failed to find organization (%s) to unmerge - %v", request.OrganizationID, err)
+		}
+
+		targetOrgId := request.TargetOrganizationID
+		if request.RevisionID != 0 {
+			var revision models.OrganizationRevision
+			err = tx.First(&revision, "id = ? AND organization_id = ?", request.RevisionID, existing.ID).Error
+			if err != nil {
+				return fmt.Errorf("Failed to find revision %d of organization (%s) - %v", request.RevisionID, existing.ID, err)
+			}
+			if revision.Action != models.OrganizationRevisionActionMerge {
+				return fmt.Errorf("Revision %d of organization (%s) is not a merge", revision.ID, existing.ID)
+			}
+			request.Identifiers = append(request.Identifiers, revision.Diff.AddedOrganizationIdentifiers...)
+			for ndx := range revision.Diff.AddedAttributeIdentifiers {
+				request.Identifiers = append(request.Identifiers, revision.Diff.AddedAttributeIdentifiers[ndx].Identifier())
+			}
+			for _, loc := range revision.Diff.AddedLocations {
+				request.LocationIDs = append(request.LocationIDs, loc.ID)
+			}
+			for _, end := range revision.Diff.AddedEndpoints {
+				request.EndpointIDs = append(request.EndpointIDs, end.ID)
+			}
+			if targetOrgId == "" {
+				targetOrgId = revision.RelatedOrganizationID
+			}
+		}
+		if targetOrgId == "" {
+			targetOrgId = fmt.Sprintf("%s-unmerge-%s", existing.ID, sr.RunID)
+		}
+		if targetOrgId == existing.ID {
+			return fmt.Errorf("Cannot unmerge organization (%s) into itself", existing.ID)
+		}
+
+		selected := selectUnmerge(&existing, &request)
+		if len(selected.OrganizationIdentifiers) == 0 && len(selected.AttributeIdentifiers) == 0 && len(selected.Locations) == 0 && len(selected.Endpoints) == 0 {
+			return fmt.Errorf("Nothing to unmerge from organization (%s), the selected values are not associated with it", existing.ID)
+		}
+		if len(selected.OrganizationIdentifiers) == len(existing.OrganizationIdentifiers) {
+			return fmt.Errorf("Cannot unmerge every identifier of organization (%s)", existing.ID)
+		}
+
+		var target *models.Organization
+		var existingTarget models.Organization
+		err = preloadOrganization(tx).Limit(1).Find(&existingTarget, "id = ?", targetOrgId).Error
+		if err != nil {
+			return err
+		} else if existingTarget.ID != "" {
+			target = &existingTarget
+		} else {
+			err = tx.Omit(clause.Associations).Create(unmergedOrganization(targetOrgId, &existing, selected, source)).Error
+			if err != nil {
+				return fmt.Errorf("Failed to create unmerged organization (%s) - %v", targetOrgId, err)
+			}
+		}
+
+		err = moveOrganizationAssociations(tx, existing.ID, targetOrgId, selected)
+		if err != nil {
+			return err
+		}
+		err = createOrganizationMergeBlocks(tx, &existing, targetOrgId, selected, request.Reason)
+		if err != nil {
+			return err
+		}
+
+		// the matcher must not link the organizations again
+		err = tx.Model(&models.OrganizationMatch{}).
+			Where("(source_organization_id = ? AND candidate_organization_id = ?) OR (source_organization_id = ? AND candidate_organization_id = ?)", targetOrgId, existing.ID, existing.ID, targetOrgId).
+			Updates(map[string]interface{}{"status": models.OrganizationMatchStatusRejected, "reviewed_at": time.Now()}).Error
+		if err != nil {
+			return fmt.Errorf("Failed to reject organization matches (%s, %s) - %v", existing.ID, targetOrgId, err)
+		}
+
+		var remaining models.Organization
+		err = preloadOrganization(tx).First(&remaining, "id = ?", existing.ID).Error
+		if err != nil {
+			return err
+		}
+		err = sr.recordOrganizationRevision(tx, models.OrganizationRevisionActionUnmerge, &existing, &remaining, source, targetOrgId)
+		if err != nil {
+			return err
+		}
+		err = preloadOrganization(tx).First(&written, "id = ?", targetOrgId).Error
+		if err != nil {
+			return err
+		}
+		return sr.recordOrganizationRevision(tx, models.OrganizationRevisionActionUnmerge, target, &written, source, existing.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &written, nil
+}
+
+// IsOrganizationMergeBlocked returns true if the organizations must not be joined, because either organization is
+// blocked from one of the other organization's identifiers (see UnmergeOrganization).
+func (sr *SqliteRepository) IsOrganizationMergeBlocked(orgA *models.Organization, orgB *models.Organization) (bool, error) {
+	return organizationsMergeBlocked(sr.GormReadClient, orgA, orgB)
+}
+
+func organizationsMergeBlocked(tx *gorm.DB, orgA *models.Organization, orgB *models.Organization) (bool, error) {
+	var blocks []models.OrganizationMergeBlock
+	err := tx.Where("organization_id IN ?", []string{orgA.ID, orgB.ID}).Find(&blocks).Error
+	if err != nil {
+		return false, fmt.Errorf("Failed to find organization merge blocks (%s, %s) - %v", orgA.ID, orgB.ID, err)
+	}
+	for ndx := range blocks {
+		otherOrg := orgB
+		if blocks[ndx].OrganizationID == orgB.ID {
+			otherOrg = orgA
+		}
+		for identifierNdx := range otherOrg.OrganizationIdentifiers {
+			if blocks[ndx].Blocks(&otherOrg.OrganizationIdentifiers[identifierNdx]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// organizationMergeBlocked returns true if a record with the identifiers must not be joined into the organization, which
+// was found using the matchedBy identifier.
+// Blocks on names are ignored if the organization was found using a stronger (non-name) identifier, so that records
+// are never turned away from the organization that owns their NPI because of a shared alias.
+func (sr *SqliteRepository) organizationMergeBlocked(orgId string, matchedBy *models.OrganizationIdentifier, identifiers []models.OrganizationIdentifier) (bool, error) {
+	var blocks []models.OrganizationMergeBlock
+	err := sr.GormReadClient.Where(models.OrganizationMergeBlock{OrganizationID: orgId}).Find(&blocks).Error
+	if err != nil {
+		return false, fmt.Errorf("Failed to find organization merge blocks (%s) - %v", orgId, err)
+	}
+	for ndx := range blocks {
+		if matchedBy.IdentifierType != models.OrganizationIdentifierTypeName && blocks[ndx].IdentifierType == models.OrganizationIdentifierTypeName {
+			continue
+		}
+		for identifierNdx := range identifiers {
+			if blocks[ndx].Blocks(&identifiers[identifierNdx]) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// selectUnmerge returns the requested identifiers, locations & endpoints that are associated with the organization
+func selectUnmerge(org *models.Organization, request *UnmergeRequest) *models.Organization {
+	selected := models.Organization{}
+	for _, identifier := range org.OrganizationIdentifiers {
+		for ndx := range request.Identifiers {
+			if identifier.Equal(&request.Identifiers[ndx]) {
+				selected.OrganizationIdentifiers = append(selected.OrganizationIdentifiers, identifier)
+				break
+			}
+		}
+	}
+	for _, attr := range org.AttributeIdentifiers {
+		identifier := attr.Identifier()
+		for ndx := range request.Identifiers {
+			if identifier.Equal(&request.Identifiers[ndx]) {
+				selected.AttributeIdentifiers = append(selected.AttributeIdentifiers, attr)
+				break
+			}
+		}
+	}
+	for _, loc := range org.Locations {
+		for _, locId := range request.LocationIDs {
+			if loc.ID == locId {
+				selected.Locations = append(selected.Locations, loc)
+				break
+			}
+		}
+	}
+	for _, end := range org.Endpoints {
+		for _, endId := range request.EndpointIDs {
+			if end.ID == endId {
+				selected.Endpoints = append(selected.Endpoints, end)
+				break
+			}
+		}
+	}
+	return &selected
+}
+
+// unmergedOrganization is the new organization, named after the first selected name identifier
+func unmergedOrganization(orgId string, existing *models.Organization, selected *models.Organization, source string) *models.Organization {
+	org := models.Organization{
+		ID:               orgId,
+		OrganizationType: existing.OrganizationType,
+		Name:             existing.Name,
+		Source:           source,
+	}
+	for _, identifier := range selected.OrganizationIdentifiers {
+		if identifier.IdentifierType != models.OrganizationIdentifierTypeName {
+			continue
+		}
+		org.Name = identifier.IdentifierDisplay
+		if org.Name == "" {
+			org.Name = identifier.IdentifierValue
+		}
+		break
+	}
+	return &org
+}
+
+// moveOrganizationAssociations moves the selected identifiers, locations & endpoints (and their provenance) to the target organization
+func moveOrganizationAssociations(tx *gorm.DB, orgId string, targetOrgId string, selected *models.Organization) error {
+	type provenanceKey struct {
+		fieldType models.ProvenanceFieldType
+		fieldKey  string
+	}
+	var provenanceKeys []provenanceKey
+
+	for _, identifier := range selected.OrganizationIdentifiers {
+		err := tx.Model(&models.OrganizationIdentifier{}).
+			Where("identifier_type = ? AND identifier_value = ? AND organization_id = ?", identifier.IdentifierType, identifier.IdentifierValue, orgId).
+			Update("organization_id", targetOrgId).Error
+		if err != nil {
+			return fmt.Errorf("Failed to unmerge organization identifier (%s) - %v", models.IdentifierProvenanceKey(&identifier), err)
+		}
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeName {
+			provenanceKeys = append(provenanceKeys, provenanceKey{models.ProvenanceFieldTypeName, identifier.IdentifierValue})
+		} else {
+			provenanceKeys = append(provenanceKeys, provenanceKey{models.ProvenanceFieldTypeIdentifier, models.IdentifierProvenanceKey(&identifier)})
+		}
+	}
+
+	// attribute identifiers may already exist on the target organization, so duplicates are ignored, then removed.
+	for _, attr := range selected.AttributeIdentifiers {
+		err := tx.Exec("UPDATE OR IGNORE organization_attribute_identifiers SET organization_id = ? WHERE organization_id = ? AND identifier_type = ? AND identifier_value = ?",
+			targetOrgId, orgId, attr.IdentifierType, attr.IdentifierValue).Error
+		if err == nil {
+			err = tx.Exec("DELETE FROM organization_attribute_identifiers WHERE organization_id = ? AND identifier_type = ? AND identifier_value = ?",
+				orgId, attr.IdentifierType, attr.IdentifierValue).Error
+		}
+		identifier := attr.Identifier()
+		if err != nil {
+			return fmt.Errorf("Failed to unmerge organization attribute identifier (%s) - %v", models.IdentifierProvenanceKey(&identifier), err)
+		}
+		provenanceKeys = append(provenanceKeys, provenanceKey{models.ProvenanceFieldTypeIdentifier, models.IdentifierProvenanceKey(&identifier)})
+	}
+
+	for _, loc := range selected.Locations {
+		err := tx.Exec("INSERT OR IGNORE INTO org_locations (organization_id, location_id) VALUES (?, ?)", targetOrgId, loc.ID).Error
+		if err == nil {
+			err = tx.Exec("DELETE FROM org_locations WHERE organization_id = ? AND location_id = ?", orgId, loc.ID).Error
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to unmerge location (%s) - %v", loc.ID, err)
+		}
+		provenanceKeys = append(provenanceKeys, provenanceKey{models.ProvenanceFieldTypeLocation, loc.ID})
+	}
+
+	for _, end := range selected.Endpoints {
+		err := tx.Model(&models.Endpoint{}).
+			Where("id = ? AND organization_id = ?", end.ID, orgId).
+			Update("organization_id", targetOrgId).Error
+		if err != nil {
+			return fmt.Errorf("Failed to unmerge endpoint (%s) - %v", end.URL, err)
+		}
+		provenanceKeys = append(provenanceKeys, provenanceKey{models.ProvenanceFieldTypeEndpoint, end.ID})
+	}
+
+	// provenance may already exist on the target organization, so duplicates are ignored, then removed.
+	for _, key := range provenanceKeys {
+		err := tx.Exec("UPDATE OR IGNORE organization_provenances SET organization_id = ? WHERE organization_id = ? AND field_type = ? AND field_key = ?",
+			targetOrgId, orgId, key.fieldType, key.fieldKey).Error
+		if err == nil {
+			err = tx.Exec("DELETE FROM organization_provenances WHERE organization_id = ? AND field_type = ? AND field_key = ?",
+				orgId, key.fieldType, key.fieldKey).Error
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to unmerge organization provenance (%s: %s) - %v", key.fieldType, key.fieldKey, err)
+		}
+	}
+	return nil
+}
+
+// createOrganizationMergeBlocks blocks the split out identifiers from the organization, and the identifiers remaining on
+// the organization from the target organization.
+func createOrganizationMergeBlocks(tx *gorm.DB, existing *models.Organization, targetOrgId string, selected *models.Organization, reason string) error {
+	var blocks []models.OrganizationMergeBlock
+	for _, identifier := range existing.OrganizationIdentifiers {
+		block := models.OrganizationMergeBlock{
+			OrganizationID:  targetOrgId,
+			IdentifierType:  identifier.IdentifierType,
+			IdentifierValue: identifier.IdentifierValue,
+			Reason:          reason,
+		}
+		for _, selectedIdentifier := range selected.OrganizationIdentifiers {
+			if identifier.Equal(&selectedIdentifier) {
+				block.OrganizationID = existing.ID
+				break
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&blocks).Error
+	if err != nil {
+		return fmt.Errorf("Failed to create organization merge blocks (%s, %s) - %v", existing.ID, targetOrgId, err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	testPrimaryNPI   = models.OrganizationIdentifier{IdentifierType: models.OrganizationIdentifierTypePrimaryNPI, IdentifierValue: "1111111111"}
+	testMergedNPI    = models.OrganizationIdentifier{IdentifierType: models.OrganizationIdentifierTypeNPI, IdentifierValue: "1222222222"}
+	testStateLicense = models.OrganizationAttributeIdentifier{IdentifierType: models.OrganizationIdentifierTypeStateLicense, IdentifierValue: "CA:123456", IdentifierDisplay: "123456", IdentifierState: "CA"}
+	testEndpointURL  = "https://fhir.alpha.example.com/R4/"
+)
+
+// newTestRepository creates a new (empty) database
+func newTestRepository(t *testing.T) *SqliteRepository {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	config := DefaultRepositoryConfig()
+	config.DatabaseLocation = filepath.Join(t.TempDir(), "database-test.db")
+	repository, err := NewRepository(config, logger)
+	if err != nil {
+		t.Fatalf("failed to create the test database: %v", err)
+	}
+	t.Cleanup(func() { repository.Close() })
+	return repository
+}
+
+// testMergedRecord shares its name with org-a, so it is merged into org-a, adding its NPI, state license & endpoint
+func testMergedRecord(orgId string) *models.Organization {
+	org := &models.Organization{
+		ID:     orgId,
+		Name:   "ALPHA CLINIC",
+		Source: "test",
+		OrganizationIdentifiers: []models.OrganizationIdentifier{
+			{IdentifierType: models.OrganizationIdentifierTypeName, IdentifierValue: "ALPHA CLINIC"},
+			testMergedNPI,
+		},
+		AttributeIdentifiers: []models.OrganizationAttributeIdentifier{testStateLicense},
+		Endpoints:            []models.Endpoint{{URL: testEndpointURL, PlatformType: "epic"}},
+	}
+	org.AddProvenance(models.Provenance{SourceDataset: "test", SourceFile: "org-b.csv", ReleaseDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)})
+	return org
+}
+
+// newMergedTestRepository creates org-a, and merges org-b into it. Returns the merge revision of org-a.
+func newMergedTestRepository(t *testing.T) (*SqliteRepository, *models.OrganizationRevision) {
+	repository := newTestRepository(t)
+	org := &models.Organization{
+		ID:     "org-a",
+		Name:   "ALPHA CLINIC",
+		Source: "test",
+		OrganizationIdentifiers: []models.OrganizationIdentifier{
+			{IdentifierType: models.OrganizationIdentifierTypeName, IdentifierValue: "ALPHA CLINIC"},
+			testPrimaryNPI,
+		},
+	}
+	org.AddProvenance(models.Provenance{SourceDataset: "test", SourceFile: "org-a.csv", ReleaseDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+	if _, _, err := repository.MergeOrganization(org, "test"); err != nil {
+		t.Fatalf("failed to create org-a: %v", err)
+	}
+	merged, _, err := repository.MergeOrganization(testMergedRecord("org-b"), "test")
+	if err != nil {
+		t.Fatalf("failed to merge org-b: %v", err)
+	} else if merged.ID != "org-a" {
+		t.Fatalf("expected org-b to be merged into org-a, got %q", merged.ID)
+	}
+
+	revisions, err := repository.ListOrganizationRevisions("org-a")
+	if err != nil {
+		t.Fatalf("failed to list revisions: %v", err)
+	}
+	for ndx := range revisions {
+		if revisions[ndx].Action == models.OrganizationRevisionActionMerge {
+			return repository, &revisions[ndx]
+		}
+	}
+	t.Fatalf("expected a merge revision for org-a, got %v", revisions)
+	return nil, nil
+}
+
+// findTestOrganization returns the organization with all of its associations
+func findTestOrganization(t *testing.T, repository *SqliteRepository, orgId string) *models.Organization {
+	var org models.Organization
+	if err := preloadOrganization(repository.GormReadClient).First(&org, "id = ?", orgId).Error; err != nil {
+		t.Fatalf("failed to find organization (%s): %v", orgId, err)
+	}
+	return &org
+}
+
+func hasAttributeIdentifier(org *models.Organization, attr models.OrganizationAttributeIdentifier) bool {
+	for ndx := range org.AttributeIdentifiers {
+		if org.AttributeIdentifiers[ndx].Equal(&attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestUnmergeOrganization_Revision(t *testing.T) {
+	repository, revision := newMergedTestRepository(t)
+	if revision.RelatedOrganizationID != "org-b" {
+		t.Fatalf("expected the merge revision to be related to org-b, got %q", revision.RelatedOrganizationID)
+	}
+
+	unmerged, err := repository.UnmergeOrganization(UnmergeRequest{OrganizationID: "org-a", RevisionID: revision.ID, Reason: "bad merge"}, "test")
+	if err != nil {
+		t.Fatalf("failed to unmerge: %v", err)
+	}
+	// the organization that was merged in is restored
+	if unmerged.ID != "org-b" {
+		t.Errorf("expected the unmerged organization to be org-b, got %q", unmerged.ID)
+	}
+	remaining := findTestOrganization(t, repository, "org-a")
+
+	if !hasIdentifier(unmerged.OrganizationIdentifiers, &testMergedNPI) || hasIdentifier(remaining.OrganizationIdentifiers, &testMergedNPI) {
+		t.Errorf("expected the merged NPI to be moved to org-b, got %v and %v", unmerged.OrganizationIdentifiers, remaining.OrganizationIdentifiers)
+	}
+	if !hasAttributeIdentifier(unmerged, testStateLicense) || hasAttributeIdentifier(remaining, testStateLicense) {
+		t.Errorf("expected the state license to be moved to org-b, got %v and %v", unmerged.AttributeIdentifiers, remaining.AttributeIdentifiers)
+	}
+	if len(unmerged.Endpoints) != 1 || len(remaining.Endpoints) != 0 {
+		t.Errorf("expected the endpoint to be moved to org-b, got %v and %v", unmerged.Endpoints, remaining.Endpoints)
+	}
+	// identifiers that were not added by the merge stay on the organization
+	if !hasIdentifier(remaining.OrganizationIdentifiers, &testPrimaryNPI) || hasIdentifier(unmerged.OrganizationIdentifiers, &testPrimaryNPI) {
+		t.Errorf("expected the primary NPI to remain on org-a, got %v", remaining.OrganizationIdentifiers)
+	}
+
+	license := testStateLicense.Identifier()
+	for _, fieldKey := range []string{models.IdentifierProvenanceKey(&testMergedNPI), models.IdentifierProvenanceKey(&license)} {
+		for _, testCase := range []struct {
+			orgId    string
+			expected int
+		}{{"org-a", 0}, {"org-b", 1}} {
+			provenance, err := repository.FindOrganizationProvenance(models.OrganizationProvenance{OrganizationID: testCase.orgId, FieldType: models.ProvenanceFieldTypeIdentifier, FieldKey: fieldKey})
+			if err != nil {
+				t.Fatalf("failed to find provenance: %v", err)
+			}
+			if len(provenance) != testCase.expected {
+				t.Errorf("expected %d provenance entries for %s on %s, got %d", testCase.expected, fieldKey, testCase.orgId, len(provenance))
+			}
+		}
+	}
+
+	for _, orgId := range []string{"org-a", "org-b"} {
+		revisions, err := repository.ListOrganizationRevisions(orgId)
+		if err != nil {
+			t.Fatalf("failed to list revisions: %v", err)
+		}
+		if len(revisions) == 0 || revisions[len(revisions)-1].Action != models.OrganizationRevisionActionUnmerge {
+			t.Errorf("expected an unmerge revision for %s, got %v", orgId, revisions)
+		}
+	}
+}
+
+func TestUnmergeOrganization_EveryIdentifier(t *testing.T) {
+	repository, _ := newMergedTestRepository(t)
+	existing := findTestOrganization(t, repository, "org-a")
+
+	_, err := repository.UnmergeOrganization(UnmergeRequest{OrganizationID: "org-a", Identifiers: existing.OrganizationIdentifiers}, "test")
+	if err == nil || !strings.Contains(err.Error(), "Cannot unmerge every identifier") {
+		t.Fatalf("expected an error when unmerging every identifier, got %v", err)
+	}
+	remaining := findTestOrganization(t, repository, "org-a")
+	if len(remaining.OrganizationIdentifiers) != len(existing.OrganizationIdentifiers) {
+		t.Errorf("expected org-a to be unchanged, got %v", remaining.OrganizationIdentifiers)
+	}
+}
+
+func TestUnmergeOrganization_NextImport(t *testing.T) {
+	repository, revision := newMergedTestRepository(t)
+	if _, err := repository.UnmergeOrganization(UnmergeRequest{OrganizationID: "org-a", RevisionID: revision.ID}, "test"); err != nil {
+		t.Fatalf("failed to unmerge: %v", err)
+	}
+
+	// the record's name still belongs to org-a, but org-a is blocked from the record's NPI
+	found, err := repository.FindOrganizationByIdentifiers(testMergedRecord("org-b").OrganizationIdentifiers)
+	if err != nil {
+		t.Fatalf("failed to find the organization: %v", err)
+	}
+	if found.ID != "org-b" {
+		t.Errorf("expected the record to be found on org-b, got %q", found.ID)
+	}
+
+	// a new record (with a new id) is merged into the split out organization
+	merged, _, err := repository.MergeOrganization(testMergedRecord("org-c"), "test")
+	if err != nil {
+		t.Fatalf("failed to merge org-c: %v", err)
+	}
+	if merged.ID != "org-b" {
+		t.Errorf("expected org-c to be merged into org-b, got %q", merged.ID)
+	}
+	remaining := findTestOrganization(t, repository, "org-a")
+	if hasIdentifier(remaining.OrganizationIdentifiers, &testMergedNPI) || hasAttributeIdentifier(remaining, testStateLicense) || len(remaining.Endpoints) != 0 {
+		t.Errorf("expected org-a to stay split, got %v, %v and %v", remaining.OrganizationIdentifiers, remaining.AttributeIdentifiers, remaining.Endpoints)
+	}
+}
+
+func TestUnmergeOrganization_RejectsMatches(t *testing.T) {
+	repository, revision := newMergedTestRepository(t)
+	match := models.OrganizationMatch{SourceOrganizationID: "org-b", CandidateOrganizationID: "org-a", Score: 0.9, Status: models.OrganizationMatchStatusPending}
+	if err := repository.SaveOrganizationMatch(&match); err != nil {
+		t.Fatalf("failed to save the match: %v", err)
+	}
+	if _, err := repository.UnmergeOrganization(UnmergeRequest{OrganizationID: "org-a", RevisionID: revision.ID}, "test"); err != nil {
+		t.Fatalf("failed to unmerge: %v", err)
+	}
+
+	matches, err := repository.ListOrganizationMatches("org-b", "")
+	if err != nil {
+		t.Fatalf("failed to list matches: %v", err)
+	}
+	if len(matches) != 1 || matches[0].Status != models.OrganizationMatchStatusRejected {
+		t.Errorf("expected the match to be rejected, got %v", matches)
+	}
+
+	// accepting the match (or linking the organizations directly) must not join them again
+	if _, err := repository.ReviewOrganizationMatch(match.ID, models.OrganizationMatchStatusAccepted); err == nil || !strings.Contains(err.Error(), "they were unmerged") {
+		t.Errorf("expected accepting the match to fail, got %v", err)
+	}
+	if err := repository.LinkOrganizations("org-b", "org-a", models.SourceMatching); err == nil || !strings.Contains(err.Error(), "they were unmerged") {
+		t.Errorf("expected linking the organizations to fail, got %v", err)
+	}
+	if _, err := repository.FindOrganizationById("org-b"); err != nil {
+		t.Errorf("expected org-b to still exist, got %v", err)
+	}
+}
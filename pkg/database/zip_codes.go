@@ -0,0 +1,77 @@
+package database
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"golang.org/x/exp/slices"
+	"gorm.io/gorm"
+)
+
+// ReplaceZipCodes replaces the ZIP code reference table
+func (sr *SqliteRepository) ReplaceZipCodes(zipCodes []models.ZipCode) error {
+	return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&models.ZipCode{}).Error
+		if err != nil {
+			return fmt.Errorf("Failed to remove ZIP codes - %v", err)
+		}
+		if len(zipCodes) == 0 {
+			return nil
+		}
+		err = tx.CreateInBatches(zipCodes, 1000).Error
+		if err != nil {
+			return fmt.Errorf("Failed to create ZIP codes - %v", err)
+		}
+		return nil
+	})
+}
+
+// ValidateLocations flags every location with a postal code, city or state that does not match the ZIP code reference
+// table (see models.ValidateLocation). Locations are never removed. If the reference table is empty, locations are not
+// validated.
+func (sr *SqliteRepository) ValidateLocations() error {
+	var zipCodes []models.ZipCode
+	err := sr.GormClient.Find(&zipCodes).Error
+	if err != nil {
+		return fmt.Errorf("Failed to load ZIP codes - %v", err)
+	}
+	if len(zipCodes) == 0 {
+		sr.Logger.Warnf("ZIP code reference table is empty, skipping location validation")
+		return nil
+	}
+	zipCodeLookup := map[string][]models.ZipCode{}
+	for _, zipCode := range zipCodes {
+		zipCodeLookup[zipCode.ZipCode] = append(zipCodeLookup[zipCode.ZipCode], zipCode)
+	}
+
+	flagged := 0
+	var locations []models.Location
+	err = sr.GormClient.FindInBatches(&locations, 10000, func(tx *gorm.DB, batch int) error {
+		return sr.GormClient.Transaction(func(tx *gorm.DB) error {
+			for ndx := range locations {
+				zip := locations[ndx].PostalCode
+				if len(zip) > 5 {
+					zip = zip[:5]
+				}
+				flags := models.ValidateLocation(&locations[ndx], zipCodeLookup[zip])
+				if len(flags) > 0 {
+					flagged++
+				}
+				if slices.Equal(flags, locations[ndx].ValidationFlags) {
+					continue
+				}
+				err := tx.Model(&locations[ndx]).
+					Select("validation_flags").
+					Updates(&models.Location{ValidationFlags: flags}).Error
+				if err != nil {
+					return fmt.Errorf("Failed to update location (%s) - %v", locations[ndx].ID, err)
+				}
+			}
+			return nil
+		})
+	}).Error
+	if err != nil {
+		return err
+	}
+	sr.Logger.Infof("Validated locations against %d ZIP codes, %d locations flagged", len(zipCodeLookup), flagged)
+	return nil
+}
@@ -0,0 +1,210 @@
+package export
+
+import (
+	"encoding/json"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	CatalogBrandsFilename    = "catalog_brands.json"
+	CatalogPortalsFilename   = "catalog_portals.json"
+	CatalogEndpointsFilename = "catalog_endpoints.json"
+)
+
+// CatalogBrand is the organization a patient searches for in the Fasten app
+type CatalogBrand struct {
+	Id           string           `json:"id"`
+	Name         string           `json:"name"`
+	Aliases      []string         `json:"aliases,omitempty"`
+	Identifiers  []FhirIdentifier `json:"identifiers,omitempty"`
+	Locations    []FhirAddress    `json:"locations,omitempty"`
+	BrandWebsite string           `json:"brand_website,omitempty"`
+	PortalIds    []string         `json:"portal_ids"`
+	LastUpdated  string           `json:"last_updated,omitempty"`
+}
+
+// CatalogPortal is the patient portal a patient logs in to, and the FHIR endpoints behind it. Each brand currently has
+// a single portal, with the brand's id.
+type CatalogPortal struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	Url          string   `json:"url,omitempty"`
+	PortalVendor string   `json:"portal_vendor,omitempty"`
+	EndpointIds  []string `json:"endpoint_ids"`
+	LastUpdated  string   `json:"last_updated,omitempty"`
+}
+
+type CatalogEndpoint struct {
+	Id           string `json:"id"`
+	Url          string `json:"url"`
+	PlatformType string `json:"platform_type,omitempty"`
+	SourceUrl    string `json:"source_url,omitempty"`
+}
+
+// CatalogExporter renders Organizations with endpoints in the fasten-sources catalog format: brands, portals & endpoints,
+// each written as a JSON array. Entries (and every list inside them) are sorted, and no export timestamps are written,
+// so exporting the same database twice produces identical files.
+type CatalogExporter struct {
+	OutputDir string
+
+	brands    []CatalogBrand
+	portals   []CatalogPortal
+	endpoints map[string]CatalogEndpoint
+}
+
+func NewCatalogExporter(outputDir string) (*CatalogExporter, error) {
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &CatalogExporter{
+		OutputDir: outputDir,
+		brands:    []CatalogBrand{},
+		portals:   []CatalogPortal{},
+		endpoints: map[string]CatalogEndpoint{},
+	}, nil
+}
+
+// ExportOrganization adds the organization to the catalog. Hidden organizations, and organizations without (visible)
+// endpoints are skipped, since they cannot be connected to.
+func (ce *CatalogExporter) ExportOrganization(org *models.Organization) {
+	if org.Hidden || len(visibleEndpoints(org.Endpoints)) == 0 {
+		return
+	}
+	brand, portal, endpoints := OrganizationToCatalog(org)
+	ce.brands = append(ce.brands, brand)
+	ce.portals = append(ce.portals, portal)
+	for _, endpoint := range endpoints {
+		ce.endpoints[endpoint.Id] = endpoint
+	}
+}
+
+// Close sorts the catalog and writes the brands, portals & endpoints files
+func (ce *CatalogExporter) Close() (CatalogSummary, error) {
+	sort.Slice(ce.brands, func(i, j int) bool {
+		return ce.brands[i].Id < ce.brands[j].Id
+	})
+	sort.Slice(ce.portals, func(i, j int) bool {
+		return ce.portals[i].Id < ce.portals[j].Id
+	})
+	endpoints := []CatalogEndpoint{}
+	for _, endpoint := range ce.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return endpoints[i].Id < endpoints[j].Id
+	})
+
+	summary := CatalogSummary{Brands: len(ce.brands), Portals: len(ce.portals), Endpoints: len(endpoints)}
+	for filename, entries := range map[string]interface{}{
+		CatalogBrandsFilename:    ce.brands,
+		CatalogPortalsFilename:   ce.portals,
+		CatalogEndpointsFilename: endpoints,
+	} {
+		entriesJson, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return summary, err
+		}
+		err = os.WriteFile(filepath.Join(ce.OutputDir, filename), append(entriesJson, '\n'), 0644)
+		if err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+type CatalogSummary struct {
+	Brands    int
+	Portals   int
+	Endpoints int
+}
+
+// OrganizationToCatalog converts an Organization (with preloaded associations) into a catalog brand, its portal & endpoints
+func OrganizationToCatalog(org *models.Organization) (CatalogBrand, CatalogPortal, []CatalogEndpoint) {
+	var lastUpdated string
+	if !org.SourceUpdatedAt.IsZero() {
+		lastUpdated = org.SourceUpdatedAt.UTC().Format(time.RFC3339)
+	}
+
+	brand := CatalogBrand{
+		Id:          org.ID,
+		Name:        org.Name,
+		Identifiers: fhirIdentifiers(org.AllIdentifiers()),
+		PortalIds:   []string{org.ID},
+		LastUpdated: lastUpdated,
+	}
+	aliases := map[string]bool{}
+	for _, identifier := range org.OrganizationIdentifiers {
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeName && identifier.IdentifierDisplay != "" && identifier.IdentifierDisplay != org.Name {
+			aliases[identifier.IdentifierDisplay] = true
+		}
+	}
+	for alias := range aliases {
+		brand.Aliases = append(brand.Aliases, alias)
+	}
+	sort.Strings(brand.Aliases)
+	sort.SliceStable(brand.Identifiers, func(i, j int) bool {
+		idA, idB := brand.Identifiers[i], brand.Identifiers[j]
+		if (idA.Use == "official") != (idB.Use == "official") {
+			return idA.Use == "official"
+		} else if idA.System != idB.System {
+			return idA.System < idB.System
+		}
+		return idA.Value < idB.Value
+	})
+
+	locations := append([]models.Location{}, org.Locations...)
+	sort.Slice(locations, func(i, j int) bool {
+		return locations[i].ID < locations[j].ID
+	})
+	for _, loc := range locations {
+		postalCode := loc.PostalCode
+		if loc.PostalCodeExtension != "" {
+			postalCode = postalCode + "-" + loc.PostalCodeExtension
+		}
+		brand.Locations = append(brand.Locations, FhirAddress{
+			Line:       loc.Line,
+			City:       loc.City,
+			State:      loc.State,
+			PostalCode: postalCode,
+			Country:    loc.Country,
+		})
+	}
+
+	portal := CatalogPortal{
+		Id:          org.ID,
+		Name:        org.Name,
+		EndpointIds: []string{},
+		LastUpdated: lastUpdated,
+	}
+	relatedUrls := models.ClassifyRelatedUrls(org.RelatedUrls)
+	sort.Slice(relatedUrls, func(i, j int) bool {
+		return relatedUrls[i].URL < relatedUrls[j].URL
+	})
+	for _, relatedUrl := range relatedUrls {
+		if relatedUrl.Kind == models.RelatedUrlKindHomepage && brand.BrandWebsite == "" {
+			brand.BrandWebsite = relatedUrl.URL
+		} else if relatedUrl.Kind == models.RelatedUrlKindPatientPortal && portal.Url == "" {
+			portal.Url = relatedUrl.URL
+			portal.PortalVendor = string(relatedUrl.PortalVendor)
+		}
+	}
+
+	var endpoints []CatalogEndpoint
+	for _, end := range visibleEndpoints(org.Endpoints) {
+		endpoints = append(endpoints, CatalogEndpoint{
+			Id:           end.ID,
+			Url:          end.URL,
+			PlatformType: end.PlatformType,
+			SourceUrl:    end.SourceUrl,
+		})
+		portal.EndpointIds = append(portal.EndpointIds, end.ID)
+	}
+	sort.Strings(portal.EndpointIds)
+
+	return brand, portal, endpoints
+}
@@ -0,0 +1,334 @@
+package export
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	FhirResourceTypeOrganization = "Organization"
+	FhirResourceTypeLocation     = "Location"
+	FhirResourceTypeEndpoint     = "Endpoint"
+)
+
+var fhirResourceTypes = []string{FhirResourceTypeOrganization, FhirResourceTypeLocation, FhirResourceTypeEndpoint}
+
+// FhirExporter renders Organizations (and their Locations & Endpoints) as FHIR R4 resources, written as
+// Bulk Data style NDJSON files (one file per resource type) with a manifest.json.
+type FhirExporter struct {
+	OutputDir string
+
+	files   map[string]*os.File
+	writers map[string]*bufio.Writer
+	counts  map[string]int
+}
+
+func NewFhirExporter(outputDir string) (*FhirExporter, error) {
+	err := os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := FhirExporter{
+		OutputDir: outputDir,
+		files:     map[string]*os.File{},
+		writers:   map[string]*bufio.Writer{},
+		counts:    map[string]int{},
+	}
+	for _, resourceType := range fhirResourceTypes {
+		file, err := os.Create(filepath.Join(outputDir, fhirNdjsonFilename(resourceType)))
+		if err != nil {
+			exporter.close()
+			return nil, err
+		}
+		exporter.files[resourceType] = file
+		exporter.writers[resourceType] = bufio.NewWriter(file)
+	}
+	return &exporter, nil
+}
+
+// ExportOrganization writes the Organization, along with all of its Locations and (visible) Endpoints.
+// Hidden organizations are skipped.
+func (fe *FhirExporter) ExportOrganization(org *models.Organization) error {
+	if org.Hidden {
+		return nil
+	}
+	fhirOrg, fhirLocations, fhirEndpoints := OrganizationToFhir(org)
+
+	err := fe.write(FhirResourceTypeOrganization, fhirOrg)
+	if err != nil {
+		return err
+	}
+	for _, fhirLocation := range fhirLocations {
+		err = fe.write(FhirResourceTypeLocation, fhirLocation)
+		if err != nil {
+			return err
+		}
+	}
+	for _, fhirEndpoint := range fhirEndpoints {
+		err = fe.write(FhirResourceTypeEndpoint, fhirEndpoint)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes all NDJSON files, and writes the manifest
+func (fe *FhirExporter) Close(request string) (*FhirBulkManifest, error) {
+	for _, resourceType := range fhirResourceTypes {
+		err := fe.writers[resourceType].Flush()
+		if err != nil {
+			fe.close()
+			return nil, err
+		}
+	}
+	err := fe.close()
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := FhirBulkManifest{
+		TransactionTime:     time.Now().UTC().Format(time.RFC3339),
+		Request:             request,
+		RequiresAccessToken: false,
+		Output:              []FhirBulkManifestOutput{},
+		Error:               []FhirBulkManifestOutput{},
+	}
+	for _, resourceType := range fhirResourceTypes {
+		manifest.Output = append(manifest.Output, FhirBulkManifestOutput{
+			Type:  resourceType,
+			Url:   fhirNdjsonFilename(resourceType),
+			Count: fe.counts[resourceType],
+		})
+	}
+
+	manifestJson, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, os.WriteFile(filepath.Join(fe.OutputDir, "manifest.json"), manifestJson, 0644)
+}
+
+func (fe *FhirExporter) write(resourceType string, resource interface{}) error {
+	resourceJson, err := json.Marshal(resource)
+	if err != nil {
+		return err
+	}
+	_, err = fe.writers[resourceType].Write(append(resourceJson, '\n'))
+	if err != nil {
+		return fmt.Errorf("error writing %s resource: %v", resourceType, err)
+	}
+	fe.counts[resourceType] += 1
+	return nil
+}
+
+func (fe *FhirExporter) close() error {
+	var closeErr error
+	for _, file := range fe.files {
+		err := file.Close()
+		if err != nil && closeErr == nil {
+			closeErr = err
+		}
+	}
+	return closeErr
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Conversion
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+// OrganizationToFhir converts an Organization (with preloaded associations) into FHIR R4 resources.
+// Locations may be shared by multiple organizations, but a FHIR Location only has a single managingOrganization,
+// so a Location resource is generated for every organization/location pair.
+func OrganizationToFhir(org *models.Organization) (FhirOrganization, []FhirLocation, []FhirEndpoint) {
+	orgReference := FhirReference{
+		Reference: fmt.Sprintf("%s/%s", FhirResourceTypeOrganization, fhirResourceId(org.ID)),
+		Display:   org.Name,
+	}
+
+	fhirOrg := FhirOrganization{
+		ResourceType: FhirResourceTypeOrganization,
+		Id:           fhirResourceId(org.ID),
+		Meta:         fhirMeta(org, org.UpdatedAt),
+		Active:       true,
+		Name:         org.Name,
+	}
+
+	fhirOrg.Identifier = fhirIdentifiers(org.AllIdentifiers())
+	for _, identifier := range org.OrganizationIdentifiers {
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeName && identifier.IdentifierDisplay != "" && identifier.IdentifierDisplay != org.Name {
+			fhirOrg.Alias = append(fhirOrg.Alias, identifier.IdentifierDisplay)
+		}
+	}
+	sort.Strings(fhirOrg.Alias)
+
+	for _, taxonomy := range org.Taxonomy {
+		fhirOrg.Type = append(fhirOrg.Type, FhirCodeableConcept{
+			Coding: []FhirCoding{{System: FhirSystemNUCCTaxonomy, Code: taxonomy}},
+		})
+	}
+
+	var fhirEndpoints []FhirEndpoint
+	var endpointReferences []FhirReference
+	for _, end := range visibleEndpoints(org.Endpoints) {
+		fhirEndpoint := FhirEndpoint{
+			ResourceType: FhirResourceTypeEndpoint,
+			Id:           fhirHashedResourceId(end.ID),
+			Meta:         fhirMeta(org, end.UpdatedAt),
+			Status:       "active",
+			ConnectionType: FhirCoding{
+				System: FhirSystemConnectionType,
+				Code:   "hl7-fhir-rest",
+			},
+			Name:                 org.Name,
+			ManagingOrganization: &orgReference,
+			PayloadType: []FhirCodeableConcept{
+				{Coding: []FhirCoding{{System: FhirSystemPayloadType, Code: "any"}}},
+			},
+			Address: end.URL,
+		}
+		if end.PlatformType != "" {
+			fhirEndpoint.Extension = append(fhirEndpoint.Extension, FhirExtension{Url: FhirExtensionPlatformType, ValueString: end.PlatformType})
+		}
+		if end.SourceUrl != "" {
+			fhirEndpoint.Extension = append(fhirEndpoint.Extension, FhirExtension{Url: FhirExtensionEndpointSource, ValueUri: end.SourceUrl})
+		}
+		fhirEndpoints = append(fhirEndpoints, fhirEndpoint)
+		endpointReferences = append(endpointReferences, FhirReference{
+			Reference: fmt.Sprintf("%s/%s", FhirResourceTypeEndpoint, fhirEndpoint.Id),
+		})
+	}
+	fhirOrg.Endpoint = endpointReferences
+
+	var fhirLocations []FhirLocation
+	for _, loc := range org.Locations {
+		postalCode := loc.PostalCode
+		if loc.PostalCodeExtension != "" {
+			postalCode = postalCode + "-" + loc.PostalCodeExtension
+		}
+		address := FhirAddress{
+			Use:        "work",
+			Type:       "physical",
+			Line:       loc.Line,
+			City:       loc.City,
+			State:      loc.State,
+			PostalCode: postalCode,
+			Country:    loc.Country,
+		}
+		fhirOrg.Address = append(fhirOrg.Address, address)
+		fhirLocations = append(fhirLocations, FhirLocation{
+			ResourceType:         FhirResourceTypeLocation,
+			Id:                   fhirHashedResourceId(org.ID + "|" + loc.ID),
+			Meta:                 fhirMeta(org, loc.UpdatedAt),
+			Status:               "active",
+			Name:                 org.Name,
+			Address:              &address,
+			ManagingOrganization: &orgReference,
+			Endpoint:             endpointReferences,
+		})
+	}
+
+	return fhirOrg, fhirLocations, fhirEndpoints
+}
+
+// fhirIdentifiers maps OrganizationIdentifiers to standard identifier systems. Names are exported as aliases, not identifiers.
+func fhirIdentifiers(identifiers []models.OrganizationIdentifier) []FhirIdentifier {
+	var fhirIds []FhirIdentifier
+	found := map[string]bool{}
+	//primary NPI first, so it is marked as the "official" identifier (the NPI will also be present as a secondary identifier)
+	sortedIdentifiers := append([]models.OrganizationIdentifier{}, identifiers...)
+	sort.SliceStable(sortedIdentifiers, func(i, j int) bool {
+		return sortedIdentifiers[i].IdentifierType == models.OrganizationIdentifierTypePrimaryNPI && sortedIdentifiers[j].IdentifierType != models.OrganizationIdentifierTypePrimaryNPI
+	})
+
+	for _, identifier := range sortedIdentifiers {
+		fhirId := FhirIdentifier{Value: identifier.IdentifierValue}
+		switch identifier.IdentifierType {
+		case models.OrganizationIdentifierTypePrimaryNPI:
+			fhirId.Use = "official"
+			fhirId.System = FhirSystemNPI
+		case models.OrganizationIdentifierTypeNPI:
+			fhirId.System = FhirSystemNPI
+		case models.OrganizationIdentifierTypeEIN:
+			fhirId.System = FhirSystemEIN
+		case models.OrganizationIdentifierTypeCLIA:
+			fhirId.System = FhirSystemCLIA
+		case models.OrganizationIdentifierTypeCCN:
+			fhirId.System = FhirSystemCCN
+		case models.OrganizationIdentifierTypeOID:
+			fhirId.System = FhirSystemURI
+			fhirId.Value = "urn:oid:" + identifier.IdentifierValue
+		default:
+			//state & issuer scoped identifiers (eg. Medicaid ids) have no standard system
+			continue
+		}
+
+		key := fhirId.System + "|" + fhirId.Value
+		if found[key] {
+			continue
+		}
+		found[key] = true
+		fhirIds = append(fhirIds, fhirId)
+	}
+	return fhirIds
+}
+
+// fhirMeta tags each resource with the source datasets the organization was built from
+func fhirMeta(org *models.Organization, lastUpdated time.Time) *FhirMeta {
+	meta := FhirMeta{}
+	if !lastUpdated.IsZero() {
+		meta.LastUpdated = lastUpdated.UTC().Format(time.RFC3339)
+	}
+
+	sourceDatasets := map[string]bool{}
+	for _, provenance := range org.Provenance {
+		sourceDatasets[provenance.SourceDataset] = true
+	}
+	for sourceDataset := range sourceDatasets {
+		meta.Tag = append(meta.Tag, FhirCoding{System: FhirSystemSourceDataset, Code: sourceDataset})
+	}
+	sort.Slice(meta.Tag, func(i, j int) bool {
+		return meta.Tag[i].Code < meta.Tag[j].Code
+	})
+	return &meta
+}
+
+var fhirIdRegex = regexp.MustCompile(`^[A-Za-z0-9\-.]{1,64}$`)
+
+// fhirResourceId returns the id as-is if it is a valid FHIR id, otherwise a stable hash is used.
+func fhirResourceId(id string) string {
+	if fhirIdRegex.MatchString(id) {
+		return id
+	}
+	return fhirHashedResourceId(id)
+}
+
+func fhirHashedResourceId(value string) string {
+	hash := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(hash[:])[:32]
+}
+
+func fhirNdjsonFilename(resourceType string) string {
+	return resourceType + ".ndjson"
+}
+
+// visibleEndpoints filters out endpoints hidden by a curation override
+func visibleEndpoints(endpoints []models.Endpoint) []models.Endpoint {
+	var visible []models.Endpoint
+	for _, end := range endpoints {
+		if !end.Hidden {
+			visible = append(visible, end)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,114 @@
+package export
+
+// Minimal FHIR R4 resource definitions, containing only the elements populated by the exporter.
+// See https://hl7.org/fhir/R4/
+
+const (
+	FhirSystemNPI               = "http://hl7.org/fhir/sid/us-npi"
+	FhirSystemEIN               = "urn:oid:2.16.840.1.113883.4.4"
+	FhirSystemCLIA              = "urn:oid:2.16.840.1.113883.4.7"
+	FhirSystemCCN               = "http://terminology.hl7.org/NamingSystem/CMSCertificationNumber"
+	FhirSystemURI               = "urn:ietf:rfc:3986"
+	FhirSystemNUCCTaxonomy      = "http://nucc.org/provider-taxonomy"
+	FhirSystemConnectionType    = "http://terminology.hl7.org/CodeSystem/endpoint-connection-type"
+	FhirSystemPayloadType       = "http://terminology.hl7.org/CodeSystem/endpoint-payload-type"
+	FhirSystemSourceDataset     = "https://www.fastenhealth.com/fhir/CodeSystem/source-dataset"
+	FhirExtensionPlatformType   = "https://www.fastenhealth.com/fhir/StructureDefinition/endpoint-platform-type"
+	FhirExtensionEndpointSource = "https://www.fastenhealth.com/fhir/StructureDefinition/endpoint-source-url"
+)
+
+type FhirMeta struct {
+	LastUpdated string       `json:"lastUpdated,omitempty"`
+	Tag         []FhirCoding `json:"tag,omitempty"`
+}
+
+type FhirExtension struct {
+	Url         string `json:"url"`
+	ValueString string `json:"valueString,omitempty"`
+	ValueUri    string `json:"valueUri,omitempty"`
+}
+
+type FhirCoding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type FhirCodeableConcept struct {
+	Coding []FhirCoding `json:"coding,omitempty"`
+	Text   string       `json:"text,omitempty"`
+}
+
+type FhirIdentifier struct {
+	Use    string `json:"use,omitempty"`
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+
+type FhirReference struct {
+	Reference string `json:"reference"`
+	Display   string `json:"display,omitempty"`
+}
+
+type FhirAddress struct {
+	Use        string   `json:"use,omitempty"`
+	Type       string   `json:"type,omitempty"`
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+type FhirOrganization struct {
+	ResourceType string                `json:"resourceType"`
+	Id           string                `json:"id"`
+	Meta         *FhirMeta             `json:"meta,omitempty"`
+	Identifier   []FhirIdentifier      `json:"identifier,omitempty"`
+	Active       bool                  `json:"active"`
+	Type         []FhirCodeableConcept `json:"type,omitempty"`
+	Name         string                `json:"name,omitempty"`
+	Alias        []string              `json:"alias,omitempty"`
+	Address      []FhirAddress         `json:"address,omitempty"`
+	Endpoint     []FhirReference       `json:"endpoint,omitempty"`
+}
+
+type FhirLocation struct {
+	ResourceType         string          `json:"resourceType"`
+	Id                   string          `json:"id"`
+	Meta                 *FhirMeta       `json:"meta,omitempty"`
+	Status               string          `json:"status"`
+	Name                 string          `json:"name,omitempty"`
+	Address              *FhirAddress    `json:"address,omitempty"`
+	ManagingOrganization *FhirReference  `json:"managingOrganization,omitempty"`
+	Endpoint             []FhirReference `json:"endpoint,omitempty"`
+}
+
+type FhirEndpoint struct {
+	ResourceType         string                `json:"resourceType"`
+	Id                   string                `json:"id"`
+	Meta                 *FhirMeta             `json:"meta,omitempty"`
+	Extension            []FhirExtension       `json:"extension,omitempty"`
+	Status               string                `json:"status"`
+	ConnectionType       FhirCoding            `json:"connectionType"`
+	Name                 string                `json:"name,omitempty"`
+	ManagingOrganization *FhirReference        `json:"managingOrganization,omitempty"`
+	PayloadType          []FhirCodeableConcept `json:"payloadType"`
+	Address              string                `json:"address"`
+}
+
+// FhirBulkManifest follows the FHIR Bulk Data Access "Complete Status" response body
+// See https://hl7.org/fhir/uv/bulkdata/export.html#response---complete-status
+type FhirBulkManifest struct {
+	TransactionTime     string                   `json:"transactionTime"`
+	Request             string                   `json:"request"`
+	RequiresAccessToken bool                     `json:"requiresAccessToken"`
+	Output              []FhirBulkManifestOutput `json:"output"`
+	Error               []FhirBulkManifestOutput `json:"error"`
+}
+
+type FhirBulkManifestOutput struct {
+	Type  string `json:"type"`
+	Url   string `json:"url"`
+	Count int    `json:"count"`
+}
@@ -0,0 +1,105 @@
+package cms
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterImporter(&HospitalGeneralInformationImporter{})
+}
+
+// HospitalGeneralInformationImporter reads the CMS Care Compare "Hospital General Information" dataset, which lists
+// every Medicare certified hospital with its type, ownership & whether it provides emergency services.
+// See https://data.cms.gov/provider-data/dataset/xubh-q36u
+type HospitalGeneralInformationImporter struct{}
+
+func (hi *HospitalGeneralInformationImporter) Name() string {
+	return models.SourceCMSHospitalGeneralInformation
+}
+
+func (hi *HospitalGeneralInformationImporter) Import(filePath string, releaseDate time.Time) ([]Facility, error) {
+	var facilities []Facility
+	required := [][]string{{"Facility ID"}, {"Facility Name"}, {"Address"}, {"State"}, {"ZIP Code"}}
+	err := utils.ReadCSV(filePath, required, func(row utils.CSVRow, line int) error {
+		ccn := normalizeCCN(row.Get("Facility ID"))
+		if ccn == "" {
+			return nil
+		}
+		facility := Facility{
+			CCN:  ccn,
+			Name: row.Get("Facility Name"),
+			Location: models.Location{
+				Line:       []string{row.Get("Address")},
+				City:       row.Get("City/Town", "City"),
+				State:      row.Get("State"),
+				PostalCode: row.Get("ZIP Code"),
+				Country:    "US",
+			},
+			FacilityType: hospitalFacilityType(row.Get("Hospital Type")),
+			Ownership:    hospitalOwnership(row.Get("Hospital Ownership")),
+			Provenance: models.Provenance{
+				SourceDataset: hi.Name(),
+				SourceFile:    filepath.Base(filePath),
+				SourceRow:     line,
+				ReleaseDate:   releaseDate,
+			},
+		}
+		switch strings.ToUpper(row.Get("Emergency Services")) {
+		case "YES", "Y", "TRUE":
+			emergencyServices := true
+			facility.EmergencyServices = &emergencyServices
+		case "NO", "N", "FALSE":
+			emergencyServices := false
+			facility.EmergencyServices = &emergencyServices
+		}
+		facilities = append(facilities, facility)
+		return nil
+	})
+	return facilities, err
+}
+
+// hospitalFacilityType maps the "Hospital Type" values, eg. "Acute Care Hospitals" or "Acute Care - Veterans Administration"
+func hospitalFacilityType(hospitalType string) models.FacilityType {
+	hospitalType = strings.ToUpper(hospitalType)
+	switch {
+	case hospitalType == "":
+		return ""
+	case strings.Contains(hospitalType, "CRITICAL ACCESS"):
+		return models.FacilityTypeCriticalAccessHospital
+	case strings.Contains(hospitalType, "CHILDREN"):
+		return models.FacilityTypeChildrensHospital
+	case strings.Contains(hospitalType, "PSYCHIATRIC"):
+		return models.FacilityTypePsychiatricHospital
+	case strings.Contains(hospitalType, "RURAL EMERGENCY"):
+		return models.FacilityTypeRuralEmergencyHospital
+	case strings.Contains(hospitalType, "LONG-TERM") || strings.Contains(hospitalType, "LONG TERM"):
+		return models.FacilityTypeLongTermCareHospital
+	case strings.Contains(hospitalType, "ACUTE CARE"):
+		return models.FacilityTypeAcuteCareHospital
+	}
+	return models.FacilityTypeOther
+}
+
+// hospitalOwnership normalizes the "Hospital Ownership" values, eg. "Voluntary non-profit - Private" or "Government - Local"
+func hospitalOwnership(ownership string) models.FacilityOwnership {
+	ownership = strings.ToUpper(ownership)
+	switch {
+	case ownership == "":
+		return ""
+	case strings.Contains(ownership, "NON-PROFIT") || strings.Contains(ownership, "NONPROFIT"):
+		return models.FacilityOwnershipNonProfit
+	case strings.Contains(ownership, "PROPRIETARY"):
+		return models.FacilityOwnershipForProfit
+	case strings.Contains(ownership, "GOVERNMENT") || strings.Contains(ownership, "DEPARTMENT OF DEFENSE") || strings.Contains(ownership, "VETERANS"):
+		return models.FacilityOwnershipGovernment
+	case strings.Contains(ownership, "PHYSICIAN"):
+		return models.FacilityOwnershipPhysician
+	case strings.Contains(ownership, "TRIBAL"):
+		return models.FacilityOwnershipTribal
+	}
+	return ""
+}
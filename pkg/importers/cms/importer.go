@@ -0,0 +1,96 @@
+package cms
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/validation"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FacilityImporter reads a CMS facility dataset (downloaded as a CSV file) into Facilities, which are used to enrich the
+// organizations they match (see MatchFacility). Columns are looked up by their header name.
+type FacilityImporter interface {
+	// Name is the unique name of the importer, also used as the revision & provenance source, eg. cms_pos
+	Name() string
+
+	// Import reads the dataset, releaseDate is the date the dataset was published by CMS (used for provenance)
+	Import(filePath string, releaseDate time.Time) ([]Facility, error)
+}
+
+// Facility is a single CMS certified facility, read from a row of a facility dataset
+type Facility struct {
+	CCN      string
+	Name     string
+	Location models.Location
+
+	FacilityType      models.FacilityType
+	Ownership         models.FacilityOwnership
+	BedCount          int
+	EmergencyServices *bool // nil if not included in the dataset
+
+	Provenance models.Provenance
+}
+
+// Organization converts the facility into an organization with the id of the matched organization, containing only the
+// facility fields & CCN identifier, ready to be merged into the matched organization.
+func (facility *Facility) Organization(orgId string) (*models.Organization, error) {
+	org := models.Organization{
+		ID:                orgId,
+		FacilityType:      facility.FacilityType,
+		Ownership:         facility.Ownership,
+		BedCount:          facility.BedCount,
+		EmergencyServices: facility.EmergencyServices,
+		SourceUpdatedAt:   facility.Provenance.ReleaseDate,
+		OrganizationIdentifiers: []models.OrganizationIdentifier{{
+			IdentifierType:    models.OrganizationIdentifierTypeCCN,
+			IdentifierValue:   facility.CCN,
+			IdentifierDisplay: facility.CCN,
+			IdentifierIssuer:  "CMS",
+		}},
+	}
+	org.ValidationFindings = validation.ValidateOrganization(&org)
+
+	err := org.AddProvenance(facility.Provenance)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
+
+var importers = map[string]FacilityImporter{}
+
+// RegisterImporter makes an importer available by name. Importers register themselves in init()
+func RegisterImporter(importer FacilityImporter) {
+	if _, exists := importers[importer.Name()]; exists {
+		panic(fmt.Sprintf("facility importer already registered: %s", importer.Name()))
+	}
+	importers[importer.Name()] = importer
+}
+
+func GetImporter(name string) (FacilityImporter, error) {
+	importer, ok := importers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown facility importer: %s (available: %v)", name, ImporterNames())
+	}
+	return importer, nil
+}
+
+func ImporterNames() []string {
+	var names []string
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// normalizeCCN restores the leading zeros of numeric CCNs (6 digits) that were dropped by spreadsheet tools
+func normalizeCCN(ccn string) string {
+	ccn = strings.ToUpper(strings.TrimSpace(ccn))
+	if ccn != "" && len(ccn) < 6 && strings.Trim(ccn, "0123456789") == "" {
+		ccn = strings.Repeat("0", 6-len(ccn)) + ccn
+	}
+	return ccn
+}
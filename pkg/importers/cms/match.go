@@ -0,0 +1,83 @@
+package cms
+
+import (
+	"errors"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+)
+
+// MatchMethod is how a facility was matched to an organization
+type MatchMethod string
+
+const (
+	MatchMethodCCN         MatchMethod = "ccn"          // the organization already has the facility's CCN
+	MatchMethodNameAddress MatchMethod = "name_address" // an organization at the facility's address has the facility's name (or alias)
+	MatchMethodNameZip     MatchMethod = "name_zip"     // the organization with the facility's name has a location in the facility's ZIP code
+)
+
+// MatchFacility finds the organization a facility belongs to: by CCN, then by name & address, then by name & ZIP code.
+// Individual providers are never matched. Returns nil if no organization matches.
+func MatchFacility(repository *database.SqliteRepository, facility *Facility) (*models.Organization, MatchMethod, error) {
+	foundOrg, err := repository.FindOrganizationByIdentifiers([]models.OrganizationIdentifier{{
+		IdentifierType:  models.OrganizationIdentifierTypeCCN,
+		IdentifierValue: facility.CCN,
+	}})
+	if err == nil && foundOrg.OrganizationType != models.OrganizationTypeTypeIndividual {
+		return foundOrg, MatchMethodCCN, nil
+	} else if err != nil && !errors.Is(err, database.ErrOrganizationNotFound) {
+		return nil, "", err
+	}
+
+	name, err := utils.NormalizeOrganizationName(facility.Name)
+	if err != nil || name == "" {
+		return nil, "", nil
+	}
+
+	location := facility.Location
+	location.Standardize()
+	locationId, err := location.ComputeId()
+	if err != nil {
+		return nil, "", err
+	}
+	orgs, err := repository.FindOrganizationsByLocationId(locationId)
+	if err != nil {
+		return nil, "", err
+	}
+	for ndx := range orgs {
+		if orgs[ndx].OrganizationType != models.OrganizationTypeTypeIndividual && hasName(&orgs[ndx], name) {
+			return &orgs[ndx], MatchMethodNameAddress, nil
+		}
+	}
+
+	foundOrg, err = repository.FindOrganizationByIdentifiers([]models.OrganizationIdentifier{{
+		IdentifierType:  models.OrganizationIdentifierTypeName,
+		IdentifierValue: name,
+	}})
+	if errors.Is(err, database.ErrOrganizationNotFound) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	} else if foundOrg.OrganizationType == models.OrganizationTypeTypeIndividual {
+		return nil, "", nil
+	}
+	for _, orgLocation := range foundOrg.Locations {
+		if orgLocation.PostalCode != "" && orgLocation.PostalCode == location.PostalCode {
+			return foundOrg, MatchMethodNameZip, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// hasName returns true if the (normalized) name is the organization's name or one of its aliases
+func hasName(org *models.Organization, name string) bool {
+	if orgName, err := org.NormalizeOrganizationName(); err == nil && orgName == name {
+		return true
+	}
+	for _, identifier := range org.OrganizationIdentifiers {
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeName && identifier.IdentifierValue == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package cms
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterImporter(&ProviderOfServicesImporter{})
+}
+
+// ProviderOfServicesImporter reads the CMS Provider of Services (POS) file, which lists every Medicare certified
+// institutional provider (hospitals, nursing homes, dialysis facilities, etc) with its bed count. Terminated providers
+// are skipped. Emergency services are not included in the POS file.
+// See https://data.cms.gov/provider-characteristics/hospitals-and-other-facilities/provider-of-services-file-hospital-non-hospital-facilities
+type ProviderOfServicesImporter struct{}
+
+func (pi *ProviderOfServicesImporter) Name() string {
+	return models.SourceCMSProviderOfServices
+}
+
+func (pi *ProviderOfServicesImporter) Import(filePath string, releaseDate time.Time) ([]Facility, error) {
+	var facilities []Facility
+	required := [][]string{{"PRVDR_NUM"}, {"FAC_NAME"}, {"ST_ADR"}, {"STATE_CD"}, {"ZIP_CD"}, {"PRVDR_CTGRY_CD"}}
+	err := utils.ReadCSV(filePath, required, func(row utils.CSVRow, line int) error {
+		ccn := normalizeCCN(row.Get("PRVDR_NUM"))
+		if ccn == "" {
+			return nil
+		}
+		//00 is an active provider, anything else is a termination reason
+		if terminationCode := row.Get("PGM_TRMNTN_CD"); terminationCode != "" && terminationCode != "00" {
+			return nil
+		}
+		bedCount, _ := strconv.Atoi(row.Get("BED_CNT"))
+		facilities = append(facilities, Facility{
+			CCN:  ccn,
+			Name: row.Get("FAC_NAME"),
+			Location: models.Location{
+				Line:       []string{row.Get("ST_ADR")},
+				City:       row.Get("CITY_NAME"),
+				State:      row.Get("STATE_CD"),
+				PostalCode: row.Get("ZIP_CD"),
+				Country:    "US",
+			},
+			FacilityType: posFacilityType(row.Get("PRVDR_CTGRY_CD"), row.Get("PRVDR_CTGRY_SBTYP_CD")),
+			Ownership:    posOwnership[row.Get("GNRL_CNTL_TYPE_CD")],
+			BedCount:     bedCount,
+			Provenance: models.Provenance{
+				SourceDataset: pi.Name(),
+				SourceFile:    filepath.Base(filePath),
+				SourceRow:     line,
+				ReleaseDate:   releaseDate,
+			},
+		})
+		return nil
+	})
+	return facilities, err
+}
+
+// posProviderCategories maps the POS provider category code (PRVDR_CTGRY_CD) to a facility type
+var posProviderCategories = map[string]models.FacilityType{
+	"01": models.FacilityTypeHospital,
+	"05": models.FacilityTypeHomeHealthAgency,
+	"09": models.FacilityTypeESRDFacility,
+	"11": models.FacilityTypeIntermediateCareFacility,
+	"12": models.FacilityTypeRuralHealthClinic,
+	"14": models.FacilityTypeOutpatientRehabilitation,
+	"15": models.FacilityTypeAmbulatorySurgicalCenter,
+	"16": models.FacilityTypeHospice,
+	"17": models.FacilityTypeOrganProcurementOrganization,
+	"19": models.FacilityTypeCommunityMentalHealthCenter,
+	"21": models.FacilityTypeFederallyQualifiedHealthCenter,
+}
+
+// posHospitalSubtypes maps the POS provider subtype code (PRVDR_CTGRY_SBTYP_CD) of hospitals to a facility type
+var posHospitalSubtypes = map[string]models.FacilityType{
+	"01": models.FacilityTypeAcuteCareHospital, // short term
+	"02": models.FacilityTypeLongTermCareHospital,
+	"03": models.FacilityTypeReligiousNonMedical,
+	"04": models.FacilityTypePsychiatricHospital,
+	"05": models.FacilityTypeRehabilitationHospital,
+	"06": models.FacilityTypeChildrensHospital,
+	"07": models.FacilityTypePsychiatricHospital, // distinct part psychiatric
+	"11": models.FacilityTypeCriticalAccessHospital,
+	"20": models.FacilityTypeTransplantHospital,
+	"22": models.FacilityTypeHospital,            // Medicaid only non-psychiatric
+	"23": models.FacilityTypePsychiatricHospital, // Medicaid only psychiatric
+}
+
+// posOwnership maps the POS general control type code (GNRL_CNTL_TYPE_CD)
+var posOwnership = map[string]models.FacilityOwnership{
+	"01": models.FacilityOwnershipNonProfit,  // church
+	"02": models.FacilityOwnershipNonProfit,  // private (not for profit)
+	"03": models.FacilityOwnershipNonProfit,  // other (not for profit)
+	"04": models.FacilityOwnershipForProfit,  // private (for profit)
+	"05": models.FacilityOwnershipGovernment, // federal
+	"06": models.FacilityOwnershipGovernment, // state
+	"07": models.FacilityOwnershipGovernment, // local
+	"08": models.FacilityOwnershipGovernment, // hospital district or authority
+	"09": models.FacilityOwnershipPhysician,
+	"10": models.FacilityOwnershipTribal,
+}
+
+func posFacilityType(categoryCode string, subtypeCode string) models.FacilityType {
+	if categoryCode == "01" {
+		if facilityType, ok := posHospitalSubtypes[subtypeCode]; ok {
+			return facilityType
+		}
+	}
+	if facilityType, ok := posProviderCategories[categoryCode]; ok {
+		return facilityType
+	} else if categoryCode != "" {
+		return models.FacilityTypeOther
+	}
+	return ""
+}
@@ -0,0 +1,9 @@
+package endpoints
+
+import "github.com/fastenhealth/fasten-sources-etl/pkg/models"
+
+// Oracle Health (Cerner) publishes its Millennium patient access R4 endpoints as a FHIR Bundle
+// https://github.com/oracle-samples/ignite-endpoints
+func init() {
+	RegisterImporter(NewFhirBundleImporter(models.SourceCerner, "cerner", "https://raw.githubusercontent.com/oracle-samples/ignite-endpoints/main/millennium_patient_r4_endpoints.json"))
+}
@@ -0,0 +1,9 @@
+package endpoints
+
+import "github.com/fastenhealth/fasten-sources-etl/pkg/models"
+
+// Epic publishes its open (patient access) R4 endpoints as a FHIR Bundle
+// https://open.epic.com/Endpoints/R4
+func init() {
+	RegisterImporter(NewFhirBundleImporter(models.SourceEpic, "epic", "https://open.epic.com/Endpoints/R4"))
+}
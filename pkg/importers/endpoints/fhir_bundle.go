@@ -0,0 +1,289 @@
+package endpoints
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/validation"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const fhirSystemNPI = "http://hl7.org/fhir/sid/us-npi"
+
+// Minimal FHIR R4 definitions, containing only the elements read from vendor endpoint bundles.
+type fhirBundle struct {
+	ResourceType string `json:"resourceType"`
+	Meta         struct {
+		LastUpdated string `json:"lastUpdated"`
+	} `json:"meta"`
+	Entry []struct {
+		FullUrl  string          `json:"fullUrl"`
+		Resource json.RawMessage `json:"resource"`
+	} `json:"entry"`
+}
+
+type fhirResourceHeader struct {
+	ResourceType string `json:"resourceType"`
+	Id           string `json:"id"`
+}
+
+type fhirReference struct {
+	Reference string `json:"reference"`
+}
+
+type fhirEndpoint struct {
+	Id                   string         `json:"id"`
+	Status               string         `json:"status"`
+	Name                 string         `json:"name"`
+	Address              string         `json:"address"`
+	ManagingOrganization *fhirReference `json:"managingOrganization"`
+}
+
+type fhirOrganization struct {
+	Id         string   `json:"id"`
+	Name       string   `json:"name"`
+	Alias      []string `json:"alias"`
+	Identifier []struct {
+		System string `json:"system"`
+		Value  string `json:"value"`
+	} `json:"identifier"`
+	Address []struct {
+		Line       []string `json:"line"`
+		City       string   `json:"city"`
+		State      string   `json:"state"`
+		PostalCode string   `json:"postalCode"`
+		Country    string   `json:"country"`
+	} `json:"address"`
+	Endpoint []fhirReference `json:"endpoint"`
+}
+
+// FhirBundleImporter reads a FHIR R4 Bundle of Endpoint and Organization resources. Most EHR vendors publish their
+// endpoint directories in this format, so vendor specific importers only need to provide their name & source.
+type FhirBundleImporter struct {
+	name         string
+	platformType string
+	sourceUrl    string
+}
+
+func NewFhirBundleImporter(name string, platformType string, sourceUrl string) *FhirBundleImporter {
+	return &FhirBundleImporter{name: name, platformType: platformType, sourceUrl: sourceUrl}
+}
+
+func (bi *FhirBundleImporter) Name() string {
+	return bi.name
+}
+
+func (bi *FhirBundleImporter) PlatformType() string {
+	return bi.platformType
+}
+
+func (bi *FhirBundleImporter) SourceUrl() string {
+	return bi.sourceUrl
+}
+
+// Import links Endpoints to Organizations using Endpoint.managingOrganization or Organization.endpoint.
+// Endpoints without an Organization are imported as an organization named after the Endpoint.
+func (bi *FhirBundleImporter) Import(filePath string) ([]*models.Organization, error) {
+	bundleBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var bundle fhirBundle
+	err = json.Unmarshal(bundleBytes, &bundle)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s endpoint bundle (%s): %v", bi.name, filePath, err)
+	}
+	if bundle.ResourceType != "Bundle" {
+		return nil, fmt.Errorf("%s endpoint file (%s) is not a FHIR Bundle", bi.name, filePath)
+	}
+
+	releaseDate, err := time.Parse(time.RFC3339, bundle.Meta.LastUpdated)
+	if err != nil {
+		fileInfo, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		releaseDate = fileInfo.ModTime()
+	}
+
+	var orgs []*models.Organization
+	orgsByReference := map[string]*models.Organization{}
+	orgsByEndpointReference := map[string]*models.Organization{}
+	type bundleEndpoint struct {
+		references []string
+		endpoint   fhirEndpoint
+		provenance models.Provenance
+	}
+	var endpoints []bundleEndpoint
+
+	for ndx, entry := range bundle.Entry {
+		var header fhirResourceHeader
+		err = json.Unmarshal(entry.Resource, &header)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s endpoint bundle entry %d: %v", bi.name, ndx, err)
+		}
+		references := []string{fmt.Sprintf("%s/%s", header.ResourceType, header.Id)}
+		if entry.FullUrl != "" {
+			references = append(references, entry.FullUrl)
+		}
+		provenance := models.Provenance{
+			SourceDataset: bi.name,
+			SourceFile:    filepath.Base(filePath),
+			SourceRow:     ndx + 1,
+			ReleaseDate:   releaseDate,
+		}
+
+		switch header.ResourceType {
+		case "Organization":
+			var fhirOrg fhirOrganization
+			err = json.Unmarshal(entry.Resource, &fhirOrg)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s endpoint bundle entry %d: %v", bi.name, ndx, err)
+			}
+			org, err := bi.organization(&fhirOrg, provenance)
+			if err != nil {
+				return nil, err
+			}
+			orgs = append(orgs, org)
+			for _, reference := range references {
+				orgsByReference[reference] = org
+			}
+			for _, endpointReference := range fhirOrg.Endpoint {
+				orgsByEndpointReference[endpointReference.Reference] = org
+			}
+		case "Endpoint":
+			var fhirEnd fhirEndpoint
+			err = json.Unmarshal(entry.Resource, &fhirEnd)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s endpoint bundle entry %d: %v", bi.name, ndx, err)
+			}
+			endpoints = append(endpoints, bundleEndpoint{references: references, endpoint: fhirEnd, provenance: provenance})
+		}
+	}
+
+	for _, bundleEnd := range endpoints {
+		if bundleEnd.endpoint.Address == "" || (bundleEnd.endpoint.Status != "" && bundleEnd.endpoint.Status != "active") {
+			continue
+		}
+		if err := utils.ValidateEndpointURL(bundleEnd.endpoint.Address); err != nil {
+			log.Printf("skipping %s endpoint (%s): %v", bi.name, bundleEnd.endpoint.Id, err)
+			continue
+		}
+
+		var org *models.Organization
+		if bundleEnd.endpoint.ManagingOrganization != nil {
+			org = orgsByReference[bundleEnd.endpoint.ManagingOrganization.Reference]
+		}
+		for _, reference := range bundleEnd.references {
+			if org == nil {
+				org = orgsByEndpointReference[reference]
+			}
+		}
+		if org == nil {
+			org, err = bi.organization(&fhirOrganization{Id: bundleEnd.endpoint.Id, Name: bundleEnd.endpoint.Name}, bundleEnd.provenance)
+			if err != nil {
+				return nil, err
+			}
+			orgs = append(orgs, org)
+		}
+
+		endpointOrg := models.Organization{
+			ID: org.ID,
+			Endpoints: []models.Endpoint{{
+				URL:          utils.NormalizeEndpointURL(bundleEnd.endpoint.Address),
+				SourceUrl:    bi.sourceUrl,
+				PlatformType: bi.platformType,
+			}},
+		}
+		err = endpointOrg.AddProvenance(bundleEnd.provenance)
+		if err != nil {
+			return nil, err
+		}
+		org.MergeEndpoints(&endpointOrg)
+		org.MergeProvenance(&endpointOrg)
+	}
+
+	//organizations without any endpoints are not useful
+	var orgsWithEndpoints []*models.Organization
+	for _, org := range orgs {
+		if len(org.Endpoints) > 0 {
+			orgsWithEndpoints = append(orgsWithEndpoints, org)
+		}
+	}
+	return orgsWithEndpoints, nil
+}
+
+func (bi *FhirBundleImporter) organization(fhirOrg *fhirOrganization, provenance models.Provenance) (*models.Organization, error) {
+	org := models.Organization{
+		OrganizationType: models.OrganizationTypeTypeOrganization,
+		Name:             strings.TrimSpace(fhirOrg.Name),
+		Source:           provenance.SourceDataset,
+		SourceUpdatedAt:  provenance.ReleaseDate,
+	}
+	if org.Name == "" {
+		return nil, fmt.Errorf("%s organization (%s) is missing a name", bi.name, fhirOrg.Id)
+	}
+
+	for _, name := range append([]string{org.Name}, fhirOrg.Alias...) {
+		normalizedName, err := utils.NormalizeOrganizationName(name)
+		if err != nil {
+			return nil, err
+		}
+		org.MergeOrganizationIdentifiers(&models.Organization{
+			OrganizationIdentifiers: []models.OrganizationIdentifier{{
+				IdentifierType:    models.OrganizationIdentifierTypeName,
+				IdentifierValue:   normalizedName,
+				IdentifierDisplay: name,
+			}},
+		})
+	}
+
+	for _, identifier := range fhirOrg.Identifier {
+		if identifier.System == fhirSystemNPI && identifier.Value != "" {
+			org.OrganizationIdentifiers = append(org.OrganizationIdentifiers, models.OrganizationIdentifier{
+				IdentifierType:  models.OrganizationIdentifierTypeNPI,
+				IdentifierValue: identifier.Value,
+			})
+			if org.ID == "" {
+				org.ID = identifier.Value
+			}
+		}
+	}
+	if org.ID == "" {
+		// vendor organizations without an NPI are identified by their vendor resource id (or name)
+		vendorId := fhirOrg.Id
+		if vendorId == "" {
+			hash := sha256.Sum256([]byte(org.Name))
+			vendorId = hex.EncodeToString(hash[:])[:16]
+		}
+		org.ID = fmt.Sprintf("%s-%s", bi.name, vendorId)
+	}
+
+	for _, address := range fhirOrg.Address {
+		if len(address.Line) == 0 && address.City == "" {
+			continue
+		}
+		org.Locations = append(org.Locations, models.Location{
+			Line:       address.Line,
+			City:       address.City,
+			State:      address.State,
+			PostalCode: address.PostalCode,
+			Country:    address.Country,
+		})
+	}
+
+	org.ValidationFindings = validation.ValidateOrganization(&org)
+
+	err := org.AddProvenance(provenance)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
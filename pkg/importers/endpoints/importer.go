@@ -0,0 +1,47 @@
+package endpoints
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"sort"
+)
+
+// EndpointImporter reads a vendor-published FHIR endpoint directory (downloaded to a local file), and converts it into
+// Organizations with Endpoints, ready to be merged into the database.
+type EndpointImporter interface {
+	// Name is the unique name of the importer, also used as the revision & provenance source, eg. epic
+	Name() string
+	// PlatformType is stored on every imported Endpoint
+	PlatformType() string
+	// SourceUrl is where the vendor publishes the endpoint directory, stored on every imported Endpoint
+	SourceUrl() string
+
+	Import(filePath string) ([]*models.Organization, error)
+}
+
+var importers = map[string]EndpointImporter{}
+
+// RegisterImporter makes an importer available by name. Importers register themselves in init()
+func RegisterImporter(importer EndpointImporter) {
+	if _, exists := importers[importer.Name()]; exists {
+		panic(fmt.Sprintf("endpoint importer already registered: %s", importer.Name()))
+	}
+	importers[importer.Name()] = importer
+}
+
+func GetImporter(name string) (EndpointImporter, error) {
+	importer, ok := importers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown endpoint importer: %s (available: %v)", name, ImporterNames())
+	}
+	return importer, nil
+}
+
+func ImporterNames() []string {
+	var names []string
+	for name := range importers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
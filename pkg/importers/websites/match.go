@@ -0,0 +1,73 @@
+package websites
+
+import (
+	"errors"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"strings"
+)
+
+// MatchMethod is how a website record was matched to an organization
+type MatchMethod string
+
+const (
+	MatchMethodNPI  MatchMethod = "npi"
+	MatchMethodEIN  MatchMethod = "ein"
+	MatchMethodName MatchMethod = "name"
+)
+
+// MatchWebsiteRecord finds the organization a record belongs to: by NPI, then by EIN, then by name. Individual providers
+// are only matched by NPI. EINs are shared by every organization billing under the same tax id, so records are only
+// matched by EIN if a single organization has it. Returns nil if no organization matches.
+func MatchWebsiteRecord(repository *database.SqliteRepository, record *WebsiteRecord) (*models.Organization, MatchMethod, error) {
+	if npi := strings.TrimSpace(record.NPI); npi != "" {
+		foundOrg, err := repository.FindOrganizationByIdentifiers([]models.OrganizationIdentifier{{
+			IdentifierType:  models.OrganizationIdentifierTypeNPI,
+			IdentifierValue: npi,
+		}})
+		if err == nil {
+			return foundOrg, MatchMethodNPI, nil
+		} else if !errors.Is(err, database.ErrOrganizationNotFound) {
+			return nil, "", err
+		}
+	}
+
+	if ein := strings.ReplaceAll(strings.TrimSpace(record.EIN), "-", ""); ein != "" {
+		//EINs are stored as published by each source, with or without the dash
+		eins := []string{ein}
+		if len(ein) == 9 {
+			eins = append(eins, ein[:2]+"-"+ein[2:])
+		}
+		foundOrgs, err := repository.FindOrganizationsByAttributeIdentifier(models.OrganizationIdentifierTypeEIN, eins)
+		if err != nil {
+			return nil, "", err
+		}
+		var einOrgs []models.Organization
+		for _, foundOrg := range foundOrgs {
+			if foundOrg.OrganizationType != models.OrganizationTypeTypeIndividual {
+				einOrgs = append(einOrgs, foundOrg)
+			}
+		}
+		if len(einOrgs) == 1 {
+			return &einOrgs[0], MatchMethodEIN, nil
+		}
+	}
+
+	name, err := utils.NormalizeOrganizationName(record.Name)
+	if err != nil || name == "" {
+		return nil, "", nil
+	}
+	foundOrg, err := repository.FindOrganizationByIdentifiers([]models.OrganizationIdentifier{{
+		IdentifierType:  models.OrganizationIdentifierTypeName,
+		IdentifierValue: name,
+	}})
+	if errors.Is(err, database.ErrOrganizationNotFound) {
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", err
+	} else if foundOrg.OrganizationType == models.OrganizationTypeTypeIndividual {
+		return nil, "", nil
+	}
+	return foundOrg, MatchMethodName, nil
+}
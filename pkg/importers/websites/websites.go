@@ -0,0 +1,123 @@
+package websites
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/validation"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WebsiteRecord is an entry of a curated website & portal list. Records are keyed by NPI, EIN or organization name
+// (in that order of preference).
+type WebsiteRecord struct {
+	NPI  string   `json:"npi"`
+	EIN  string   `json:"ein"`
+	Name string   `json:"name"`
+	URL  string   `json:"url"`
+	URLs []string `json:"urls"`
+
+	Provenance models.Provenance `json:"-"`
+}
+
+// Import reads a curated website & portal list, either a JSON array of WebsiteRecords or a CSV file with npi, ein, name
+// & url columns (a header row is required, columns other than url are optional). Urls are canonicalized (see
+// utils.CanonicalizeRelatedURL), invalid urls & records without a key are skipped. releaseDate is the date the list was
+// published (used for provenance).
+func Import(filePath string, releaseDate time.Time) ([]WebsiteRecord, error) {
+	var records []WebsiteRecord
+	var err error
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		records, err = readJSON(filePath)
+	} else {
+		records, err = readCSV(filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var validRecords []WebsiteRecord
+	for ndx := range records {
+		record := &records[ndx]
+		record.Provenance.SourceDataset = models.SourceWebsites
+		record.Provenance.SourceFile = filepath.Base(filePath)
+		record.Provenance.ReleaseDate = releaseDate
+		if record.NPI == "" && record.EIN == "" && record.Name == "" {
+			log.Printf("skipping website record (row %d): missing npi, ein & name", record.Provenance.SourceRow)
+			continue
+		}
+
+		var urls []string
+		for _, rawUrl := range append([]string{record.URL}, record.URLs...) {
+			if strings.TrimSpace(rawUrl) == "" {
+				continue
+			}
+			relatedUrl, err := utils.CanonicalizeRelatedURL(rawUrl)
+			if err != nil {
+				log.Printf("skipping website url (row %d, %s): %v", record.Provenance.SourceRow, rawUrl, err)
+				continue
+			}
+			urls = append(urls, relatedUrl)
+		}
+		if len(urls) == 0 {
+			continue
+		}
+		record.URL = ""
+		record.URLs = urls
+		validRecords = append(validRecords, *record)
+	}
+	return validRecords, nil
+}
+
+func readJSON(filePath string) ([]WebsiteRecord, error) {
+	jsonBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var records []WebsiteRecord
+	err = json.Unmarshal(jsonBytes, &records)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing website list (%s): %v", filePath, err)
+	}
+	for ndx := range records {
+		records[ndx].Provenance.SourceRow = ndx + 1
+	}
+	return records, nil
+}
+
+func readCSV(filePath string) ([]WebsiteRecord, error) {
+	var records []WebsiteRecord
+	err := utils.ReadCSV(filePath, [][]string{{"url"}}, func(row utils.CSVRow, line int) error {
+		records = append(records, WebsiteRecord{
+			NPI:        row.Get("npi"),
+			EIN:        row.Get("ein"),
+			Name:       row.Get("name"),
+			URL:        row.Get("url"),
+			Provenance: models.Provenance{SourceRow: line},
+		})
+		return nil
+	})
+	return records, err
+}
+
+// Organization converts the record into an organization with the id of the matched organization, containing only the
+// related urls, ready to be merged into the matched organization.
+func (record *WebsiteRecord) Organization(orgId string) (*models.Organization, error) {
+	org := models.Organization{
+		ID:              orgId,
+		RelatedUrls:     record.URLs,
+		SourceUpdatedAt: record.Provenance.ReleaseDate,
+	}
+	org.ValidationFindings = validation.ValidateOrganization(&org)
+
+	err := org.AddProvenance(record.Provenance)
+	if err != nil {
+		return nil, err
+	}
+	return &org, nil
+}
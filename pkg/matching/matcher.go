@@ -0,0 +1,220 @@
+package matching
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/similarity"
+	"github.com/sirupsen/logrus"
+	"sort"
+)
+
+type MatcherConfig struct {
+	// matches scoring at least AutoLinkThreshold are linked without review, as long as the next best candidate scores
+	// at least AutoLinkMargin lower.
+	AutoLinkThreshold float64
+	AutoLinkMargin    float64
+	// matches scoring at least ReviewThreshold (but not linked automatically) are added to the review queue
+	ReviewThreshold float64
+	// the maximum number of candidate organizations scored for each unlinked organization
+	MaxCandidates int
+	// name tokens shared by more organizations than this are not used to find candidates (see similarity.Index)
+	MaxPostings int
+}
+
+func DefaultMatcherConfig() MatcherConfig {
+	return MatcherConfig{
+		AutoLinkThreshold: 0.9,
+		AutoLinkMargin:    0.1,
+		ReviewThreshold:   0.5,
+		MaxCandidates:     200,
+		MaxPostings:       similarity.DefaultMaxPostings,
+	}
+}
+
+// MatchSummary counts the outcome of a matcher run, by unlinked organization
+type MatchSummary struct {
+	Unlinked   int // organizations without an NPI
+	Relinked   int // linked using a previous (accepted) decision
+	AutoLinked int
+	Review     int // with at least one pending match
+	Unmatched  int
+}
+
+// Matcher links organizations imported from vendor endpoint directories (which rarely include an NPI) to the NPPES
+// organizations they represent.
+type Matcher struct {
+	Logger     logrus.FieldLogger
+	Repository *database.SqliteRepository
+	Config     MatcherConfig
+
+	index *similarity.Index
+}
+
+func NewMatcher(repository *database.SqliteRepository, config MatcherConfig, logger logrus.FieldLogger) *Matcher {
+	return &Matcher{Logger: logger, Repository: repository, Config: config}
+}
+
+// Run scores candidates for every unlinked organization. Confident matches are linked, ambiguous matches are saved for
+// review. Previously accepted matches are re-applied, and rejected candidates are never proposed again.
+func (m *Matcher) Run() (*MatchSummary, error) {
+	summary := MatchSummary{}
+
+	orgs, err := m.Repository.FindUnlinkedOrganizations()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find unlinked organizations - %v", err)
+	}
+	summary.Unlinked = len(orgs)
+	if len(orgs) == 0 {
+		return &summary, nil
+	}
+
+	err = m.BuildIndex()
+	if err != nil {
+		return nil, err
+	}
+	m.Logger.Infof("Matching %d unlinked organizations", len(orgs))
+
+	for ndx := range orgs {
+		org := &orgs[ndx]
+
+		previousMatches, err := m.Repository.ListOrganizationMatches(org.ID, "")
+		if err != nil {
+			return nil, err
+		}
+		rejected := map[string]bool{}
+		var linkedMatch *models.OrganizationMatch
+		for ndx := range previousMatches {
+			if previousMatches[ndx].IsLinked() {
+				linkedMatch = &previousMatches[ndx]
+			} else if previousMatches[ndx].Status == models.OrganizationMatchStatusRejected {
+				rejected[previousMatches[ndx].CandidateOrganizationID] = true
+			}
+		}
+
+		//the organization was linked, but still exists (eg. re-imported before re-imports were merged into the linked
+		//organization, see database.SqliteRepository.MergeOrganization), link it again.
+		if linkedMatch != nil {
+			err = m.Repository.LinkOrganizations(org.ID, linkedMatch.CandidateOrganizationID, models.SourceMatching)
+			if err != nil {
+				return nil, err
+			}
+			summary.Relinked++
+			continue
+		}
+
+		scored, err := m.ScoreCandidates(org)
+		if err != nil {
+			return nil, err
+		}
+		var candidates []*Candidate
+		for _, candidate := range scored {
+			if !rejected[candidate.Organization.ID] && candidate.Score >= m.Config.ReviewThreshold {
+				candidates = append(candidates, candidate)
+			}
+		}
+		if len(candidates) == 0 {
+			summary.Unmatched++
+			continue
+		}
+
+		best := candidates[0]
+		if best.Score >= m.Config.AutoLinkThreshold && (len(candidates) == 1 || best.Score-candidates[1].Score >= m.Config.AutoLinkMargin) {
+			m.Logger.Debugf("Linking %s (%s) to %s (%s), score %.2f", org.ID, org.Name, best.Organization.ID, best.Organization.Name, best.Score)
+			err = m.Repository.SaveOrganizationMatch(m.organizationMatch(org, best, models.OrganizationMatchStatusAutoLinked))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to save organization match (%s -> %s) - %v", org.ID, best.Organization.ID, err)
+			}
+			err = m.Repository.LinkOrganizations(org.ID, best.Organization.ID, models.SourceMatching)
+			if err != nil {
+				return nil, err
+			}
+			summary.AutoLinked++
+			continue
+		}
+
+		for _, candidate := range candidates {
+			err = m.Repository.SaveOrganizationMatch(m.organizationMatch(org, candidate, models.OrganizationMatchStatusPending))
+			if err != nil {
+				return nil, fmt.Errorf("Failed to save organization match (%s -> %s) - %v", org.ID, candidate.Organization.ID, err)
+			}
+		}
+		summary.Review++
+	}
+	return &summary, nil
+}
+
+// BuildIndex indexes the names of every organization that unlinked organizations may be matched to (ie. every
+// organization that is not an individual). Run calls BuildIndex, it only needs to be called directly before ScoreCandidates.
+func (m *Matcher) BuildIndex() error {
+	index := similarity.NewIndex()
+	index.MaxPostings = m.Config.MaxPostings
+	err := m.Repository.FindOrganizationNamesInBatches(10000, func(orgs []models.Organization) error {
+		for ndx := range orgs {
+			if orgs[ndx].OrganizationType != models.OrganizationTypeTypeIndividual {
+				index.Add(&orgs[ndx])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to index organization names - %v", err)
+	}
+	m.Logger.Infof("Indexed %d organization names", index.Len())
+	m.index = index
+	return nil
+}
+
+// ScoreCandidates returns the candidate organizations for an unlinked organization, best match first.
+func (m *Matcher) ScoreCandidates(org *models.Organization) ([]*Candidate, error) {
+	if m.index == nil {
+		return nil, fmt.Errorf("organization name index has not been built")
+	}
+
+	candidateOrgs, err := m.Repository.FindOrganizationsByIds(m.index.Candidates(org, m.Config.MaxCandidates))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to find match candidates for organization (%s) - %v", org.ID, err)
+	}
+
+	var candidates []*Candidate
+	for ndx := range candidateOrgs {
+		//other unlinked organizations are not valid candidates, nor are organizations that were unmerged
+		if !hasNPI(&candidateOrgs[ndx]) {
+			continue
+		}
+		blocked, err := m.Repository.IsOrganizationMergeBlocked(org, &candidateOrgs[ndx])
+		if err != nil {
+			return nil, err
+		} else if blocked {
+			continue
+		}
+		candidates = append(candidates, Score(org, &candidateOrgs[ndx], m.index.Weights()))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].Organization.ID < candidates[j].Organization.ID
+	})
+	return candidates, nil
+}
+
+func (m *Matcher) organizationMatch(org *models.Organization, candidate *Candidate, status models.OrganizationMatchStatus) *models.OrganizationMatch {
+	return &models.OrganizationMatch{
+		SourceOrganizationID:    org.ID,
+		SourceOrganizationName:  org.Name,
+		CandidateOrganizationID: candidate.Organization.ID,
+		Score:                   candidate.Score,
+		Reasons:                 candidate.Reasons,
+		Status:                  status,
+	}
+}
+
+func hasNPI(org *models.Organization) bool {
+	for _, identifier := range org.OrganizationIdentifiers {
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeNPI || identifier.IdentifierType == models.OrganizationIdentifierTypePrimaryNPI {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package matching
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/similarity"
+	"sort"
+	"strings"
+)
+
+// weights of each component of the match score, must sum to 1
+const (
+	nameWeight    = 0.6
+	addressWeight = 0.25
+	stateWeight   = 0.15
+)
+
+// Candidate is an organization that may represent the same entity as an unlinked organization
+type Candidate struct {
+	Organization *models.Organization
+	Score        float64
+	Reasons      []string
+}
+
+// Score compares the names (including aliases), addresses and states of two organizations.
+// Name tokens are weighted by their rarity, weights may be nil.
+func Score(org *models.Organization, candidateOrg *models.Organization, weights *similarity.TokenWeights) *Candidate {
+	candidate := Candidate{Organization: candidateOrg}
+
+	nameScore, orgName, candidateName := nameSimilarity(similarity.OrganizationNames(org), similarity.OrganizationNames(candidateOrg), weights)
+	candidate.Reasons = append(candidate.Reasons, fmt.Sprintf("name %.2f (%s ~ %s)", nameScore, orgName, candidateName))
+
+	addressScore, addressReason := addressSimilarity(org.Locations, candidateOrg.Locations)
+	candidate.Reasons = append(candidate.Reasons, fmt.Sprintf("address %.2f (%s)", addressScore, addressReason))
+
+	stateScore, stateReason := stateSimilarity(organizationStates(org), organizationStates(candidateOrg))
+	candidate.Reasons = append(candidate.Reasons, fmt.Sprintf("state %.2f (%s)", stateScore, stateReason))
+
+	candidate.Score = nameWeight*nameScore + addressWeight*addressScore + stateWeight*stateScore
+	return &candidate
+}
+
+// nameSimilarity returns the most similar pair of names
+func nameSimilarity(namesA []string, namesB []string, weights *similarity.TokenWeights) (float64, string, string) {
+	bestScore := 0.0
+	bestA, bestB := "", ""
+	for _, nameA := range namesA {
+		for _, nameB := range namesB {
+			score := similarity.NameSimilarity(nameA, nameB, weights)
+			if score > bestScore || bestA == "" {
+				bestScore, bestA, bestB = score, nameA, nameB
+			}
+		}
+	}
+	return bestScore, bestA, bestB
+}
+
+// addressSimilarity is 1 if the organizations share an address, 0.5 if they share a zip code and 0.25 if they share a city.
+// Organizations without addresses are scored 0.5, so missing data is not penalized as heavily as conflicting data.
+func addressSimilarity(locationsA []models.Location, locationsB []models.Location) (float64, string) {
+	if len(locationsA) == 0 || len(locationsB) == 0 {
+		return 0.5, "no address to compare"
+	}
+	bestScore := 0.0
+	bestReason := "no shared address"
+	for ndx := range locationsA {
+		for ndy := range locationsB {
+			locA, locB := &locationsA[ndx], &locationsB[ndy]
+			if locA.Equal(locB) {
+				return 1, "same address"
+			}
+			if zipA := zip5(locA.PostalCode); zipA != "" && zipA == zip5(locB.PostalCode) && bestScore < 0.5 {
+				bestScore, bestReason = 0.5, fmt.Sprintf("same zip code %s", zipA)
+			} else if locA.City != "" && strings.EqualFold(locA.City, locB.City) && strings.EqualFold(locA.State, locB.State) && bestScore < 0.25 {
+				bestScore, bestReason = 0.25, fmt.Sprintf("same city %s", strings.ToUpper(locA.City))
+			}
+		}
+	}
+	return bestScore, bestReason
+}
+
+func stateSimilarity(statesA []string, statesB []string) (float64, string) {
+	if len(statesA) == 0 || len(statesB) == 0 {
+		return 0.5, "no state to compare"
+	}
+	for _, stateA := range statesA {
+		for _, stateB := range statesB {
+			if stateA == stateB {
+				return 1, fmt.Sprintf("same state %s", stateA)
+			}
+		}
+	}
+	return 0, "different states"
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// Utilities
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+
+func organizationStates(org *models.Organization) []string {
+	states := map[string]bool{}
+	for _, location := range org.Locations {
+		if location.State != "" {
+			states[strings.ToUpper(location.State)] = true
+		}
+	}
+	var stateList []string
+	for state := range states {
+		stateList = append(stateList, state)
+	}
+	sort.Strings(stateList)
+	return stateList
+}
+
+func zip5(postalCode string) string {
+	postalCode = strings.TrimSpace(postalCode)
+	if len(postalCode) > 5 {
+		postalCode = postalCode[:5]
+	}
+	return postalCode
+}
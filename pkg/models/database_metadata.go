@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const (
+	DatabaseMetadataKeySchemaVersion    = "schema_version"
+	DatabaseMetadataKeyNPPESReleaseDate = "nppes_release_date" // YYYY-MM-DD
+	// the utils.NameCanonicalizer version used to compute the stored OrganizationIdentifierTypeName values
+	DatabaseMetadataKeyNameCanonicalizationVersion = "name_canonicalization_version"
+)
+
+// DatabaseMetadata is a simple key/value store describing the database itself (rather than its contents)
+type DatabaseMetadata struct {
+	Key       string    `json:"key" gorm:"primary_key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (DatabaseMetadata) TableName() string {
+	return "database_metadata"
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"gorm.io/gorm"
 	"time"
 )
 
@@ -15,6 +16,16 @@ type Endpoint struct {
 	URL          string `json:"url" gorm:"unique"` //guaranteed to have https/http scheme and '/' suffix
 	SourceUrl    string `json:"source_url"`
 	PlatformType string `json:"platform_type"`
+
+	// hidden by a curation override (see the overrides package), hidden endpoints are not exported
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+func (end *Endpoint) BeforeCreate(tx *gorm.DB) error {
+	if end.ID == "" {
+		end.ID = utils.NormalizeEndpointId(end.URL)
+	}
+	return nil
 }
 
 func (endA *Endpoint) Equal(endB *Endpoint) bool {
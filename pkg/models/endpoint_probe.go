@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type EndpointProbeStatus string
+
+const (
+	EndpointProbeStatusOk    EndpointProbeStatus = "ok"
+	EndpointProbeStatusError EndpointProbeStatus = "error"
+)
+
+// EndpointProbe is the result of a single capability check of an Endpoint. Probes are never updated, so the table
+// contains the status history of every endpoint.
+type EndpointProbe struct {
+	ID         uint                `json:"id" gorm:"primary_key;autoIncrement"`
+	CreatedAt  time.Time           `json:"created_at"`
+	EndpointID string              `json:"endpoint_id" gorm:"index"` //foreign key
+	Status     EndpointProbeStatus `json:"status"`
+	Error      string              `json:"error,omitempty"`
+
+	// FHIR CapabilityStatement ({endpoint}/metadata)
+	MetadataStatusCode     int      `json:"metadata_status_code"`
+	MetadataResponseTimeMs int64    `json:"metadata_response_time_ms"`
+	FhirVersion            string   `json:"fhir_version"`
+	SoftwareName           string   `json:"software_name"`
+	SoftwareVersion        string   `json:"software_version"`
+	SupportedResources     []string `json:"supported_resources" gorm:"type:text;serializer:json"`
+
+	// SMART App Launch configuration ({endpoint}/.well-known/smart-configuration)
+	SmartConfigurationStatusCode     int    `json:"smart_configuration_status_code"`
+	SmartConfigurationResponseTimeMs int64  `json:"smart_configuration_response_time_ms"`
+	AuthorizeUrl                     string `json:"authorize_url"`
+	TokenUrl                         string `json:"token_url"`
+
+	TLSExpiry *time.Time `json:"tls_expiry,omitempty"` // expiry of the endpoint's leaf certificate
+}
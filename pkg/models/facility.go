@@ -0,0 +1,67 @@
+package models
+
+// FacilityOwnership is the type of control of a facility, normalized from the CMS Provider of Services & Hospital General
+// Information ownership values.
+type FacilityOwnership string
+
+const (
+	FacilityOwnershipNonProfit  FacilityOwnership = "non_profit" // voluntary non-profit, incl. church owned
+	FacilityOwnershipForProfit  FacilityOwnership = "for_profit" // proprietary
+	FacilityOwnershipGovernment FacilityOwnership = "government" // federal, state, local, hospital district, DoD & VA
+	FacilityOwnershipPhysician  FacilityOwnership = "physician"
+	FacilityOwnershipTribal     FacilityOwnership = "tribal"
+)
+
+// FacilityType is the canonical type of a facility. The CMS datasets describe the same facility types differently, eg.
+// a "Short Term Hospital" in the Provider of Services file is an "Acute Care Hospitals" in Hospital General Information,
+// so every dataset is mapped to this vocabulary.
+type FacilityType string
+
+const (
+	FacilityTypeHospital                       FacilityType = "hospital" // hospitals without a more specific type
+	FacilityTypeAcuteCareHospital              FacilityType = "acute_care_hospital"
+	FacilityTypeCriticalAccessHospital         FacilityType = "critical_access_hospital"
+	FacilityTypeLongTermCareHospital           FacilityType = "long_term_care_hospital"
+	FacilityTypePsychiatricHospital            FacilityType = "psychiatric_hospital"
+	FacilityTypeRehabilitationHospital         FacilityType = "rehabilitation_hospital"
+	FacilityTypeChildrensHospital              FacilityType = "childrens_hospital"
+	FacilityTypeRuralEmergencyHospital         FacilityType = "rural_emergency_hospital"
+	FacilityTypeTransplantHospital             FacilityType = "transplant_hospital"
+	FacilityTypeReligiousNonMedical            FacilityType = "religious_non_medical_institution"
+	FacilityTypeHomeHealthAgency               FacilityType = "home_health_agency"
+	FacilityTypeESRDFacility                   FacilityType = "esrd_facility" // end stage renal disease (dialysis)
+	FacilityTypeIntermediateCareFacility       FacilityType = "intermediate_care_facility_iid"
+	FacilityTypeRuralHealthClinic              FacilityType = "rural_health_clinic"
+	FacilityTypeOutpatientRehabilitation       FacilityType = "comprehensive_outpatient_rehabilitation_facility"
+	FacilityTypeAmbulatorySurgicalCenter       FacilityType = "ambulatory_surgical_center"
+	FacilityTypeHospice                        FacilityType = "hospice"
+	FacilityTypeOrganProcurementOrganization   FacilityType = "organ_procurement_organization"
+	FacilityTypeCommunityMentalHealthCenter    FacilityType = "community_mental_health_center"
+	FacilityTypeFederallyQualifiedHealthCenter FacilityType = "federally_qualified_health_center"
+	FacilityTypeOther                          FacilityType = "other" // a type that is not part of the vocabulary (yet)
+)
+
+// FacilityTypes is the canonical facility type vocabulary
+var FacilityTypes = []FacilityType{
+	FacilityTypeHospital,
+	FacilityTypeAcuteCareHospital,
+	FacilityTypeCriticalAccessHospital,
+	FacilityTypeLongTermCareHospital,
+	FacilityTypePsychiatricHospital,
+	FacilityTypeRehabilitationHospital,
+	FacilityTypeChildrensHospital,
+	FacilityTypeRuralEmergencyHospital,
+	FacilityTypeTransplantHospital,
+	FacilityTypeReligiousNonMedical,
+	FacilityTypeHomeHealthAgency,
+	FacilityTypeESRDFacility,
+	FacilityTypeIntermediateCareFacility,
+	FacilityTypeRuralHealthClinic,
+	FacilityTypeOutpatientRehabilitation,
+	FacilityTypeAmbulatorySurgicalCenter,
+	FacilityTypeHospice,
+	FacilityTypeOrganProcurementOrganization,
+	FacilityTypeCommunityMentalHealthCenter,
+	FacilityTypeFederallyQualifiedHealthCenter,
+	FacilityTypeOther,
+}
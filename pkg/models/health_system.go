@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// HealthSystem groups the organizations (NPIs) that belong to the same health system, eg. Kaiser Permanente.
+// Health systems are rebuilt by every clustering run.
+type HealthSystem struct {
+	ID        string    `json:"id" gorm:"primary_key;"` // derived from the lowest member organization id, so it is stable between runs
+	CreatedAt time.Time `json:"created_at"`
+	RunID     string    `json:"run_id"`
+
+	Name        string `json:"name"` // representative display name
+	MemberCount int    `json:"member_count" gorm:"index"`
+
+	Members []HealthSystemMember `json:"members,omitempty"`
+}
+
+// HealthSystemMember is an organization that belongs to a HealthSystem. Organizations belong to at most one system.
+type HealthSystemMember struct {
+	OrganizationID string `json:"organization_id" gorm:"primary_key;"`
+	HealthSystemID string `json:"health_system_id" gorm:"index"`
+	// the signals this organization shares with other members, eg. tin:123456789
+	Signals []string `json:"signals" gorm:"type:text;serializer:json"`
+}
@@ -3,11 +3,12 @@ package models
 import (
 	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
 	"gorm.io/gorm"
+	"strings"
 	"time"
 )
 
 type Location struct {
-	ID        string     `json:"id" gorm:"primary_key;"`
+	ID        string     `json:"id" gorm:"primary_key;"` // hash of the standardized address, see ComputeId
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty" gorm:"index"`
@@ -18,11 +19,18 @@ type Location struct {
 	PostalCode string   `json:"postal_code"` // the five-digit zip code.
 	Country    string   `json:"country"`     // the two-letter country code
 
+	PostalCodeExtension string `json:"postal_code_extension,omitempty"` // the four-digit ZIP+4 extension, if known
+
+	// problems found when validating the address against the ZIP code reference (see ValidateLocation), empty if valid
+	// or not validated.
+	ValidationFlags []LocationValidationFlag `json:"validation_flags,omitempty" gorm:"type:text;serializer:json"`
+
 	Organizations []Organization `json:"-" gorm:"many2many:org_locations;"`
 }
 
 func (oi *Location) BeforeCreate(tx *gorm.DB) error {
-	locId, err := utils.NormalizeLocationId(oi.Line, oi.City, oi.State, oi.PostalCode, oi.Country)
+	oi.Standardize()
+	locId, err := oi.ComputeId()
 	if err != nil {
 		return err
 	}
@@ -30,6 +38,12 @@ func (oi *Location) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// ComputeId returns the stable location id: a hash of the standardized address components (see utils.LocationId).
+// The ZIP+4 extension is not part of the id, so the same address with & without an extension is a single location.
+func (loc *Location) ComputeId() (string, error) {
+	return utils.LocationId(loc.Line, loc.City, loc.State, loc.PostalCode, loc.Country)
+}
+
 func (locA *Location) Equal(locB *Location) bool {
 
 	locAAddr, err := utils.NormalizeLocationId(locA.Line, locA.City, locA.State, locA.PostalCode, locA.Country)
@@ -43,3 +57,24 @@ func (locA *Location) Equal(locB *Location) bool {
 
 	return locAAddr == locBAddr
 }
+
+// Standardize converts US addresses to the USPS standard form (upper case, standard abbreviations)
+func (loc *Location) Standardize() {
+	if loc.Country != "" && !strings.EqualFold(loc.Country, "US") {
+		return
+	}
+	var lines []string
+	for _, line := range loc.Line {
+		if standardizedLine := utils.StandardizeAddressLine(line); standardizedLine != "" {
+			lines = append(lines, standardizedLine)
+		}
+	}
+	loc.Line = lines
+	loc.City = utils.StandardizeCity(loc.City)
+	loc.State = utils.StandardizeState(loc.State)
+	zip, zipExtension := utils.StandardizePostalCode(loc.PostalCode)
+	loc.PostalCode = zip
+	if zipExtension != "" {
+		loc.PostalCodeExtension = zipExtension
+	}
+}
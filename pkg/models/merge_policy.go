@@ -0,0 +1,214 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type MergeStrategy string
+
+const (
+	// MergeStrategyKeepExisting never replaces an existing value, the incoming value is only used if the existing value is empty
+	MergeStrategyKeepExisting MergeStrategy = "keep_existing"
+	// MergeStrategyPreferNewest replaces the existing value if the incoming value has a newer (or equal) release date, see
+	// MergePolicySet.fieldSource
+	MergeStrategyPreferNewest MergeStrategy = "prefer_newest"
+	// MergeStrategyPreferPriority replaces the existing value if the incoming value's source has a higher (or equal)
+	// priority, see MergePolicySet.SourcePriority & MergePolicySet.fieldSource
+	MergeStrategyPreferPriority MergeStrategy = "prefer_priority"
+	// MergeStrategyUnion keeps existing values and adds any new values. For single valued fields (eg. Name), the incoming
+	// value is added as an alias where possible, otherwise the existing value is kept.
+	MergeStrategyUnion MergeStrategy = "union"
+)
+
+// MergeField is an Organization field (or association) that can be configured with a MergeStrategy
+type MergeField string
+
+const (
+	MergeFieldName             MergeField = "name"
+	MergeFieldOrganizationType MergeField = "organization_type"
+	MergeFieldTaxonomy         MergeField = "taxonomy"
+	MergeFieldRelatedUrls      MergeField = "related_urls"
+	MergeFieldLocations        MergeField = "locations"
+	MergeFieldEndpoints        MergeField = "endpoints"
+	// facility fields, set by the CMS facility datasets
+	MergeFieldFacilityType      MergeField = "facility_type"
+	MergeFieldOwnership         MergeField = "ownership"
+	MergeFieldBedCount          MergeField = "bed_count"
+	MergeFieldEmergencyServices MergeField = "emergency_services"
+	// identifiers are used to find organizations, so they are never removed. Any strategy other than
+	// MergeStrategyKeepExisting is treated as MergeStrategyUnion.
+	MergeFieldIdentifiers MergeField = "identifiers"
+)
+
+var mergeFields = []MergeField{
+	MergeFieldName,
+	MergeFieldOrganizationType,
+	MergeFieldTaxonomy,
+	MergeFieldRelatedUrls,
+	MergeFieldLocations,
+	MergeFieldEndpoints,
+	MergeFieldFacilityType,
+	MergeFieldOwnership,
+	MergeFieldBedCount,
+	MergeFieldEmergencyServices,
+	MergeFieldIdentifiers,
+}
+
+// MergePolicySet configures how an incoming organization is merged into an existing organization, field by field.
+// See LoadMergePolicySet for the configuration file format.
+type MergePolicySet struct {
+	// Strategy is used for any field without an entry in Fields
+	Strategy MergeStrategy                `json:"strategy" yaml:"strategy"`
+	Fields   map[MergeField]MergeStrategy `json:"fields" yaml:"fields"`
+	// SourcePriority lists sources (see source.go) from highest to lowest priority. Unlisted sources have the lowest priority.
+	SourcePriority []string `json:"source_priority" yaml:"source_priority"`
+}
+
+// DefaultMergePolicySet never removes anything: names become aliases, list fields & associations are unioned and the
+// organization type is only set if it is empty. Facility fields are replaced by the most recently released dataset.
+func DefaultMergePolicySet() MergePolicySet {
+	return MergePolicySet{
+		Strategy: MergeStrategyUnion,
+		Fields: map[MergeField]MergeStrategy{
+			MergeFieldOrganizationType:  MergeStrategyKeepExisting,
+			MergeFieldFacilityType:      MergeStrategyPreferNewest,
+			MergeFieldOwnership:         MergeStrategyPreferNewest,
+			MergeFieldBedCount:          MergeStrategyPreferNewest,
+			MergeFieldEmergencyServices: MergeStrategyPreferNewest,
+		},
+		SourcePriority: []string{SourceNPPES, SourceEpic, SourceCerner, SourceMatching},
+	}
+}
+
+// LoadMergePolicySet reads a merge policy set from a YAML (or .json) file, eg.
+//
+//	strategy: union
+//	fields:
+//	  name: prefer_priority
+//	  locations: prefer_newest
+//	source_priority: [nppes, cms_pos, epic]
+//
+// Settings missing from the file keep their default (see DefaultMergePolicySet), entries in fields are added to the
+// default fields. Returns an error if the file references an unknown field or strategy.
+func LoadMergePolicySet(filePath string) (MergePolicySet, error) {
+	policies := DefaultMergePolicySet()
+	fileBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return policies, err
+	}
+
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(fileBytes))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&policies)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(fileBytes))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&policies)
+		if err == io.EOF {
+			//empty file
+			err = nil
+		}
+	}
+	if err == nil {
+		err = policies.Validate()
+	}
+	if err != nil {
+		return policies, fmt.Errorf("error parsing merge policy file (%s): %v", filePath, err)
+	}
+	return policies, nil
+}
+
+func (policies MergePolicySet) StrategyFor(field MergeField) MergeStrategy {
+	if strategy, ok := policies.Fields[field]; ok {
+		return strategy
+	}
+	if policies.Strategy == "" {
+		return MergeStrategyUnion
+	}
+	return policies.Strategy
+}
+
+// SourceRank returns the priority of the source, lower is higher priority
+func (policies MergePolicySet) SourceRank(source string) int {
+	for ndx, prioritySource := range policies.SourcePriority {
+		if prioritySource == source {
+			return ndx
+		}
+	}
+	return len(policies.SourcePriority)
+}
+
+// prefersIncoming returns true if a replacing strategy should use the incoming value of a field. The existing & incoming
+// values are identified by their provenance keys, see fieldSource.
+func (policies MergePolicySet) prefersIncoming(strategy MergeStrategy, fieldType ProvenanceFieldType, existing *Organization, existingKeys []string, incoming *Organization, incomingKeys []string) bool {
+	switch strategy {
+	case MergeStrategyPreferNewest:
+		_, existingUpdatedAt := policies.fieldSource(existing, fieldType, existingKeys)
+		_, incomingUpdatedAt := policies.fieldSource(incoming, fieldType, incomingKeys)
+		return !incomingUpdatedAt.Before(existingUpdatedAt)
+	case MergeStrategyPreferPriority:
+		existingRank, _ := policies.fieldSource(existing, fieldType, existingKeys)
+		incomingRank, _ := policies.fieldSource(incoming, fieldType, incomingKeys)
+		return incomingRank <= existingRank
+	default:
+		return false
+	}
+}
+
+// fieldSource returns the (highest) source rank & (newest) release date of the organization's provenance for the field
+// values. Values without provenance (eg. stored before provenance was recorded) fall back to the organization's Source &
+// SourceUpdatedAt.
+func (policies MergePolicySet) fieldSource(org *Organization, fieldType ProvenanceFieldType, keys []string) (int, time.Time) {
+	rank := -1
+	var updatedAt time.Time
+	for _, provenance := range org.Provenance {
+		if provenance.FieldType != fieldType || !slices.Contains(keys, provenance.FieldKey) {
+			continue
+		}
+		if sourceRank := policies.SourceRank(provenance.SourceDataset); rank == -1 || sourceRank < rank {
+			rank = sourceRank
+		}
+		if provenance.ReleaseDate.After(updatedAt) {
+			updatedAt = provenance.ReleaseDate
+		}
+	}
+	if rank == -1 {
+		return policies.SourceRank(org.Source), org.SourceUpdatedAt
+	}
+	return rank, updatedAt
+}
+
+// Validate returns an error if the policy set references an unknown field or strategy
+func (policies MergePolicySet) Validate() error {
+	if policies.Strategy != "" && !policies.Strategy.valid() {
+		return fmt.Errorf("unknown merge strategy: %s", policies.Strategy)
+	}
+	for field, strategy := range policies.Fields {
+		if !slices.Contains(mergeFields, field) {
+			return fmt.Errorf("unknown merge field: %s", field)
+		}
+		if !strategy.valid() {
+			return fmt.Errorf("unknown merge strategy for %s: %s", field, strategy)
+		}
+	}
+	return nil
+}
+
+func (strategy MergeStrategy) valid() bool {
+	switch strategy {
+	case MergeStrategyKeepExisting, MergeStrategyPreferNewest, MergeStrategyPreferPriority, MergeStrategyUnion:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergePolicySet_FieldSource(t *testing.T) {
+	policies := MergePolicySet{SourcePriority: testSourcePriority}
+	january := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	june := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	org := &Organization{
+		Source:          SourceCMSHospitalGeneralInformation,
+		SourceUpdatedAt: june,
+		Provenance: []OrganizationProvenance{
+			{FieldType: ProvenanceFieldTypeBedCount, FieldKey: "10", Provenance: Provenance{SourceDataset: SourceCMSProviderOfServices, ReleaseDate: june}},
+			{FieldType: ProvenanceFieldTypeBedCount, FieldKey: "10", Provenance: Provenance{SourceDataset: SourceNPPES, ReleaseDate: january}},
+			// other values & fields are ignored
+			{FieldType: ProvenanceFieldTypeBedCount, FieldKey: "25", Provenance: Provenance{SourceDataset: SourceNPPES, ReleaseDate: june.AddDate(1, 0, 0)}},
+			{FieldType: ProvenanceFieldTypeOwnership, FieldKey: "10", Provenance: Provenance{SourceDataset: SourceNPPES, ReleaseDate: june.AddDate(1, 0, 0)}},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		fieldType   ProvenanceFieldType
+		keys        []string
+		rank        int
+		releaseDate time.Time
+	}{
+		// the highest priority source & the newest release date, which may come from different sources
+		{"multiple sources", ProvenanceFieldTypeBedCount, []string{"10"}, 0, june},
+		// values without provenance fall back to the organization source
+		{"without provenance", ProvenanceFieldTypeBedCount, []string{"30"}, 2, june},
+		{"without provenance for the field", ProvenanceFieldTypeFacilityType, []string{"10"}, 2, june},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			rank, releaseDate := policies.fieldSource(org, testCase.fieldType, testCase.keys)
+			if rank != testCase.rank || !releaseDate.Equal(testCase.releaseDate) {
+				t.Errorf("expected rank %d released %s, got rank %d released %s", testCase.rank, testCase.releaseDate, rank, releaseDate)
+			}
+		})
+	}
+
+	if rank := policies.SourceRank(SourceEpic); rank != len(testSourcePriority) {
+		t.Errorf("expected unlisted sources to have the lowest priority (%d), got %d", len(testSourcePriority), rank)
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergeFieldChange is a single valued field (eg. name, source) that was replaced by a merge
+type MergeFieldChange struct {
+	Field  string `json:"field"` // the json field name
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// MergeConflict is an incoming value that differs from the existing value, but was not applied because of the merge policy
+type MergeConflict struct {
+	Field    MergeField    `json:"field"`
+	Strategy MergeStrategy `json:"strategy"`
+	Existing interface{}   `json:"existing"`
+	Incoming interface{}   `json:"incoming"`
+}
+
+// MergeResult is the exact delta applied to the existing organization by a merge, along with any incoming values that
+// were not applied.
+type MergeResult struct {
+	ChangedFields []MergeFieldChange `json:"changed_fields,omitempty"`
+
+	AddedAliases       []OrganizationIdentifier `json:"added_aliases,omitempty"` // OrganizationIdentifierTypeName identifiers
+	AddedTaxonomy      []string                 `json:"added_taxonomy,omitempty"`
+	RemovedTaxonomy    []string                 `json:"removed_taxonomy,omitempty"`
+	AddedRelatedUrls   []string                 `json:"added_related_urls,omitempty"`
+	RemovedRelatedUrls []string                 `json:"removed_related_urls,omitempty"`
+	AddedLocations     []Location               `json:"added_locations,omitempty"`
+	RemovedLocations   []Location               `json:"removed_locations,omitempty"`
+	AddedEndpoints     []Endpoint               `json:"added_endpoints,omitempty"`
+	RemovedEndpoints   []Endpoint               `json:"removed_endpoints,omitempty"`
+	AddedIdentifiers   []OrganizationIdentifier `json:"added_identifiers,omitempty"` // all other identifiers
+	// identifiers that are not merge keys, see IsMergeKeyIdentifierType
+	AddedAttributeIdentifiers []OrganizationAttributeIdentifier `json:"added_attribute_identifiers,omitempty"`
+	AddedProvenance           []OrganizationProvenance          `json:"added_provenance,omitempty"`
+	UpdatedProvenance         []OrganizationProvenance          `json:"updated_provenance,omitempty"` // existing entries with a new source row or release date
+
+	AddedValidationFindings []ValidationFinding `json:"added_validation_findings,omitempty"`
+
+	Conflicts []MergeConflict `json:"conflicts,omitempty"`
+}
+
+// HasChanges returns true if the merge modified the existing organization. Conflicts are not changes.
+func (result *MergeResult) HasChanges() bool {
+	return len(result.ChangedFields) > 0 ||
+		len(result.AddedAliases) > 0 ||
+		len(result.AddedTaxonomy) > 0 || len(result.RemovedTaxonomy) > 0 ||
+		len(result.AddedRelatedUrls) > 0 || len(result.RemovedRelatedUrls) > 0 ||
+		len(result.AddedLocations) > 0 || len(result.RemovedLocations) > 0 ||
+		len(result.AddedEndpoints) > 0 || len(result.RemovedEndpoints) > 0 ||
+		len(result.AddedIdentifiers) > 0 || len(result.AddedAttributeIdentifiers) > 0 ||
+		len(result.AddedProvenance) > 0 || len(result.UpdatedProvenance) > 0 ||
+		len(result.AddedValidationFindings) > 0
+}
+
+// Plan describes the merge as human readable lines (for dry runs): + added, - removed, ~ changed, ! conflict.
+// Provenance is summarized as a count.
+func (result *MergeResult) Plan() []string {
+	var plan []string
+	for _, change := range result.ChangedFields {
+		plan = append(plan, fmt.Sprintf("~ %s: %q -> %q", change.Field, change.Before, change.After))
+	}
+	for _, alias := range result.AddedAliases {
+		plan = append(plan, fmt.Sprintf("+ alias: %s", alias.IdentifierValue))
+	}
+	for _, taxonomy := range result.AddedTaxonomy {
+		plan = append(plan, fmt.Sprintf("+ taxonomy: %s", taxonomy))
+	}
+	for _, taxonomy := range result.RemovedTaxonomy {
+		plan = append(plan, fmt.Sprintf("- taxonomy: %s", taxonomy))
+	}
+	for _, relatedUrl := range result.AddedRelatedUrls {
+		plan = append(plan, fmt.Sprintf("+ related url: %s", relatedUrl))
+	}
+	for _, relatedUrl := range result.RemovedRelatedUrls {
+		plan = append(plan, fmt.Sprintf("- related url: %s", relatedUrl))
+	}
+	for _, loc := range result.AddedLocations {
+		plan = append(plan, fmt.Sprintf("+ location: %s", locationPlanString(&loc)))
+	}
+	for _, loc := range result.RemovedLocations {
+		plan = append(plan, fmt.Sprintf("- location: %s", locationPlanString(&loc)))
+	}
+	for _, end := range result.AddedEndpoints {
+		plan = append(plan, fmt.Sprintf("+ endpoint: %s", end.URL))
+	}
+	for _, end := range result.RemovedEndpoints {
+		plan = append(plan, fmt.Sprintf("- endpoint: %s", end.URL))
+	}
+	for _, identifier := range result.AddedIdentifiers {
+		plan = append(plan, fmt.Sprintf("+ identifier: %s", IdentifierProvenanceKey(&identifier)))
+	}
+	for _, attr := range result.AddedAttributeIdentifiers {
+		identifier := attr.Identifier()
+		plan = append(plan, fmt.Sprintf("+ attribute identifier: %s", IdentifierProvenanceKey(&identifier)))
+	}
+	if len(result.AddedProvenance) > 0 {
+		plan = append(plan, fmt.Sprintf("+ provenance: %d entries", len(result.AddedProvenance)))
+	}
+	if len(result.UpdatedProvenance) > 0 {
+		plan = append(plan, fmt.Sprintf("~ provenance: %d entries", len(result.UpdatedProvenance)))
+	}
+	for _, finding := range result.AddedValidationFindings {
+		plan = append(plan, fmt.Sprintf("+ validation finding: %s", finding))
+	}
+	for _, conflict := range result.Conflicts {
+		plan = append(plan, fmt.Sprintf("! %s (%s): kept %v, ignored %v", conflict.Field, conflict.Strategy, conflict.Existing, conflict.Incoming))
+	}
+	return plan
+}
+
+func (result *MergeResult) addConflict(field MergeField, strategy MergeStrategy, existing interface{}, incoming interface{}) {
+	result.Conflicts = append(result.Conflicts, MergeConflict{Field: field, Strategy: strategy, Existing: existing, Incoming: incoming})
+}
+
+func locationPlanString(loc *Location) string {
+	var parts []string
+	for _, part := range append(append([]string{}, loc.Line...), loc.City, loc.State, loc.PostalCode, loc.Country) {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
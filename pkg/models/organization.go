@@ -1,9 +1,10 @@
 package models
 
 import (
+	"fmt"
 	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
 	"golang.org/x/exp/slices"
-	"log"
+	"strconv"
 	"time"
 )
 
@@ -24,12 +25,36 @@ type Organization struct {
 	Name             string               `json:"name"`
 	Taxonomy         []string             `json:"taxonomy" gorm:"type:text;serializer:json"` // Taxonomy code mapping: http://www.wpc-edi.com/reference/codelists/healthcare/health-care-provider-taxonomy-code-set/
 	IsSoleProprietor bool                 `json:"is_sole_proprietor"`
-	RelatedUrls      []string             `json:"related_urls" gorm:"type:text;serializer:json"`
-	//Source Updated At?
+	RelatedUrls      []string             `json:"related_urls" gorm:"type:text;serializer:json"` // classified when read, see ClassifyRelatedUrls
+
+	// organization subparts reference the legal business name & taxpayer identification number of their parent organization
+	ParentOrganizationLBN string `json:"parent_organization_lbn,omitempty"`
+	ParentOrganizationTIN string `json:"parent_organization_tin,omitempty"`
+
+	// facility details, only populated for facilities certified by CMS (see the cms importers)
+	FacilityType      FacilityType      `json:"facility_type,omitempty"` // eg. acute_care_hospital
+	Ownership         FacilityOwnership `json:"ownership,omitempty"`
+	BedCount          int               `json:"bed_count,omitempty"`
+	EmergencyServices *bool             `json:"emergency_services,omitempty"` // nil if unknown
+
+	// the source (see source.go) the organization was first loaded from, and when that source last updated it.
+	// The prefer_newest & prefer_priority merge strategies compare the provenance of each field value, these are only
+	// used for values without provenance.
+	Source          string    `json:"source"`
+	SourceUpdatedAt time.Time `json:"source_updated_at"`
+
+	// problems found when validating the imported records (see the validation package), empty if valid
+	ValidationFindings []ValidationFinding `json:"validation_findings,omitempty" gorm:"type:text;serializer:json"`
+
+	// hidden by a curation override (see the overrides package), hidden organizations are not exported
+	Hidden bool `json:"hidden,omitempty"`
 
 	Locations               []Location               `json:"-" gorm:"many2many:org_locations;"`
 	Endpoints               []Endpoint               `json:"-"`
 	OrganizationIdentifiers []OrganizationIdentifier `json:"-"`
+	// identifiers that are not merge keys (eg. state licenses), see IsMergeKeyIdentifierType
+	AttributeIdentifiers []OrganizationAttributeIdentifier `json:"-"`
+	Provenance           []OrganizationProvenance          `json:"provenance,omitempty"`
 }
 
 func (oi *Organization) NormalizeOrganizationName() (string, error) {
@@ -52,125 +77,362 @@ func (oi *Organization) NormalizeOrganizationName() (string, error) {
 //	return nil
 //}
 
-//OrgA must be the "found"/"existing" organization (with an Id)
-func (orgA *Organization) MergeHasChanges(orgB *Organization) (hasChanges bool) {
-	hasChanges = false
+// OrgA must be the "found"/"existing" organization (with an Id)
+// Each field is merged using the strategy configured for it in the policy set, see MergePolicySet. The returned MergeResult
+// lists every change made to orgA, and every incoming value that was not applied.
+func (orgA *Organization) Merge(orgB *Organization, policies MergePolicySet) (*MergeResult, error) {
+	result := &MergeResult{}
+	// replaces compares the provenance of the existing & incoming values of the field, see MergePolicySet.fieldSource
+	replaces := func(field MergeField, fieldType ProvenanceFieldType, existingKeys []string, incomingKeys []string) bool {
+		return policies.prefersIncoming(policies.StrategyFor(field), fieldType, orgA, existingKeys, orgB, incomingKeys)
+	}
 
 	orgAName, err := orgA.NormalizeOrganizationName()
 	if err != nil {
-		log.Printf("Error normalizing organization name: %s", err)
-		return hasChanges
+		return nil, fmt.Errorf("error normalizing organization name: %v", err)
 	}
 
 	orgBName, err := orgB.NormalizeOrganizationName()
 	if err != nil {
-		log.Printf("Error normalizing organization name: %s", err)
-		return hasChanges
+		return nil, fmt.Errorf("error normalizing organization name: %v", err)
 	}
 
-	if orgAName != orgBName {
-		hasChanges = true
-		log.Printf("found new organization name, adding as alias")
+	if orgBName != "" && orgAName != orgBName {
+		nameStrategy := policies.StrategyFor(MergeFieldName)
+		if orgA.Name == "" || replaces(MergeFieldName, ProvenanceFieldTypeName, []string{orgAName}, []string{orgBName}) {
+			result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: string(MergeFieldName), Before: orgA.Name, After: orgB.Name})
+			orgA.Name = orgB.Name
+		} else if nameStrategy != MergeStrategyUnion {
+			result.addConflict(MergeFieldName, nameStrategy, orgA.Name, orgB.Name)
+		}
 		//add a new organization name (alias)
-		orgA.OrganizationIdentifiers = append(orgA.OrganizationIdentifiers, OrganizationIdentifier{
-			IdentifierValue:   orgBName,
-			IdentifierDisplay: orgB.Name,
-			IdentifierType:    OrganizationIdentifierTypeName,
-		})
+		if orgA.Name == orgB.Name || nameStrategy == MergeStrategyUnion {
+			orgA.mergeOrganizationIdentifiers([]OrganizationIdentifier{{
+				IdentifierValue:   orgBName,
+				IdentifierDisplay: orgB.Name,
+				IdentifierType:    OrganizationIdentifierTypeName,
+			}}, result)
+		}
+	}
+
+	if orgB.OrganizationType != "" && orgA.OrganizationType != orgB.OrganizationType {
+		if orgA.OrganizationType == "" || replaces(MergeFieldOrganizationType, ProvenanceFieldTypeOrganizationType, []string{string(orgA.OrganizationType)}, []string{string(orgB.OrganizationType)}) {
+			result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: string(MergeFieldOrganizationType), Before: string(orgA.OrganizationType), After: string(orgB.OrganizationType)})
+			orgA.OrganizationType = orgB.OrganizationType
+		} else {
+			result.addConflict(MergeFieldOrganizationType, policies.StrategyFor(MergeFieldOrganizationType), orgA.OrganizationType, orgB.OrganizationType)
+		}
+	}
 
+	//parent organization fields are only set by NPPES, they are never replaced
+	if orgA.ParentOrganizationLBN == "" && orgB.ParentOrganizationLBN != "" {
+		result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: "parent_organization_lbn", After: orgB.ParentOrganizationLBN})
+		orgA.ParentOrganizationLBN = orgB.ParentOrganizationLBN
 	}
-	if orgA.OrganizationType == "" && orgA.OrganizationType != orgB.OrganizationType {
-		hasChanges = true
-		log.Printf("setting organization type, existing is empty string.")
-		orgA.OrganizationType = orgB.OrganizationType
+	if orgA.ParentOrganizationTIN == "" && orgB.ParentOrganizationTIN != "" {
+		result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: "parent_organization_tin", After: orgB.ParentOrganizationTIN})
+		orgA.ParentOrganizationTIN = orgB.ParentOrganizationTIN
 	}
 
-	slices.Sort(orgA.Taxonomy)
-	slices.Sort(orgB.Taxonomy)
-	if slices.Compare(orgA.Taxonomy, orgB.Taxonomy) != 0 {
-		hasChanges = true
-		log.Printf("taxonomy differencies, merging")
+	//facility fields are only set by CMS datasets, which may disagree (eg. POS & Hospital General Information)
+	if orgB.FacilityType != "" && orgA.FacilityType != orgB.FacilityType {
+		if orgA.FacilityType == "" || replaces(MergeFieldFacilityType, ProvenanceFieldTypeFacilityType, []string{string(orgA.FacilityType)}, []string{string(orgB.FacilityType)}) {
+			result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: string(MergeFieldFacilityType), Before: string(orgA.FacilityType), After: string(orgB.FacilityType)})
+			orgA.FacilityType = orgB.FacilityType
+		} else {
+			result.addConflict(MergeFieldFacilityType, policies.StrategyFor(MergeFieldFacilityType), orgA.FacilityType, orgB.FacilityType)
+		}
+	}
+	if orgB.Ownership != "" && orgA.Ownership != orgB.Ownership {
+		if orgA.Ownership == "" || replaces(MergeFieldOwnership, ProvenanceFieldTypeOwnership, []string{string(orgA.Ownership)}, []string{string(orgB.Ownership)}) {
+			result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: string(MergeFieldOwnership), Before: string(orgA.Ownership), After: string(orgB.Ownership)})
+			orgA.Ownership = orgB.Ownership
+		} else {
+			result.addConflict(MergeFieldOwnership, policies.StrategyFor(MergeFieldOwnership), orgA.Ownership, orgB.Ownership)
+		}
+	}
+	if orgB.BedCount > 0 && orgA.BedCount != orgB.BedCount {
+		if orgA.BedCount == 0 || replaces(MergeFieldBedCount, ProvenanceFieldTypeBedCount, []string{strconv.Itoa(orgA.BedCount)}, []string{strconv.Itoa(orgB.BedCount)}) {
+			result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: string(MergeFieldBedCount), Before: strconv.Itoa(orgA.BedCount), After: strconv.Itoa(orgB.BedCount)})
+			orgA.BedCount = orgB.BedCount
+		} else {
+			result.addConflict(MergeFieldBedCount, policies.StrategyFor(MergeFieldBedCount), orgA.BedCount, orgB.BedCount)
+		}
+	}
+	if orgB.EmergencyServices != nil && (orgA.EmergencyServices == nil || *orgA.EmergencyServices != *orgB.EmergencyServices) {
+		if orgA.EmergencyServices == nil {
+			result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: string(MergeFieldEmergencyServices), After: strconv.FormatBool(*orgB.EmergencyServices)})
+			emergencyServices := *orgB.EmergencyServices
+			orgA.EmergencyServices = &emergencyServices
+		} else if replaces(MergeFieldEmergencyServices, ProvenanceFieldTypeEmergencyServices, []string{strconv.FormatBool(*orgA.EmergencyServices)}, []string{strconv.FormatBool(*orgB.EmergencyServices)}) {
+			result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: string(MergeFieldEmergencyServices), Before: strconv.FormatBool(*orgA.EmergencyServices), After: strconv.FormatBool(*orgB.EmergencyServices)})
+			emergencyServices := *orgB.EmergencyServices
+			orgA.EmergencyServices = &emergencyServices
+		} else {
+			result.addConflict(MergeFieldEmergencyServices, policies.StrategyFor(MergeFieldEmergencyServices), *orgA.EmergencyServices, *orgB.EmergencyServices)
+		}
+	}
 
-		taxonomyList := append(orgA.Taxonomy, orgB.Taxonomy...)
-		slices.Sort(taxonomyList)
-		taxonomyList = slices.Compact(taxonomyList)
-		orgA.Taxonomy = taxonomyList
+	taxonomyStrategy := policies.StrategyFor(MergeFieldTaxonomy)
+	taxonomyList, applied := mergeStringList(orgA.Taxonomy, orgB.Taxonomy, taxonomyStrategy, replaces(MergeFieldTaxonomy, ProvenanceFieldTypeTaxonomy, orgA.Taxonomy, orgB.Taxonomy))
+	if !applied {
+		result.addConflict(MergeFieldTaxonomy, taxonomyStrategy, orgA.Taxonomy, orgB.Taxonomy)
 	}
+	result.AddedTaxonomy = append(result.AddedTaxonomy, missingStrings(orgA.Taxonomy, taxonomyList)...)
+	result.RemovedTaxonomy = append(result.RemovedTaxonomy, missingStrings(taxonomyList, orgA.Taxonomy)...)
+	orgA.Taxonomy = taxonomyList
 
-	slices.Sort(orgA.RelatedUrls)
-	slices.Sort(orgB.RelatedUrls)
-	if slices.Compare(orgA.RelatedUrls, orgB.RelatedUrls) != 0 {
-		hasChanges = true
-		log.Printf("related urls are different, merging")
+	relatedUrlsStrategy := policies.StrategyFor(MergeFieldRelatedUrls)
+	relatedUrlsList, applied := mergeStringList(orgA.RelatedUrls, orgB.RelatedUrls, relatedUrlsStrategy, replaces(MergeFieldRelatedUrls, ProvenanceFieldTypeRelatedUrl, orgA.RelatedUrls, orgB.RelatedUrls))
+	if !applied {
+		result.addConflict(MergeFieldRelatedUrls, relatedUrlsStrategy, orgA.RelatedUrls, orgB.RelatedUrls)
+	}
+	result.AddedRelatedUrls = append(result.AddedRelatedUrls, missingStrings(orgA.RelatedUrls, relatedUrlsList)...)
+	result.RemovedRelatedUrls = append(result.RemovedRelatedUrls, missingStrings(relatedUrlsList, orgA.RelatedUrls)...)
+	orgA.RelatedUrls = relatedUrlsList
 
-		relatedUrlsList := append(orgA.RelatedUrls, orgB.RelatedUrls...)
-		slices.Sort(relatedUrlsList)
-		relatedUrlsList = slices.Compact(relatedUrlsList)
-		orgA.RelatedUrls = relatedUrlsList
+	locationsStrategy := policies.StrategyFor(MergeFieldLocations)
+	if len(orgA.Locations) == 0 || locationsStrategy == MergeStrategyUnion {
+		orgA.mergeLocations(orgB.Locations, result)
+	} else if len(orgB.Locations) > 0 && !sameLocations(orgA.Locations, orgB.Locations) {
+		if replaces(MergeFieldLocations, ProvenanceFieldTypeLocation, locationProvenanceKeys(orgA.Locations), locationProvenanceKeys(orgB.Locations)) {
+			for _, locA := range orgA.Locations {
+				if !hasEqualLocation(orgB.Locations, &locA) {
+					result.RemovedLocations = append(result.RemovedLocations, locA)
+				}
+			}
+			for _, locB := range orgB.Locations {
+				if !hasEqualLocation(orgA.Locations, &locB) {
+					result.AddedLocations = append(result.AddedLocations, locB)
+				}
+			}
+			orgA.Locations = orgB.Locations
+		} else {
+			result.addConflict(MergeFieldLocations, locationsStrategy, locationPlanStrings(orgA.Locations), locationPlanStrings(orgB.Locations))
+		}
 	}
 
-	if orgA.MergeLocationsHasChanges(orgB) {
-		hasChanges = true
+	endpointsStrategy := policies.StrategyFor(MergeFieldEndpoints)
+	if len(orgA.Endpoints) == 0 || endpointsStrategy == MergeStrategyUnion {
+		orgA.mergeEndpoints(orgB.Endpoints, result)
+	} else if len(orgB.Endpoints) > 0 && !sameEndpoints(orgA.Endpoints, orgB.Endpoints) {
+		if replaces(MergeFieldEndpoints, ProvenanceFieldTypeEndpoint, endpointProvenanceKeys(orgA.Endpoints), endpointProvenanceKeys(orgB.Endpoints)) {
+			for _, endA := range orgA.Endpoints {
+				if !hasEqualEndpoint(orgB.Endpoints, &endA) {
+					result.RemovedEndpoints = append(result.RemovedEndpoints, endA)
+				}
+			}
+			for _, endB := range orgB.Endpoints {
+				if !hasEqualEndpoint(orgA.Endpoints, &endB) {
+					result.AddedEndpoints = append(result.AddedEndpoints, endB)
+				}
+			}
+			orgA.Endpoints = orgB.Endpoints
+		} else {
+			result.addConflict(MergeFieldEndpoints, endpointsStrategy, endpointUrls(orgA.Endpoints), endpointUrls(orgB.Endpoints))
+		}
+	}
+
+	if len(orgA.OrganizationIdentifiers) == 0 || policies.StrategyFor(MergeFieldIdentifiers) != MergeStrategyKeepExisting {
+		orgA.mergeOrganizationIdentifiers(orgB.OrganizationIdentifiers, result)
+	}
+	if len(orgA.AttributeIdentifiers) == 0 || policies.StrategyFor(MergeFieldIdentifiers) != MergeStrategyKeepExisting {
+		orgA.mergeAttributeIdentifiers(orgB.AttributeIdentifiers, result)
 	}
-	if orgA.MergeEndpointsHasChanges(orgB) {
-		hasChanges = true
+	//provenance & validation findings are always unioned, they describe every record that was merged
+	orgA.mergeProvenance(orgB.Provenance, result)
+	for _, findingB := range orgB.ValidationFindings {
+		if !hasEqualValidationFinding(orgA.ValidationFindings, &findingB) {
+			orgA.ValidationFindings = append(orgA.ValidationFindings, findingB)
+			result.AddedValidationFindings = append(result.AddedValidationFindings, findingB)
+		}
+	}
+
+	//replacing strategies are decided per field (using provenance), the organization source is only set once, and only
+	//updated by the same source
+	if orgB.Source != "" && orgA.Source == "" {
+		result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: "source", Before: orgA.Source, After: orgB.Source})
+		orgA.Source = orgB.Source
 	}
-	if orgA.MergeOrganizationIdentifiersHasChanges(orgB) {
-		hasChanges = true
+	if orgB.Source != "" && orgA.Source == orgB.Source && !orgA.SourceUpdatedAt.Equal(orgB.SourceUpdatedAt) {
+		result.ChangedFields = append(result.ChangedFields, MergeFieldChange{Field: "source_updated_at", Before: orgA.SourceUpdatedAt.Format(time.RFC3339), After: orgB.SourceUpdatedAt.Format(time.RFC3339)})
+		orgA.SourceUpdatedAt = orgB.SourceUpdatedAt
 	}
 
-	return hasChanges
+	return result, nil
 }
 
-func (orgA *Organization) MergeLocationsHasChanges(orgB *Organization) (hasChanges bool) {
-	hasChanges = false
+// mergeStringList merges list fields (eg. Taxonomy), returning the merged (sorted) list.
+// applied is false if the incoming list differs, but was not applied because of the strategy.
+// replaces is true if a replacing strategy prefers the incoming list.
+// The lists are copied before sorting, the caller's slices are never reordered.
+func mergeStringList(listA []string, listB []string, strategy MergeStrategy, replaces bool) (merged []string, applied bool) {
+	listA = slices.Clone(listA)
+	listB = slices.Clone(listB)
+	slices.Sort(listA)
+	slices.Sort(listB)
+	if len(listB) == 0 || slices.Compare(listA, listB) == 0 {
+		return listA, true
+	}
 
-	//locB is the new location
-	for _, locB := range orgB.Locations {
-		found := false
-		for _, locA := range orgA.Locations {
-			if locA.Equal(&locB) {
-				found = true
-				break
-			}
+	if strategy == MergeStrategyUnion {
+		merged = append(append(merged, listA...), listB...)
+	} else if len(listA) == 0 || replaces {
+		merged = append(merged, listB...)
+	} else {
+		return listA, false
+	}
+	slices.Sort(merged)
+	return slices.Compact(merged), true
+}
+
+// missingStrings returns the values in listB that are not in listA
+func missingStrings(listA []string, listB []string) []string {
+	var missing []string
+	for _, value := range listB {
+		if !slices.Contains(listA, value) {
+			missing = append(missing, value)
 		}
-		if !found {
-			hasChanges = true
-			log.Printf("found new location, adding: %v", locB)
-			log.Printf("existing locations: %v", orgA.Locations)
+	}
+	return missing
+}
 
-			orgA.Locations = append(orgA.Locations, locB)
+func hasEqualLocation(locations []Location, loc *Location) bool {
+	for _, existing := range locations {
+		if existing.Equal(loc) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEqualValidationFinding(findings []ValidationFinding, finding *ValidationFinding) bool {
+	for _, existing := range findings {
+		if existing.Equal(finding) {
+			return true
 		}
 	}
-	return hasChanges
+	return false
 }
 
-func (orgA *Organization) MergeEndpointsHasChanges(orgB *Organization) (hasChanges bool) {
-	hasChanges = false
+func sameLocations(locationsA []Location, locationsB []Location) bool {
+	for ndx := range locationsA {
+		if !hasEqualLocation(locationsB, &locationsA[ndx]) {
+			return false
+		}
+	}
+	for ndx := range locationsB {
+		if !hasEqualLocation(locationsA, &locationsB[ndx]) {
+			return false
+		}
+	}
+	return true
+}
 
-	for _, endB := range orgB.Endpoints {
-		found := false
-		for _, endA := range orgA.Endpoints {
-			if endA.Equal(&endB) {
-				found = true
-				break
-			}
+func locationPlanStrings(locations []Location) []string {
+	var locationStrings []string
+	for ndx := range locations {
+		locationStrings = append(locationStrings, locationPlanString(&locations[ndx]))
+	}
+	return locationStrings
+}
+
+func hasEqualEndpoint(endpoints []Endpoint, end *Endpoint) bool {
+	for _, existing := range endpoints {
+		if existing.Equal(end) {
+			return true
 		}
-		if !found {
-			hasChanges = true
-			log.Printf("found new endpoint, adding: %v", endB)
+	}
+	return false
+}
 
-			orgA.Endpoints = append(orgA.Endpoints, endB)
+func sameEndpoints(endpointsA []Endpoint, endpointsB []Endpoint) bool {
+	for ndx := range endpointsA {
+		if !hasEqualEndpoint(endpointsB, &endpointsA[ndx]) {
+			return false
+		}
+	}
+	for ndx := range endpointsB {
+		if !hasEqualEndpoint(endpointsA, &endpointsB[ndx]) {
+			return false
 		}
 	}
+	return true
+}
 
-	return hasChanges
+func endpointUrls(endpoints []Endpoint) []string {
+	var urls []string
+	for _, end := range endpoints {
+		urls = append(urls, end.URL)
+	}
+	return urls
 }
 
-func (orgA *Organization) MergeOrganizationIdentifiersHasChanges(orgB *Organization) bool {
-	hasChanges := false
+// locationProvenanceKeys returns the OrganizationProvenance.FieldKey of each location (the location id)
+func locationProvenanceKeys(locations []Location) []string {
+	var keys []string
+	for ndx := range locations {
+		if locId, err := locations[ndx].ComputeId(); err == nil {
+			keys = append(keys, locId)
+		}
+	}
+	return keys
+}
 
-	for _, idB := range orgB.OrganizationIdentifiers {
+// endpointProvenanceKeys returns the OrganizationProvenance.FieldKey of each endpoint (the normalized endpoint id)
+func endpointProvenanceKeys(endpoints []Endpoint) []string {
+	var keys []string
+	for _, end := range endpoints {
+		keys = append(keys, utils.NormalizeEndpointId(end.URL))
+	}
+	return keys
+}
+
+// MergeLocations adds any locations of orgB that orgA does not have
+func (orgA *Organization) MergeLocations(orgB *Organization) *MergeResult {
+	result := &MergeResult{}
+	orgA.mergeLocations(orgB.Locations, result)
+	return result
+}
+
+func (orgA *Organization) mergeLocations(locations []Location, result *MergeResult) {
+	//locB is the new location
+	for _, locB := range locations {
+		if !hasEqualLocation(orgA.Locations, &locB) {
+			orgA.Locations = append(orgA.Locations, locB)
+			result.AddedLocations = append(result.AddedLocations, locB)
+		}
+	}
+}
+
+// MergeEndpoints adds any endpoints of orgB that orgA does not have
+func (orgA *Organization) MergeEndpoints(orgB *Organization) *MergeResult {
+	result := &MergeResult{}
+	orgA.mergeEndpoints(orgB.Endpoints, result)
+	return result
+}
+
+func (orgA *Organization) mergeEndpoints(endpoints []Endpoint, result *MergeResult) {
+	for _, endB := range endpoints {
+		if !hasEqualEndpoint(orgA.Endpoints, &endB) {
+			orgA.Endpoints = append(orgA.Endpoints, endB)
+			result.AddedEndpoints = append(result.AddedEndpoints, endB)
+		}
+	}
+}
+
+// MergeOrganizationIdentifiers adds any identifiers (including names) of orgB that orgA does not have
+func (orgA *Organization) MergeOrganizationIdentifiers(orgB *Organization) *MergeResult {
+	result := &MergeResult{}
+	orgA.mergeOrganizationIdentifiers(orgB.OrganizationIdentifiers, result)
+	return result
+}
+
+func (orgA *Organization) mergeOrganizationIdentifiers(identifiers []OrganizationIdentifier, result *MergeResult) {
+	//identifiers that are not merge keys are never stored as OrganizationIdentifiers
+	identifiers, attributes := SplitAttributeIdentifiers(identifiers)
+	orgA.mergeAttributeIdentifiers(attributes, result)
+	for _, idB := range identifiers {
 		found := false
 		for _, idA := range orgA.OrganizationIdentifiers {
 			if idA.Equal(&idB) {
@@ -178,13 +440,14 @@ func (orgA *Organization) MergeOrganizationIdentifiersHasChanges(orgB *Organizat
 				break
 			}
 		}
-		if !found {
-			hasChanges = true
-			log.Printf("found new orgid, adding: %v", idB)
-
-			orgA.OrganizationIdentifiers = append(orgA.OrganizationIdentifiers, idB)
+		if found {
+			continue
+		}
+		orgA.OrganizationIdentifiers = append(orgA.OrganizationIdentifiers, idB)
+		if idB.IdentifierType == OrganizationIdentifierTypeName {
+			result.AddedAliases = append(result.AddedAliases, idB)
+		} else {
+			result.AddedIdentifiers = append(result.AddedIdentifiers, idB)
 		}
 	}
-
-	return hasChanges
 }
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"time"
+)
+
+// IsMergeKeyIdentifierType returns true for identifier types that are globally unique (NPI, CCN, CLIA & OID, along with
+// names). Merge key identifiers belong to a single organization, and are used to find the organization a record belongs
+// to. Identifiers of any other type (PTANs, Medicaid ids, state licenses & Other identifiers) are only unique within a
+// state or issuer, and EINs are shared by every NPI billing under the same tax id, so they are stored as
+// OrganizationAttributeIdentifiers.
+func IsMergeKeyIdentifierType(identifierType OrganizationIdentifierType) bool {
+	switch identifierType {
+	case OrganizationIdentifierTypePrimaryNPI, OrganizationIdentifierTypeNPI, OrganizationIdentifierTypeName,
+		OrganizationIdentifierTypeCCN, OrganizationIdentifierTypeCLIA, OrganizationIdentifierTypeOID:
+		return true
+	default:
+		return false
+	}
+}
+
+// OrganizationAttributeIdentifier is an identifier that is not a merge key (see IsMergeKeyIdentifierType). The same value
+// may be recorded on several organizations, so attribute identifiers are unique per organization, and are never used to
+// find (or merge) organizations.
+type OrganizationAttributeIdentifier struct {
+	ID             uint      `json:"-" gorm:"primary_key;autoIncrement"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	OrganizationID string    `json:"organization_id" gorm:"uniqueIndex:idx_organization_attribute_identifier"` //foreign key
+
+	IdentifierType    OrganizationIdentifierType `json:"identifier_type" gorm:"uniqueIndex:idx_organization_attribute_identifier"`
+	IdentifierValue   string                     `json:"identifier_value" gorm:"uniqueIndex:idx_organization_attribute_identifier"` // see ScopedIdentifierValue
+	IdentifierDisplay string                     `json:"identifier_display"`
+
+	IdentifierIssuer string `json:"identifier_issuer,omitempty"`
+	IdentifierState  string `json:"identifier_state,omitempty"`
+}
+
+func (attr *OrganizationAttributeIdentifier) Equal(attr2 *OrganizationAttributeIdentifier) bool {
+	return attr.IdentifierType == attr2.IdentifierType && attr.IdentifierValue == attr2.IdentifierValue
+}
+
+// Identifier returns the attribute as an OrganizationIdentifier, eg. for exports that list every identifier
+func (attr *OrganizationAttributeIdentifier) Identifier() OrganizationIdentifier {
+	return OrganizationIdentifier{
+		CreatedAt:         attr.CreatedAt,
+		UpdatedAt:         attr.UpdatedAt,
+		OrganizationID:    attr.OrganizationID,
+		IdentifierType:    attr.IdentifierType,
+		IdentifierValue:   attr.IdentifierValue,
+		IdentifierDisplay: attr.IdentifierDisplay,
+		IdentifierIssuer:  attr.IdentifierIssuer,
+		IdentifierState:   attr.IdentifierState,
+	}
+}
+
+// SplitAttributeIdentifiers separates merge key identifiers from attribute identifiers, see IsMergeKeyIdentifierType
+func SplitAttributeIdentifiers(identifiers []OrganizationIdentifier) ([]OrganizationIdentifier, []OrganizationAttributeIdentifier) {
+	var keys []OrganizationIdentifier
+	var attributes []OrganizationAttributeIdentifier
+	for _, identifier := range identifiers {
+		if IsMergeKeyIdentifierType(identifier.IdentifierType) {
+			keys = append(keys, identifier)
+			continue
+		}
+		attributes = append(attributes, OrganizationAttributeIdentifier{
+			OrganizationID:    identifier.OrganizationID,
+			IdentifierType:    identifier.IdentifierType,
+			IdentifierValue:   identifier.IdentifierValue,
+			IdentifierDisplay: identifier.IdentifierDisplay,
+			IdentifierIssuer:  identifier.IdentifierIssuer,
+			IdentifierState:   identifier.IdentifierState,
+		})
+	}
+	return keys, attributes
+}
+
+// AllIdentifiers returns the organization's merge key & attribute identifiers
+func (org *Organization) AllIdentifiers() []OrganizationIdentifier {
+	identifiers := append([]OrganizationIdentifier{}, org.OrganizationIdentifiers...)
+	for ndx := range org.AttributeIdentifiers {
+		identifiers = append(identifiers, org.AttributeIdentifiers[ndx].Identifier())
+	}
+	return identifiers
+}
+
+func (orgA *Organization) mergeAttributeIdentifiers(attributes []OrganizationAttributeIdentifier, result *MergeResult) {
+	for _, attrB := range attributes {
+		found := false
+		for ndx := range orgA.AttributeIdentifiers {
+			if orgA.AttributeIdentifiers[ndx].Equal(&attrB) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		attrB.ID = 0
+		attrB.OrganizationID = orgA.ID
+		orgA.AttributeIdentifiers = append(orgA.AttributeIdentifiers, attrB)
+		result.AddedAttributeIdentifiers = append(result.AddedAttributeIdentifiers, attrB)
+	}
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"fmt"
+	"strings"
 	"time"
 )
 
@@ -11,6 +13,14 @@ const (
 	OrganizationIdentifierTypeNPI        OrganizationIdentifierType = "OrganizationIdentifierTypeNPI"
 	OrganizationIdentifierTypeEIN        OrganizationIdentifierType = "OrganizationIdentifierTypeEIN"
 	OrganizationIdentifierTypeName       OrganizationIdentifierType = "OrganizationIdentifierTypeName"
+
+	OrganizationIdentifierTypeCCN             OrganizationIdentifierType = "OrganizationIdentifierTypeCCN"             // CMS Certification Number (Medicare OSCAR)
+	OrganizationIdentifierTypePTAN            OrganizationIdentifierType = "OrganizationIdentifierTypePTAN"            // Medicare Provider Transaction Access Number (Medicare PIN), state scoped
+	OrganizationIdentifierTypeMedicaidStateID OrganizationIdentifierType = "OrganizationIdentifierTypeMedicaidStateID" // state scoped
+	OrganizationIdentifierTypeCLIA            OrganizationIdentifierType = "OrganizationIdentifierTypeCLIA"            // Clinical Laboratory Improvement Amendments certificate number
+	OrganizationIdentifierTypeOID             OrganizationIdentifierType = "OrganizationIdentifierTypeOID"             // ISO object identifier, eg. 2.16.840.1.113883.3.1234
+	OrganizationIdentifierTypeStateLicense    OrganizationIdentifierType = "OrganizationIdentifierTypeStateLicense"    // state scoped
+	OrganizationIdentifierTypeOther           OrganizationIdentifierType = "OrganizationIdentifierTypeOther"           // issuer scoped
 )
 
 type OrganizationIdentifier struct {
@@ -21,10 +31,40 @@ type OrganizationIdentifier struct {
 	Organization   *Organization `json:"-"`
 
 	IdentifierType    OrganizationIdentifierType `json:"identifier_type" gorm:"primary_key"`
-	IdentifierValue   string                     `json:"identifier_value" gorm:"primary_key"`
+	IdentifierValue   string                     `json:"identifier_value" gorm:"primary_key"` // see ScopedIdentifierValue
 	IdentifierDisplay string                     `json:"identifier_display"`
+
+	IdentifierIssuer string `json:"identifier_issuer,omitempty"` // the organization that issued the identifier, eg. a payer or state agency
+	IdentifierState  string `json:"identifier_state,omitempty"`  // the two-letter state that issued (or scopes) the identifier
 }
 
 func (oi *OrganizationIdentifier) Equal(oi2 *OrganizationIdentifier) bool {
 	return oi.IdentifierType == oi2.IdentifierType && oi.IdentifierValue == oi2.IdentifierValue
 }
+
+// ScopedIdentifierValue returns the IdentifierValue for an identifier. Values that are only unique within a state (eg.
+// Medicaid ids, state licenses & PTANs) are prefixed with the state, and Other identifiers are prefixed with their issuer,
+// eg. CA:123456. The unscoped value should be stored as the IdentifierDisplay.
+// Scoped values are still not globally unique (eg. a Medicaid id without a state), so these identifier types are stored
+// as OrganizationAttributeIdentifiers, see IsMergeKeyIdentifierType.
+func ScopedIdentifierValue(identifierType OrganizationIdentifierType, value string, state string, issuer string) string {
+	value = strings.TrimSpace(value)
+	state = strings.ToUpper(strings.TrimSpace(state))
+	issuer = strings.Join(strings.Fields(strings.ToUpper(issuer)), " ")
+
+	switch identifierType {
+	case OrganizationIdentifierTypePTAN, OrganizationIdentifierTypeMedicaidStateID, OrganizationIdentifierTypeStateLicense:
+		if state != "" {
+			return fmt.Sprintf("%s:%s", state, value)
+		}
+	case OrganizationIdentifierTypeOther:
+		if issuer != "" && state != "" {
+			return fmt.Sprintf("%s:%s:%s", issuer, state, value)
+		} else if issuer != "" {
+			return fmt.Sprintf("%s:%s", issuer, value)
+		} else if state != "" {
+			return fmt.Sprintf("%s:%s", state, value)
+		}
+	}
+	return value
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type OrganizationMatchStatus string
+
+const (
+	OrganizationMatchStatusPending    OrganizationMatchStatus = "pending"     // waiting for review
+	OrganizationMatchStatusAccepted   OrganizationMatchStatus = "accepted"    // accepted by a reviewer, organizations are linked
+	OrganizationMatchStatusRejected   OrganizationMatchStatus = "rejected"    // rejected by a reviewer (or superseded by another accepted match)
+	OrganizationMatchStatusAutoLinked OrganizationMatchStatus = "auto_linked" // confident match, organizations were linked without review
+)
+
+// OrganizationMatch is a candidate link between an unlinked (vendor) organization and an existing (NPPES) organization.
+// Matches are never deleted, so review decisions are remembered when the matcher is re-run.
+type OrganizationMatch struct {
+	ID        uint      `json:"id" gorm:"primary_key;autoIncrement"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	SourceOrganizationID    string `json:"source_organization_id" gorm:"uniqueIndex:idx_organization_match"`
+	SourceOrganizationName  string `json:"source_organization_name"` // kept for review, the source organization is removed once linked
+	CandidateOrganizationID string `json:"candidate_organization_id" gorm:"index;uniqueIndex:idx_organization_match"`
+
+	Score   float64  `json:"score"`                                    // 0-1
+	Reasons []string `json:"reasons" gorm:"type:text;serializer:json"` // human readable explanation of the score
+
+	Status     OrganizationMatchStatus `json:"status" gorm:"index"`
+	ReviewedAt *time.Time              `json:"reviewed_at,omitempty"`
+}
+
+// IsLinked is true if the source organization should be (or has been) merged into the candidate organization
+func (m *OrganizationMatch) IsLinked() bool {
+	return m.Status == OrganizationMatchStatusAccepted || m.Status == OrganizationMatchStatusAutoLinked
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// OrganizationMergeBlock records that records with an identifier must never be joined into an organization, eg. after an
+// organization was unmerged. Blocks are created in pairs, one for each side of the split.
+type OrganizationMergeBlock struct {
+	ID             uint      `json:"id" gorm:"primary_key;autoIncrement"`
+	CreatedAt      time.Time `json:"created_at"`
+	OrganizationID string    `json:"organization_id" gorm:"uniqueIndex:idx_organization_merge_block"`
+
+	IdentifierType  OrganizationIdentifierType `json:"identifier_type" gorm:"uniqueIndex:idx_organization_merge_block"`
+	IdentifierValue string                     `json:"identifier_value" gorm:"uniqueIndex:idx_organization_merge_block"`
+
+	Reason string `json:"reason"`
+}
+
+// Blocks returns true if the block applies to a record with the identifier
+func (block *OrganizationMergeBlock) Blocks(identifier *OrganizationIdentifier) bool {
+	return block.IdentifierType == identifier.IdentifierType && block.IdentifierValue == identifier.IdentifierValue
+}
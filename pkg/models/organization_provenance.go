@@ -0,0 +1,163 @@
+package models
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"strconv"
+	"time"
+)
+
+type ProvenanceFieldType string
+
+const (
+	ProvenanceFieldTypeName       ProvenanceFieldType = "name"
+	ProvenanceFieldTypeTaxonomy   ProvenanceFieldType = "taxonomy"
+	ProvenanceFieldTypeLocation   ProvenanceFieldType = "location"
+	ProvenanceFieldTypeEndpoint   ProvenanceFieldType = "endpoint"
+	ProvenanceFieldTypeIdentifier ProvenanceFieldType = "identifier"
+	ProvenanceFieldTypeRelatedUrl ProvenanceFieldType = "related_url"
+	// single valued fields, keyed by the value
+	ProvenanceFieldTypeOrganizationType  ProvenanceFieldType = "organization_type"
+	ProvenanceFieldTypeFacilityType      ProvenanceFieldType = "facility_type"
+	ProvenanceFieldTypeOwnership         ProvenanceFieldType = "ownership"
+	ProvenanceFieldTypeBedCount          ProvenanceFieldType = "bed_count"
+	ProvenanceFieldTypeEmergencyServices ProvenanceFieldType = "emergency_services"
+)
+
+// Provenance describes where a value was read from.
+type Provenance struct {
+	SourceDataset string    `json:"source_dataset" gorm:"uniqueIndex:idx_organization_provenance"` // eg. nppes
+	SourceFile    string    `json:"source_file" gorm:"uniqueIndex:idx_organization_provenance"`
+	SourceRow     int       `json:"source_row"`   // the (1-based) line number of the record in the source file
+	ReleaseDate   time.Time `json:"release_date"` // the date the source dataset was published
+}
+
+// OrganizationProvenance links a single value (name, organization type, taxonomy, location, endpoint or identifier) of an Organization
+// to the source it was read from. Merged organizations will have multiple provenance entries for the same value, one
+// per source dataset & file. If a file confirms the value more than once, only the last row is kept.
+type OrganizationProvenance struct {
+	ID             uint      `json:"-" gorm:"primary_key;autoIncrement"`
+	CreatedAt      time.Time `json:"created_at"`
+	OrganizationID string    `json:"organization_id" gorm:"index;uniqueIndex:idx_organization_provenance"` //foreign key
+
+	FieldType ProvenanceFieldType `json:"field_type" gorm:"uniqueIndex:idx_organization_provenance"`
+	FieldKey  string              `json:"field_key" gorm:"uniqueIndex:idx_organization_provenance"` // the normalized value, eg. normalized name, location id, endpoint id
+
+	Provenance `gorm:"embedded"`
+}
+
+// Equal returns true if both entries attribute the same value to the same source dataset & file (the unique key).
+// The source row & release date are not compared, see SameSourceRecord.
+func (provA *OrganizationProvenance) Equal(provB *OrganizationProvenance) bool {
+	return provA.FieldType == provB.FieldType &&
+		provA.FieldKey == provB.FieldKey &&
+		provA.SourceDataset == provB.SourceDataset &&
+		provA.SourceFile == provB.SourceFile
+}
+
+// SameSourceRecord returns true if both (Equal) entries also reference the same row & release date
+func (provA *OrganizationProvenance) SameSourceRecord(provB *OrganizationProvenance) bool {
+	return provA.SourceRow == provB.SourceRow && provA.ReleaseDate.Equal(provB.ReleaseDate)
+}
+
+// AddProvenance attributes every name, organization type, taxonomy, related url, location, endpoint & identifier currently
+// on the organization to the specified source.
+func (org *Organization) AddProvenance(provenance Provenance) error {
+	if org.OrganizationType != "" {
+		org.appendProvenance(ProvenanceFieldTypeOrganizationType, string(org.OrganizationType), provenance)
+	}
+	if org.FacilityType != "" {
+		org.appendProvenance(ProvenanceFieldTypeFacilityType, string(org.FacilityType), provenance)
+	}
+	if org.Ownership != "" {
+		org.appendProvenance(ProvenanceFieldTypeOwnership, string(org.Ownership), provenance)
+	}
+	if org.BedCount > 0 {
+		org.appendProvenance(ProvenanceFieldTypeBedCount, strconv.Itoa(org.BedCount), provenance)
+	}
+	if org.EmergencyServices != nil {
+		org.appendProvenance(ProvenanceFieldTypeEmergencyServices, strconv.FormatBool(*org.EmergencyServices), provenance)
+	}
+	for _, identifier := range org.OrganizationIdentifiers {
+		if identifier.IdentifierType == OrganizationIdentifierTypeName {
+			org.appendProvenance(ProvenanceFieldTypeName, identifier.IdentifierValue, provenance)
+		} else {
+			org.appendProvenance(ProvenanceFieldTypeIdentifier, IdentifierProvenanceKey(&identifier), provenance)
+		}
+	}
+	for _, attr := range org.AttributeIdentifiers {
+		identifier := attr.Identifier()
+		org.appendProvenance(ProvenanceFieldTypeIdentifier, IdentifierProvenanceKey(&identifier), provenance)
+	}
+	for _, taxonomy := range org.Taxonomy {
+		org.appendProvenance(ProvenanceFieldTypeTaxonomy, taxonomy, provenance)
+	}
+	for _, relatedUrl := range org.RelatedUrls {
+		org.appendProvenance(ProvenanceFieldTypeRelatedUrl, relatedUrl, provenance)
+	}
+	for _, loc := range org.Locations {
+		locId, err := loc.ComputeId()
+		if err != nil {
+			return err
+		}
+		org.appendProvenance(ProvenanceFieldTypeLocation, locId, provenance)
+	}
+	for _, end := range org.Endpoints {
+		org.appendProvenance(ProvenanceFieldTypeEndpoint, utils.NormalizeEndpointId(end.URL), provenance)
+	}
+	return nil
+}
+
+// MergeProvenance adds any provenance entries of orgB that orgA does not have
+func (orgA *Organization) MergeProvenance(orgB *Organization) *MergeResult {
+	result := &MergeResult{}
+	orgA.mergeProvenance(orgB.Provenance, result)
+	return result
+}
+
+// mergeProvenance adds new provenance entries, and updates the row & release date of existing entries in place.
+// Records that were already seen (same row & release date) are not changes.
+func (orgA *Organization) mergeProvenance(provenance []OrganizationProvenance, result *MergeResult) {
+	for _, provB := range provenance {
+		found := false
+		for ndx := range orgA.Provenance {
+			provA := &orgA.Provenance[ndx]
+			if !provA.Equal(&provB) {
+				continue
+			}
+			found = true
+			if !provA.SameSourceRecord(&provB) {
+				provA.SourceRow = provB.SourceRow
+				provA.ReleaseDate = provB.ReleaseDate
+				result.UpdatedProvenance = append(result.UpdatedProvenance, *provA)
+			}
+			break
+		}
+		if !found {
+			provB.ID = 0
+			orgA.Provenance = append(orgA.Provenance, provB)
+			result.AddedProvenance = append(result.AddedProvenance, provB)
+		}
+	}
+}
+
+func (org *Organization) appendProvenance(fieldType ProvenanceFieldType, fieldKey string, provenance Provenance) {
+	newProvenance := OrganizationProvenance{
+		OrganizationID: org.ID,
+		FieldType:      fieldType,
+		FieldKey:       fieldKey,
+		Provenance:     provenance,
+	}
+	for _, existing := range org.Provenance {
+		if existing.Equal(&newProvenance) {
+			return
+		}
+	}
+	org.Provenance = append(org.Provenance, newProvenance)
+}
+
+// IdentifierProvenanceKey is the OrganizationProvenance.FieldKey used for (non-name) identifiers, including attribute
+// identifiers
+func IdentifierProvenanceKey(identifier *OrganizationIdentifier) string {
+	return fmt.Sprintf("%s:%s", identifier.IdentifierType, identifier.IdentifierValue)
+}
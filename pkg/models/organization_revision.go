@@ -0,0 +1,301 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+type OrganizationRevisionAction string
+
+const (
+	OrganizationRevisionActionCreate OrganizationRevisionAction = "create"
+	OrganizationRevisionActionMerge  OrganizationRevisionAction = "merge"
+	// identifiers, locations & endpoints were split out of (or into) the organization
+	OrganizationRevisionActionUnmerge OrganizationRevisionAction = "unmerge"
+	// a curation override was applied to the organization
+	OrganizationRevisionActionOverride OrganizationRevisionAction = "override"
+	// the organization was linked (merged) into the related organization, and removed
+	OrganizationRevisionActionLink OrganizationRevisionAction = "link"
+)
+
+// the Organization fields (json names) that are tracked in revisions. Associations are tracked separately.
+var organizationRevisionFields = []string{
+	"organization_type",
+	"name",
+	"taxonomy",
+	"is_sole_proprietor",
+	"related_urls",
+	"parent_organization_lbn",
+	"parent_organization_tin",
+	"facility_type",
+	"ownership",
+	"bed_count",
+	"emergency_services",
+	"source",
+	"source_updated_at",
+	"validation_findings",
+	"hidden",
+}
+
+// OrganizationRevision is an immutable record of a single create, merge, unmerge, override or link of an Organization.
+type OrganizationRevision struct {
+	ID             uint      `json:"id" gorm:"primary_key;autoIncrement"`
+	CreatedAt      time.Time `json:"created_at"`
+	OrganizationID string    `json:"organization_id" gorm:"index"` //foreign key
+	RunID          string    `json:"run_id" gorm:"index"`
+	Source         string    `json:"source"`
+	// the organization that was merged into this organization (if it had a different id), or the other side of an unmerge
+	RelatedOrganizationID string `json:"related_organization_id,omitempty"`
+
+	Action OrganizationRevisionAction `json:"action"`
+	Diff   OrganizationDiff           `json:"diff" gorm:"type:text;serializer:json"`
+}
+
+func (rev *OrganizationRevision) BeforeUpdate(tx *gorm.DB) error {
+	return fmt.Errorf("organization revision (%d) is immutable, and cannot be updated", rev.ID)
+}
+
+func (rev *OrganizationRevision) BeforeDelete(tx *gorm.DB) error {
+	return fmt.Errorf("organization revision (%d) is immutable, and cannot be deleted", rev.ID)
+}
+
+type OrganizationFieldChange struct {
+	Field  string          `json:"field"`
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// OrganizationDiff is a structured before/after diff of an Organization's fields and associations
+type OrganizationDiff struct {
+	Fields []OrganizationFieldChange `json:"fields,omitempty"`
+
+	AddedLocations                 []Location                        `json:"added_locations,omitempty"`
+	RemovedLocations               []Location                        `json:"removed_locations,omitempty"`
+	AddedEndpoints                 []Endpoint                        `json:"added_endpoints,omitempty"`
+	RemovedEndpoints               []Endpoint                        `json:"removed_endpoints,omitempty"`
+	AddedOrganizationIdentifiers   []OrganizationIdentifier          `json:"added_organization_identifiers,omitempty"`
+	RemovedOrganizationIdentifiers []OrganizationIdentifier          `json:"removed_organization_identifiers,omitempty"`
+	AddedAttributeIdentifiers      []OrganizationAttributeIdentifier `json:"added_attribute_identifiers,omitempty"`
+	RemovedAttributeIdentifiers    []OrganizationAttributeIdentifier `json:"removed_attribute_identifiers,omitempty"`
+}
+
+func (diff *OrganizationDiff) IsEmpty() bool {
+	return len(diff.Fields) == 0 &&
+		len(diff.AddedLocations) == 0 && len(diff.RemovedLocations) == 0 &&
+		len(diff.AddedEndpoints) == 0 && len(diff.RemovedEndpoints) == 0 &&
+		len(diff.AddedOrganizationIdentifiers) == 0 && len(diff.RemovedOrganizationIdentifiers) == 0 &&
+		len(diff.AddedAttributeIdentifiers) == 0 && len(diff.RemovedAttributeIdentifiers) == 0
+}
+
+// DiffOrganizations compares two persisted versions of the same Organization.
+// before may be nil, in which case every field & association in after is considered new.
+func DiffOrganizations(before *Organization, after *Organization) (OrganizationDiff, error) {
+	diff := OrganizationDiff{}
+	if before == nil {
+		before = &Organization{}
+	}
+
+	beforeFields, err := organizationRevisionFieldValues(before)
+	if err != nil {
+		return diff, err
+	}
+	afterFields, err := organizationRevisionFieldValues(after)
+	if err != nil {
+		return diff, err
+	}
+	for _, field := range organizationRevisionFields {
+		if !bytes.Equal(beforeFields[field], afterFields[field]) {
+			diff.Fields = append(diff.Fields, OrganizationFieldChange{
+				Field:  field,
+				Before: beforeFields[field],
+				After:  afterFields[field],
+			})
+		}
+	}
+
+	for _, locA := range after.Locations {
+		if !containsLocation(before.Locations, &locA) {
+			diff.AddedLocations = append(diff.AddedLocations, locA)
+		}
+	}
+	for _, locB := range before.Locations {
+		if !containsLocation(after.Locations, &locB) {
+			diff.RemovedLocations = append(diff.RemovedLocations, locB)
+		}
+	}
+
+	for _, endA := range after.Endpoints {
+		if !containsEndpoint(before.Endpoints, &endA) {
+			diff.AddedEndpoints = append(diff.AddedEndpoints, endA)
+		}
+	}
+	for _, endB := range before.Endpoints {
+		if !containsEndpoint(after.Endpoints, &endB) {
+			diff.RemovedEndpoints = append(diff.RemovedEndpoints, endB)
+		}
+	}
+
+	for _, idA := range after.OrganizationIdentifiers {
+		if !containsOrganizationIdentifier(before.OrganizationIdentifiers, &idA) {
+			diff.AddedOrganizationIdentifiers = append(diff.AddedOrganizationIdentifiers, idA)
+		}
+	}
+	for _, idB := range before.OrganizationIdentifiers {
+		if !containsOrganizationIdentifier(after.OrganizationIdentifiers, &idB) {
+			diff.RemovedOrganizationIdentifiers = append(diff.RemovedOrganizationIdentifiers, idB)
+		}
+	}
+
+	for _, attrA := range after.AttributeIdentifiers {
+		if !containsAttributeIdentifier(before.AttributeIdentifiers, &attrA) {
+			diff.AddedAttributeIdentifiers = append(diff.AddedAttributeIdentifiers, attrA)
+		}
+	}
+	for _, attrB := range before.AttributeIdentifiers {
+		if !containsAttributeIdentifier(after.AttributeIdentifiers, &attrB) {
+			diff.RemovedAttributeIdentifiers = append(diff.RemovedAttributeIdentifiers, attrB)
+		}
+	}
+
+	return diff, nil
+}
+
+// ApplyDiff replays a revision diff on top of the organization, moving it forward to the "after" state of the revision.
+func (org *Organization) ApplyDiff(diff OrganizationDiff) error {
+	if len(diff.Fields) > 0 {
+		fieldValues, err := organizationRevisionFieldValues(org)
+		if err != nil {
+			return err
+		}
+		for _, fieldChange := range diff.Fields {
+			fieldValues[fieldChange.Field] = fieldChange.After
+		}
+		fieldValuesJson, err := json.Marshal(fieldValues)
+		if err != nil {
+			return err
+		}
+		//associations are not serialized, so they are left as-is.
+		err = json.Unmarshal(fieldValuesJson, org)
+		if err != nil {
+			return fmt.Errorf("error applying organization field changes: %v", err)
+		}
+	}
+
+	for _, locB := range diff.RemovedLocations {
+		org.Locations = removeLocation(org.Locations, &locB)
+	}
+	org.Locations = append(org.Locations, diff.AddedLocations...)
+
+	for _, endB := range diff.RemovedEndpoints {
+		org.Endpoints = removeEndpoint(org.Endpoints, &endB)
+	}
+	org.Endpoints = append(org.Endpoints, diff.AddedEndpoints...)
+
+	for _, idB := range diff.RemovedOrganizationIdentifiers {
+		org.OrganizationIdentifiers = removeOrganizationIdentifier(org.OrganizationIdentifiers, &idB)
+	}
+	org.OrganizationIdentifiers = append(org.OrganizationIdentifiers, diff.AddedOrganizationIdentifiers...)
+
+	for _, attrB := range diff.RemovedAttributeIdentifiers {
+		org.AttributeIdentifiers = removeAttributeIdentifier(org.AttributeIdentifiers, &attrB)
+	}
+	org.AttributeIdentifiers = append(org.AttributeIdentifiers, diff.AddedAttributeIdentifiers...)
+	return nil
+}
+
+func organizationRevisionFieldValues(org *Organization) (map[string]json.RawMessage, error) {
+	orgJson, err := json.Marshal(org)
+	if err != nil {
+		return nil, err
+	}
+	allFields := map[string]json.RawMessage{}
+	err = json.Unmarshal(orgJson, &allFields)
+	if err != nil {
+		return nil, err
+	}
+
+	fieldValues := map[string]json.RawMessage{}
+	for _, field := range organizationRevisionFields {
+		fieldValues[field] = allFields[field]
+	}
+	return fieldValues, nil
+}
+
+func containsLocation(locations []Location, loc *Location) bool {
+	for _, existing := range locations {
+		if existing.ID == loc.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func removeLocation(locations []Location, loc *Location) []Location {
+	var remaining []Location
+	for _, existing := range locations {
+		if existing.ID != loc.ID {
+			remaining = append(remaining, existing)
+		}
+	}
+	return remaining
+}
+
+func containsEndpoint(endpoints []Endpoint, end *Endpoint) bool {
+	for _, existing := range endpoints {
+		if existing.ID == end.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func removeEndpoint(endpoints []Endpoint, end *Endpoint) []Endpoint {
+	var remaining []Endpoint
+	for _, existing := range endpoints {
+		if existing.ID != end.ID {
+			remaining = append(remaining, existing)
+		}
+	}
+	return remaining
+}
+
+func containsOrganizationIdentifier(identifiers []OrganizationIdentifier, identifier *OrganizationIdentifier) bool {
+	for _, existing := range identifiers {
+		if existing.Equal(identifier) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeOrganizationIdentifier(identifiers []OrganizationIdentifier, identifier *OrganizationIdentifier) []OrganizationIdentifier {
+	var remaining []OrganizationIdentifier
+	for _, existing := range identifiers {
+		if !existing.Equal(identifier) {
+			remaining = append(remaining, existing)
+		}
+	}
+	return remaining
+}
+
+func containsAttributeIdentifier(attributes []OrganizationAttributeIdentifier, attr *OrganizationAttributeIdentifier) bool {
+	for _, existing := range attributes {
+		if existing.Equal(attr) {
+			return true
+		}
+	}
+	return false
+}
+
+func removeAttributeIdentifier(attributes []OrganizationAttributeIdentifier, attr *OrganizationAttributeIdentifier) []OrganizationAttributeIdentifier {
+	var remaining []OrganizationAttributeIdentifier
+	for _, existing := range attributes {
+		if !existing.Equal(attr) {
+			remaining = append(remaining, existing)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,454 @@
+package models
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"golang.org/x/exp/slices"
+)
+
+// testSource is the source dataset an organization was read from
+type testSource struct {
+	dataset     string
+	releaseDate string // YYYY-MM-DD
+	provenance  bool   // false for values stored before provenance was recorded
+}
+
+var testSourcePriority = []string{SourceNPPES, SourceCMSProviderOfServices, SourceCMSHospitalGeneralInformation}
+
+// testRecord returns the organization as read from the source: its name is added as a name identifier (like the
+// importers do), and every value is attributed to the source unless it has no provenance.
+func testRecord(t *testing.T, source testSource, org Organization) *Organization {
+	t.Helper()
+	if org.Name == "" {
+		org.Name = "Alpha Clinic"
+	}
+	normalizedName, err := utils.NormalizeOrganizationName(org.Name)
+	if err != nil {
+		t.Fatalf("failed to normalize name (%s): %v", org.Name, err)
+	}
+	org.OrganizationIdentifiers = append(org.OrganizationIdentifiers, OrganizationIdentifier{
+		IdentifierType:    OrganizationIdentifierTypeName,
+		IdentifierValue:   normalizedName,
+		IdentifierDisplay: org.Name,
+	})
+
+	releaseDate, err := time.Parse("2006-01-02", source.releaseDate)
+	if err != nil {
+		t.Fatalf("invalid release date (%s): %v", source.releaseDate, err)
+	}
+	org.Source = source.dataset
+	org.SourceUpdatedAt = releaseDate
+	if source.provenance {
+		err = org.AddProvenance(Provenance{SourceDataset: source.dataset, SourceFile: source.dataset + ".csv", ReleaseDate: releaseDate})
+		if err != nil {
+			t.Fatalf("failed to add provenance: %v", err)
+		}
+	}
+	return &org
+}
+
+func testPolicies(field MergeField, strategy MergeStrategy) MergePolicySet {
+	return MergePolicySet{
+		Strategy:       MergeStrategyUnion,
+		Fields:         map[MergeField]MergeStrategy{field: strategy},
+		SourcePriority: testSourcePriority,
+	}
+}
+
+func hasConflict(result *MergeResult, field MergeField) bool {
+	for _, conflict := range result.Conflicts {
+		if conflict.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func hasChangedField(result *MergeResult, field MergeField) bool {
+	for _, change := range result.ChangedFields {
+		if change.Field == string(field) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	testEmergencyServices   = true
+	testNoEmergencyServices = false
+)
+
+// singleValuedFields have an existing & a different incoming value, and read the value of the field
+var singleValuedFields = []struct {
+	field    MergeField
+	existing Organization
+	incoming Organization
+	value    func(org *Organization) string
+}{
+	{MergeFieldName, Organization{Name: "Alpha Clinic"}, Organization{Name: "Beta Clinic"},
+		func(org *Organization) string { return org.Name }},
+	{MergeFieldOrganizationType, Organization{OrganizationType: OrganizationTypeTypeIndividual}, Organization{OrganizationType: OrganizationTypeTypeOrganization},
+		func(org *Organization) string { return string(org.OrganizationType) }},
+	{MergeFieldFacilityType, Organization{FacilityType: FacilityTypeHospital}, Organization{FacilityType: FacilityTypeCriticalAccessHospital},
+		func(org *Organization) string { return string(org.FacilityType) }},
+	{MergeFieldOwnership, Organization{Ownership: FacilityOwnershipNonProfit}, Organization{Ownership: FacilityOwnershipForProfit},
+		func(org *Organization) string { return string(org.Ownership) }},
+	{MergeFieldBedCount, Organization{BedCount: 10}, Organization{BedCount: 25},
+		func(org *Organization) string { return strconv.Itoa(org.BedCount) }},
+	{MergeFieldEmergencyServices, Organization{EmergencyServices: &testEmergencyServices}, Organization{EmergencyServices: &testNoEmergencyServices},
+		func(org *Organization) string {
+			if org.EmergencyServices == nil {
+				return ""
+			}
+			return strconv.FormatBool(*org.EmergencyServices)
+		}},
+}
+
+func TestOrganizationMerge_SingleValuedFields(t *testing.T) {
+	testCases := []struct {
+		name     string
+		strategy MergeStrategy
+		existing testSource
+		incoming testSource
+		replaced bool
+	}{
+		{"keep existing", MergeStrategyKeepExisting,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceNPPES, "2024-06-01", true}, false},
+		{"union", MergeStrategyUnion,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceNPPES, "2024-06-01", true}, false},
+		{"prefer newest, newer", MergeStrategyPreferNewest,
+			testSource{SourceCMSProviderOfServices, "2024-01-01", true}, testSource{SourceCMSHospitalGeneralInformation, "2024-06-01", true}, true},
+		{"prefer newest, older", MergeStrategyPreferNewest,
+			testSource{SourceCMSProviderOfServices, "2024-06-01", true}, testSource{SourceCMSHospitalGeneralInformation, "2024-01-01", true}, false},
+		{"prefer newest, same release date", MergeStrategyPreferNewest,
+			testSource{SourceCMSProviderOfServices, "2024-01-01", true}, testSource{SourceCMSHospitalGeneralInformation, "2024-01-01", true}, true},
+		{"prefer newest, newer without provenance", MergeStrategyPreferNewest,
+			testSource{SourceCMSProviderOfServices, "2024-01-01", false}, testSource{SourceCMSHospitalGeneralInformation, "2024-06-01", true}, true},
+		{"prefer newest, older without provenance", MergeStrategyPreferNewest,
+			testSource{SourceCMSProviderOfServices, "2024-06-01", false}, testSource{SourceCMSHospitalGeneralInformation, "2024-01-01", true}, false},
+		{"prefer priority, higher", MergeStrategyPreferPriority,
+			testSource{SourceCMSProviderOfServices, "2024-06-01", true}, testSource{SourceNPPES, "2024-01-01", true}, true},
+		{"prefer priority, lower", MergeStrategyPreferPriority,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceCMSProviderOfServices, "2024-06-01", true}, false},
+		{"prefer priority, same source", MergeStrategyPreferPriority,
+			testSource{SourceCMSProviderOfServices, "2024-06-01", true}, testSource{SourceCMSProviderOfServices, "2024-01-01", true}, true},
+		{"prefer priority, unlisted sources", MergeStrategyPreferPriority,
+			testSource{SourceEpic, "2024-01-01", true}, testSource{SourceCerner, "2024-01-01", true}, true},
+		{"prefer priority, higher without provenance", MergeStrategyPreferPriority,
+			testSource{SourceCMSProviderOfServices, "2024-01-01", false}, testSource{SourceNPPES, "2024-01-01", true}, true},
+		{"prefer priority, lower without provenance", MergeStrategyPreferPriority,
+			testSource{SourceNPPES, "2024-01-01", false}, testSource{SourceCMSProviderOfServices, "2024-01-01", true}, false},
+	}
+	for _, field := range singleValuedFields {
+		for _, testCase := range testCases {
+			t.Run(string(field.field)+"/"+testCase.name, func(t *testing.T) {
+				existing := testRecord(t, testCase.existing, field.existing)
+				incoming := testRecord(t, testCase.incoming, field.incoming)
+				existingValue, incomingValue := field.value(existing), field.value(incoming)
+
+				result, err := existing.Merge(incoming, testPolicies(field.field, testCase.strategy))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if testCase.replaced {
+					if value := field.value(existing); value != incomingValue {
+						t.Errorf("expected the incoming value %q, got %q", incomingValue, value)
+					}
+					if !hasChangedField(result, field.field) {
+						t.Errorf("expected a changed field, got %v", result.ChangedFields)
+					}
+					if hasConflict(result, field.field) {
+						t.Errorf("expected no conflict, got %v", result.Conflicts)
+					}
+					return
+				}
+				if value := field.value(existing); value != existingValue {
+					t.Errorf("expected the existing value %q, got %q", existingValue, value)
+				}
+				if hasChangedField(result, field.field) {
+					t.Errorf("expected no changed field, got %v", result.ChangedFields)
+				}
+				// the incoming name is kept as an alias instead of a conflict
+				unionName := field.field == MergeFieldName && testCase.strategy == MergeStrategyUnion
+				if hasConflict(result, field.field) == unionName {
+					t.Errorf("expected a conflict (%t), got %v", !unionName, result.Conflicts)
+				}
+			})
+		}
+	}
+}
+
+func TestOrganizationMerge_EmptyExistingValue(t *testing.T) {
+	for _, field := range singleValuedFields {
+		if field.field == MergeFieldName {
+			continue
+		}
+		t.Run(string(field.field), func(t *testing.T) {
+			existing := testRecord(t, testSource{SourceNPPES, "2024-06-01", true}, Organization{})
+			incoming := testRecord(t, testSource{SourceCMSProviderOfServices, "2024-01-01", true}, field.incoming)
+
+			// the incoming value is older & lower priority, but the existing value is empty
+			result, err := existing.Merge(incoming, testPolicies(field.field, MergeStrategyKeepExisting))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if value, incomingValue := field.value(existing), field.value(incoming); value != incomingValue {
+				t.Errorf("expected the incoming value %q, got %q", incomingValue, value)
+			}
+			if !hasChangedField(result, field.field) || hasConflict(result, field.field) {
+				t.Errorf("expected a changed field without conflicts, got %v %v", result.ChangedFields, result.Conflicts)
+			}
+		})
+	}
+}
+
+func TestOrganizationMerge_NameAlias(t *testing.T) {
+	testCases := []struct {
+		strategy            MergeStrategy
+		identifiersStrategy MergeStrategy
+		name                string
+		alias               bool
+	}{
+		// the existing name is kept, and the incoming name is added as an alias
+		{MergeStrategyUnion, MergeStrategyKeepExisting, "Alpha Clinic", true},
+		// the incoming name replaces the existing name, and is searchable as an alias
+		{MergeStrategyPreferNewest, MergeStrategyKeepExisting, "Beta Clinic", true},
+		{MergeStrategyKeepExisting, MergeStrategyKeepExisting, "Alpha Clinic", false},
+		// the incoming name identifier is still merged with the other identifiers
+		{MergeStrategyKeepExisting, MergeStrategyUnion, "Alpha Clinic", true},
+	}
+	for _, testCase := range testCases {
+		t.Run(string(testCase.strategy)+"/identifiers "+string(testCase.identifiersStrategy), func(t *testing.T) {
+			existing := testRecord(t, testSource{SourceNPPES, "2024-01-01", true}, Organization{Name: "Alpha Clinic"})
+			incoming := testRecord(t, testSource{SourceNPPES, "2024-06-01", true}, Organization{Name: "Beta Clinic"})
+
+			policies := testPolicies(MergeFieldName, testCase.strategy)
+			policies.Fields[MergeFieldIdentifiers] = testCase.identifiersStrategy
+			result, err := existing.Merge(incoming, policies)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if existing.Name != testCase.name {
+				t.Errorf("expected name %q, got %q", testCase.name, existing.Name)
+			}
+			alias, _ := utils.NormalizeOrganizationName("Beta Clinic")
+			addedAlias := false
+			for _, identifier := range result.AddedAliases {
+				addedAlias = addedAlias || identifier.IdentifierValue == alias
+			}
+			if addedAlias != testCase.alias {
+				t.Errorf("expected alias added (%t), got %v", testCase.alias, result.AddedAliases)
+			}
+		})
+	}
+}
+
+func TestOrganizationMerge_ListFields(t *testing.T) {
+	fields := []struct {
+		field    MergeField
+		existing []string
+		incoming []string
+		list     func(org *Organization) *[]string
+	}{
+		{MergeFieldTaxonomy, []string{"261QP2300X", "207Q00000X"}, []string{"282N00000X", "207Q00000X"},
+			func(org *Organization) *[]string { return &org.Taxonomy }},
+		{MergeFieldRelatedUrls, []string{"https://www.beta.example.com/", "https://www.alpha.example.com/"}, []string{"https://www.gamma.example.com/", "https://www.alpha.example.com/"},
+			func(org *Organization) *[]string { return &org.RelatedUrls }},
+	}
+	testCases := []struct {
+		name     string
+		strategy MergeStrategy
+		existing testSource
+		incoming testSource
+		// the expected list, from the sorted existing & incoming lists
+		expected func(existing []string, incoming []string) []string
+		conflict bool
+	}{
+		{"union", MergeStrategyUnion,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceNPPES, "2024-06-01", true},
+			func(existing []string, incoming []string) []string {
+				merged := append(slices.Clone(existing), incoming...)
+				slices.Sort(merged)
+				return slices.Compact(merged)
+			}, false},
+		{"keep existing", MergeStrategyKeepExisting,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceNPPES, "2024-06-01", true},
+			func(existing []string, incoming []string) []string { return existing }, true},
+		{"prefer newest, newer", MergeStrategyPreferNewest,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceNPPES, "2024-06-01", true},
+			func(existing []string, incoming []string) []string { return incoming }, false},
+		{"prefer newest, older", MergeStrategyPreferNewest,
+			testSource{SourceNPPES, "2024-06-01", true}, testSource{SourceNPPES, "2024-01-01", true},
+			func(existing []string, incoming []string) []string { return existing }, true},
+		{"prefer priority, higher", MergeStrategyPreferPriority,
+			testSource{SourceCMSProviderOfServices, "2024-01-01", true}, testSource{SourceNPPES, "2024-01-01", true},
+			func(existing []string, incoming []string) []string { return incoming }, false},
+		{"prefer priority, lower", MergeStrategyPreferPriority,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceCMSProviderOfServices, "2024-01-01", true},
+			func(existing []string, incoming []string) []string { return existing }, true},
+	}
+	for _, field := range fields {
+		for _, testCase := range testCases {
+			t.Run(string(field.field)+"/"+testCase.name, func(t *testing.T) {
+				existingOrg, incomingOrg := Organization{}, Organization{}
+				*field.list(&existingOrg) = slices.Clone(field.existing)
+				*field.list(&incomingOrg) = slices.Clone(field.incoming)
+				existing := testRecord(t, testCase.existing, existingOrg)
+				incoming := testRecord(t, testCase.incoming, incomingOrg)
+
+				result, err := existing.Merge(incoming, testPolicies(field.field, testCase.strategy))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				sortedExisting, sortedIncoming := slices.Clone(field.existing), slices.Clone(field.incoming)
+				slices.Sort(sortedExisting)
+				slices.Sort(sortedIncoming)
+				expected := testCase.expected(sortedExisting, sortedIncoming)
+				if list := *field.list(existing); slices.Compare(list, expected) != 0 {
+					t.Errorf("expected %v, got %v", expected, list)
+				}
+				if hasConflict(result, field.field) != testCase.conflict {
+					t.Errorf("expected a conflict (%t), got %v", testCase.conflict, result.Conflicts)
+				}
+				// the incoming organization is not modified
+				if list := *field.list(incoming); slices.Compare(list, field.incoming) != 0 {
+					t.Errorf("expected the incoming list to keep its order %v, got %v", field.incoming, list)
+				}
+			})
+		}
+	}
+}
+
+func TestOrganizationMerge_Associations(t *testing.T) {
+	locationA := Location{Line: []string{"100 Main St"}, City: "Springfield", State: "IL", PostalCode: "62701", Country: "US"}
+	locationB := Location{Line: []string{"200 Oak Ave"}, City: "Springfield", State: "IL", PostalCode: "62702", Country: "US"}
+	endpointA := Endpoint{URL: "https://fhir.alpha.example.com/r4/"}
+	endpointB := Endpoint{URL: "https://fhir.beta.example.com/r4/"}
+
+	fields := []struct {
+		field    MergeField
+		existing Organization
+		incoming Organization
+		keys     func(org *Organization) []string
+		added    func(result *MergeResult) int
+		removed  func(result *MergeResult) int
+	}{
+		{MergeFieldLocations, Organization{Locations: []Location{locationA}}, Organization{Locations: []Location{locationB}},
+			func(org *Organization) []string { return locationProvenanceKeys(org.Locations) },
+			func(result *MergeResult) int { return len(result.AddedLocations) },
+			func(result *MergeResult) int { return len(result.RemovedLocations) }},
+		{MergeFieldEndpoints, Organization{Endpoints: []Endpoint{endpointA}}, Organization{Endpoints: []Endpoint{endpointB}},
+			func(org *Organization) []string { return endpointProvenanceKeys(org.Endpoints) },
+			func(result *MergeResult) int { return len(result.AddedEndpoints) },
+			func(result *MergeResult) int { return len(result.RemovedEndpoints) }},
+	}
+	testCases := []struct {
+		name     string
+		strategy MergeStrategy
+		existing testSource
+		incoming testSource
+		// the existing & incoming values that are kept
+		keepExisting bool
+		keepIncoming bool
+		conflict     bool
+	}{
+		{"union", MergeStrategyUnion,
+			testSource{SourceNPPES, "2024-06-01", true}, testSource{SourceNPPES, "2024-01-01", true}, true, true, false},
+		{"keep existing", MergeStrategyKeepExisting,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceNPPES, "2024-06-01", true}, true, false, true},
+		{"prefer newest, newer", MergeStrategyPreferNewest,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceNPPES, "2024-06-01", true}, false, true, false},
+		{"prefer newest, older", MergeStrategyPreferNewest,
+			testSource{SourceNPPES, "2024-06-01", true}, testSource{SourceNPPES, "2024-01-01", true}, true, false, true},
+		{"prefer newest, same release date", MergeStrategyPreferNewest,
+			testSource{SourceNPPES, "2024-01-01", true}, testSource{SourceCMSProviderOfServices, "2024-01-01", true}, false, true, false},
+		{"prefer priority, higher", MergeStrategyPreferPriority,
+			testSource{SourceCMSProviderOfServices, "2024-06-01", true}, testSource{SourceNPPES, "2024-01-01", true}, false, true, false},
+		{"prefer priority, lower without provenance", MergeStrategyPreferPriority,
+			testSource{SourceNPPES, "2024-01-01", false}, testSource{SourceCMSProviderOfServices, "2024-06-01", true}, true, false, true},
+	}
+	for _, field := range fields {
+		for _, testCase := range testCases {
+			t.Run(string(field.field)+"/"+testCase.name, func(t *testing.T) {
+				existing := testRecord(t, testCase.existing, field.existing)
+				incoming := testRecord(t, testCase.incoming, field.incoming)
+				existingKeys, incomingKeys := field.keys(existing), field.keys(incoming)
+
+				result, err := existing.Merge(incoming, testPolicies(field.field, testCase.strategy))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				keys := field.keys(existing)
+				if slices.Contains(keys, existingKeys[0]) != testCase.keepExisting || slices.Contains(keys, incomingKeys[0]) != testCase.keepIncoming {
+					t.Errorf("expected existing (%t) & incoming (%t) values, got %v", testCase.keepExisting, testCase.keepIncoming, keys)
+				}
+				if added := field.added(result); (added == 1) != testCase.keepIncoming {
+					t.Errorf("expected incoming value added (%t), got %d added", testCase.keepIncoming, added)
+				}
+				if removed := field.removed(result); (removed == 1) == testCase.keepExisting {
+					t.Errorf("expected existing value removed (%t), got %d removed", !testCase.keepExisting, removed)
+				}
+				if hasConflict(result, field.field) != testCase.conflict {
+					t.Errorf("expected a conflict (%t), got %v", testCase.conflict, result.Conflicts)
+				}
+			})
+		}
+
+		t.Run(string(field.field)+"/same values", func(t *testing.T) {
+			existing := testRecord(t, testSource{SourceNPPES, "2024-06-01", true}, field.existing)
+			incoming := testRecord(t, testSource{SourceNPPES, "2024-01-01", true}, field.existing)
+			result, err := existing.Merge(incoming, testPolicies(field.field, MergeStrategyPreferNewest))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if field.added(result) != 0 || field.removed(result) != 0 || hasConflict(result, field.field) {
+				t.Errorf("expected no changes, got %d added, %d removed, conflicts %v", field.added(result), field.removed(result), result.Conflicts)
+			}
+		})
+	}
+}
+
+func TestOrganizationMerge_Identifiers(t *testing.T) {
+	npi := OrganizationIdentifier{IdentifierType: OrganizationIdentifierTypeNPI, IdentifierValue: "1234567893"}
+	license := OrganizationIdentifier{IdentifierType: OrganizationIdentifierTypeStateLicense, IdentifierValue: "123", IdentifierState: "CA"}
+
+	testCases := []struct {
+		strategy    MergeStrategy
+		identifiers int
+		attributes  int
+	}{
+		{MergeStrategyUnion, 1, 1},
+		// any strategy other than keep existing unions identifiers
+		{MergeStrategyPreferNewest, 1, 1},
+		// the existing organization already has identifiers (its name)
+		{MergeStrategyKeepExisting, 0, 0},
+	}
+	for _, testCase := range testCases {
+		t.Run(string(testCase.strategy), func(t *testing.T) {
+			existing := testRecord(t, testSource{SourceNPPES, "2024-01-01", true}, Organization{})
+			incoming := testRecord(t, testSource{SourceNPPES, "2024-06-01", true}, Organization{
+				OrganizationIdentifiers: []OrganizationIdentifier{npi, license},
+			})
+
+			result, err := existing.Merge(incoming, testPolicies(MergeFieldIdentifiers, testCase.strategy))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(result.AddedIdentifiers) != testCase.identifiers || len(result.AddedAttributeIdentifiers) != testCase.attributes {
+				t.Errorf("expected %d identifiers & %d attribute identifiers, got %v %v", testCase.identifiers, testCase.attributes, result.AddedIdentifiers, result.AddedAttributeIdentifiers)
+			}
+			// state licenses are never merge keys
+			for _, identifier := range existing.OrganizationIdentifiers {
+				if identifier.IdentifierType == OrganizationIdentifierTypeStateLicense {
+					t.Errorf("expected the state license to be an attribute identifier")
+				}
+			}
+		})
+	}
+}
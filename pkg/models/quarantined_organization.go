@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// QuarantinedOrganization is an imported record that was not merged, because its validation findings were quarantined
+// by the validation policy. Quarantined records can be reviewed & fixed at the source, they are never merged later.
+type QuarantinedOrganization struct {
+	ID             uint      `json:"id" gorm:"primary_key;autoIncrement"`
+	CreatedAt      time.Time `json:"created_at"`
+	RunID          string    `json:"run_id" gorm:"index"`
+	Source         string    `json:"source"`
+	OrganizationID string    `json:"organization_id" gorm:"index"`
+	Name           string    `json:"name"`
+
+	Identifiers []OrganizationIdentifier `json:"identifiers" gorm:"type:text;serializer:json"`
+	Locations   []Location               `json:"locations" gorm:"type:text;serializer:json"`
+	Provenance  []Provenance             `json:"provenance" gorm:"type:text;serializer:json"`
+	Findings    []ValidationFinding      `json:"findings" gorm:"type:text;serializer:json"`
+}
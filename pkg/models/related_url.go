@@ -0,0 +1,124 @@
+package models
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+type RelatedUrlKind string
+
+const (
+	RelatedUrlKindHomepage      RelatedUrlKind = "homepage"
+	RelatedUrlKindPatientPortal RelatedUrlKind = "patient_portal"
+	RelatedUrlKindBilling       RelatedUrlKind = "billing"
+	RelatedUrlKindScheduling    RelatedUrlKind = "scheduling"
+	RelatedUrlKindOther         RelatedUrlKind = "other"
+)
+
+type PortalVendor string
+
+const (
+	PortalVendorMyChart        PortalVendor = "mychart"        // Epic
+	PortalVendorFollowMyHealth PortalVendor = "followmyhealth" // Veradigm (Allscripts)
+	PortalVendorAthenaPatient  PortalVendor = "athenapatient"  // athenahealth
+	PortalVendorHealow         PortalVendor = "healow"         // eClinicalWorks
+	PortalVendorNextMD         PortalVendor = "nextmd"         // NextGen
+	PortalVendorHealtheLife    PortalVendor = "healthelife"    // Oracle Health (Cerner)
+	PortalVendorInteliChart    PortalVendor = "intelichart"    // InteliChart
+	PortalVendorPatientFusion  PortalVendor = "patient_fusion" // Practice Fusion
+	PortalVendorUpdox          PortalVendor = "updox"
+)
+
+// RelatedUrl is a website or portal of an organization, classified by kind & portal vendor (see ClassifyRelatedUrl)
+type RelatedUrl struct {
+	URL          string         `json:"url"`
+	Kind         RelatedUrlKind `json:"kind"`
+	PortalVendor PortalVendor   `json:"portal_vendor,omitempty"`
+}
+
+// relatedUrlRule matches a url by its host and/or path (lowercased). Empty patterns match anything.
+type relatedUrlRule struct {
+	host *regexp.Regexp
+	path *regexp.Regexp
+}
+
+func (rule *relatedUrlRule) matches(host string, path string) bool {
+	return (rule.host == nil || rule.host.MatchString(host)) && (rule.path == nil || rule.path.MatchString(path))
+}
+
+// portalVendorRules are checked in order, the first match determines the portal vendor
+var portalVendorRules = []struct {
+	vendor PortalVendor
+	rule   relatedUrlRule
+}{
+	{PortalVendorMyChart, relatedUrlRule{host: regexp.MustCompile(`(^|[.\-])mychart([.\-]|$)`)}},
+	{PortalVendorMyChart, relatedUrlRule{path: regexp.MustCompile(`^/mychart([/\-]|$)`)}},
+	{PortalVendorFollowMyHealth, relatedUrlRule{host: regexp.MustCompile(`(^|\.)followmyhealth\.com$`)}},
+	{PortalVendorAthenaPatient, relatedUrlRule{host: regexp.MustCompile(`(^|\.)(portal\.athenahealth\.com|athenapatient\.com|mydocbill\.com)$`)}},
+	{PortalVendorHealow, relatedUrlRule{host: regexp.MustCompile(`(^|\.)(healow\.com|eclinicalweb\.com)$`)}},
+	{PortalVendorNextMD, relatedUrlRule{host: regexp.MustCompile(`(^|\.)nextmd\.com$`)}},
+	{PortalVendorHealtheLife, relatedUrlRule{host: regexp.MustCompile(`(^|\.)iqhealth\.com$`)}},
+	{PortalVendorInteliChart, relatedUrlRule{host: regexp.MustCompile(`(^|\.)intelichart\.com$`)}},
+	{PortalVendorPatientFusion, relatedUrlRule{host: regexp.MustCompile(`(^|\.)patientfusion\.com$`)}},
+	{PortalVendorUpdox, relatedUrlRule{host: regexp.MustCompile(`(^|\.)updox\.com$`)}},
+}
+
+// relatedUrlKindRules are checked in order, the first match determines the kind. Scheduling & billing pages hosted by a
+// portal vendor (eg. MyChart open scheduling) are classified by their purpose, not as the portal itself.
+var relatedUrlKindRules = []struct {
+	kind RelatedUrlKind
+	rule relatedUrlRule
+}{
+	{RelatedUrlKindScheduling, relatedUrlRule{host: regexp.MustCompile(`(^|\.)(zocdoc\.com|solvhealth\.com)$`)}},
+	{RelatedUrlKindScheduling, relatedUrlRule{path: regexp.MustCompile(`(schedul|appointment|openscheduling|book-?online|request-an-appointment)`)}},
+	{RelatedUrlKindScheduling, relatedUrlRule{host: regexp.MustCompile(`^(schedule|scheduling|appointments?|book)\.`)}},
+	{RelatedUrlKindBilling, relatedUrlRule{host: regexp.MustCompile(`(^|\.)(instamed\.com|patientpay\.com|paymentus\.com|billmatrix\.com|patientportalpay\.com)$`)}},
+	{RelatedUrlKindBilling, relatedUrlRule{path: regexp.MustCompile(`(billpay|bill-pay|pay-?bill|pay-?my-?bill|billing|/pay(ment)?s?(/|$)|guestpay|payasguest)`)}},
+	{RelatedUrlKindBilling, relatedUrlRule{host: regexp.MustCompile(`^(pay|billpay|billing)\.`)}},
+	// subdomain labels only (eg. portal.example.org or patientportal.example.org), not the registered domain itself
+	{RelatedUrlKindPatientPortal, relatedUrlRule{host: regexp.MustCompile(`(^|\.)(portal|myhealth|patient)[a-z0-9\-]*(\.[a-z0-9\-]+){2,}$`)}},
+	{RelatedUrlKindPatientPortal, relatedUrlRule{path: regexp.MustCompile(`(portal|patient-?login|myhealth)`)}},
+}
+
+// ClassifyRelatedUrl classifies a website or portal url by kind and portal vendor, using url pattern rules.
+// Urls hosted by a portal vendor are patient portals (unless they are scheduling or billing pages), site roots are
+// homepages, anything else is other.
+func ClassifyRelatedUrl(rawUrl string) RelatedUrl {
+	classification := RelatedUrl{URL: rawUrl, Kind: RelatedUrlKindOther}
+	parsedUrl, err := url.Parse(rawUrl)
+	if err != nil {
+		return classification
+	}
+	host := strings.TrimPrefix(strings.ToLower(parsedUrl.Hostname()), "www.")
+	path := strings.ToLower(parsedUrl.EscapedPath())
+
+	for _, vendorRule := range portalVendorRules {
+		if vendorRule.rule.matches(host, path) {
+			classification.PortalVendor = vendorRule.vendor
+			break
+		}
+	}
+	for _, kindRule := range relatedUrlKindRules {
+		if kindRule.rule.matches(host, path) {
+			classification.Kind = kindRule.kind
+			return classification
+		}
+	}
+	if classification.PortalVendor != "" {
+		classification.Kind = RelatedUrlKindPatientPortal
+	} else if strings.Trim(path, "/") == "" {
+		classification.Kind = RelatedUrlKindHomepage
+	}
+	return classification
+}
+
+// ClassifyRelatedUrls classifies every url, see ClassifyRelatedUrl. Classifications are not stored, they are computed
+// whenever they are read or exported, so rule changes apply to every organization immediately.
+func ClassifyRelatedUrls(relatedUrls []string) []RelatedUrl {
+	var classifications []RelatedUrl
+	for _, relatedUrl := range relatedUrls {
+		classifications = append(classifications, ClassifyRelatedUrl(relatedUrl))
+	}
+	return classifications
+}
@@ -0,0 +1,24 @@
+package models
+
+// Sources (datasets) that organizations are loaded from. Used when recording organization revisions & provenance.
+const (
+	SourceNPPES = "nppes"
+
+	// EHR vendor published FHIR endpoint directories
+	SourceEpic   = "epic"
+	SourceCerner = "cerner"
+
+	// CMS facility datasets, used to enrich (existing) organizations
+	SourceCMSProviderOfServices         = "cms_pos"
+	SourceCMSHospitalGeneralInformation = "cms_hospital_general"
+
+	// curated website & patient portal lists, used to enrich (existing) organizations
+	SourceWebsites = "websites"
+
+	// organizations linked by the matcher (or a reviewer)
+	SourceMatching = "matching"
+	// organizations split by a reviewer
+	SourceUnmerge = "unmerge"
+	// hand curated fixes, applied after every import
+	SourceOverrides = "overrides"
+)
@@ -0,0 +1,36 @@
+package models
+
+import "fmt"
+
+type ValidationSeverity string
+
+const (
+	ValidationSeverityError   ValidationSeverity = "error"   // the value is certainly wrong, eg. an NPI with an invalid check digit
+	ValidationSeverityWarning ValidationSeverity = "warning" // the value is probably wrong, or is in an unexpected format
+)
+
+type ValidationCode string
+
+const (
+	ValidationCodeInvalidNPI      ValidationCode = "invalid_npi"      // not 10 digits, or fails the Luhn check digit (with the 80840 prefix)
+	ValidationCodeInvalidEIN      ValidationCode = "invalid_ein"      // not 9 digits (optionally formatted as 12-3456789)
+	ValidationCodeInvalidState    ValidationCode = "invalid_state"    // not a USPS two-letter state, territory or military state code
+	ValidationCodeInvalidCountry  ValidationCode = "invalid_country"  // not an ISO 3166-1 two-letter country code
+	ValidationCodeInvalidTaxonomy ValidationCode = "invalid_taxonomy" // not a NUCC taxonomy code, eg. 207Q00000X
+)
+
+// ValidationFinding is a problem found when validating an imported record, see the validation package
+type ValidationFinding struct {
+	Code     ValidationCode     `json:"code"`
+	Severity ValidationSeverity `json:"severity"`
+	Field    string             `json:"field"` // the field (or identifier type) the value was read from, eg. taxonomy
+	Value    string             `json:"value"`
+}
+
+func (finding *ValidationFinding) Equal(finding2 *ValidationFinding) bool {
+	return finding.Code == finding2.Code && finding.Field == finding2.Field && finding.Value == finding2.Value
+}
+
+func (finding ValidationFinding) String() string {
+	return fmt.Sprintf("%s %s (%s): %q", finding.Severity, finding.Code, finding.Field, finding.Value)
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"strings"
+)
+
+type LocationValidationFlag string
+
+const (
+	LocationValidationFlagInvalidPostalCode LocationValidationFlag = "invalid_postal_code" // not a 5 digit (or ZIP+4) US ZIP code
+	LocationValidationFlagZipNotFound       LocationValidationFlag = "zip_not_found"       // the ZIP code is not in the reference table
+	LocationValidationFlagZipStateMismatch  LocationValidationFlag = "zip_state_mismatch"  // the ZIP code belongs to a different state
+	LocationValidationFlagZipCityMismatch   LocationValidationFlag = "zip_city_mismatch"   // the city is not an acceptable city name for the ZIP code
+)
+
+// ZipCode is an offline ZIP code reference, used to validate the city & state of US Locations.
+// ZIP codes with multiple acceptable city names have a row for each city.
+type ZipCode struct {
+	ZipCode string `json:"zip_code" gorm:"primary_key"` // 5 digits
+	City    string `json:"city" gorm:"primary_key"`     // USPS standardized, see utils.StandardizeCity
+	State   string `json:"state"`                       // two-letter abbreviation
+	Primary bool   `json:"primary"`                     // the USPS preferred city name for the ZIP code
+}
+
+// ValidateLocation checks the postal code, city & state of a US location against the reference rows for its ZIP code.
+// Locations outside the US are not validated.
+func ValidateLocation(loc *Location, zipCodes []ZipCode) []LocationValidationFlag {
+	if loc.Country != "" && !strings.EqualFold(loc.Country, "US") {
+		return nil
+	}
+	zip, _ := utils.StandardizePostalCode(loc.PostalCode)
+	if len(zip) != 5 || strings.Trim(zip, "0123456789") != "" {
+		return []LocationValidationFlag{LocationValidationFlagInvalidPostalCode}
+	}
+	if len(zipCodes) == 0 {
+		return []LocationValidationFlag{LocationValidationFlagZipNotFound}
+	}
+
+	var flags []LocationValidationFlag
+	if state := utils.StandardizeState(loc.State); state != zipCodes[0].State {
+		flags = append(flags, LocationValidationFlagZipStateMismatch)
+	}
+	city := utils.StandardizeCity(loc.City)
+	cityFound := false
+	for _, zipCode := range zipCodes {
+		if zipCode.City == city {
+			cityFound = true
+			break
+		}
+	}
+	if !cityFound {
+		flags = append(flags, LocationValidationFlagZipCityMismatch)
+	}
+	return flags
+}
@@ -0,0 +1,248 @@
+package overrides
+
+import (
+	"errors"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"log"
+	"os"
+	"strings"
+)
+
+type ApplySummary struct {
+	Organizations int // organizations that were overridden, including organizations endpoints were moved from/to
+	Endpoints     int
+}
+
+// ApplyFile loads, validates & applies an overrides file. A missing file is skipped, so imports can always apply
+// DefaultPath.
+func ApplyFile(repository *database.SqliteRepository, filePath string) (ApplySummary, error) {
+	if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
+		log.Printf("no overrides file found (%s), skipping overrides", filePath)
+		return ApplySummary{}, nil
+	}
+	overrides, err := Load(filePath)
+	if err != nil {
+		return ApplySummary{}, err
+	}
+	return overrides.Apply(repository)
+}
+
+// Apply validates every override, then applies them. Nothing is written if any override is invalid.
+// Overrides are idempotent, applying them again (after a re-import) only restores the curated values.
+func (overrides *Overrides) Apply(repository *database.SqliteRepository) (ApplySummary, error) {
+	summary := ApplySummary{}
+	if errs := overrides.Validate(repository); len(errs) > 0 {
+		var messages []string
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		return summary, fmt.Errorf("invalid overrides:\n  %s", strings.Join(messages, "\n  "))
+	}
+
+	for ndx := range overrides.Organizations {
+		orgOverride := &overrides.Organizations[ndx]
+		org, err := repository.FindOrganizationByNPI(orgOverride.NPI)
+		if err != nil {
+			return summary, err
+		}
+		err = orgOverride.apply(org)
+		if err != nil {
+			return summary, err
+		}
+		_, err = repository.OverrideOrganization(org, models.SourceOverrides)
+		if err != nil {
+			return summary, err
+		}
+		summary.Organizations++
+		summary.Endpoints += len(orgOverride.AddEndpoints)
+	}
+
+	for ndx := range overrides.Endpoints {
+		endOverride := &overrides.Endpoints[ndx]
+		endpointId := utils.NormalizeEndpointId(endOverride.URL)
+		existingEndpoints, err := repository.FindEndpointsByIds([]string{endpointId})
+		if err != nil {
+			return summary, err
+		}
+
+		orgId := ""
+		if endOverride.Organization != "" {
+			org, err := repository.FindOrganizationByNPI(endOverride.Organization)
+			if err != nil {
+				return summary, err
+			}
+			orgId = org.ID
+		}
+		if len(existingEndpoints) > 0 && existingEndpoints[0].OrganizationID != orgId {
+			if orgId == "" {
+				orgId = existingEndpoints[0].OrganizationID
+			} else {
+				//the endpoint is moved, it must be removed from its current organization first
+				previousOrg, err := findOrganization(repository, existingEndpoints[0].OrganizationID)
+				if err != nil {
+					return summary, err
+				}
+				var endpoints []models.Endpoint
+				for _, end := range previousOrg.Endpoints {
+					if end.ID != endpointId {
+						endpoints = append(endpoints, end)
+					}
+				}
+				previousOrg.Endpoints = endpoints
+				_, err = repository.OverrideOrganization(previousOrg, models.SourceOverrides)
+				if err != nil {
+					return summary, err
+				}
+				summary.Organizations++
+			}
+		}
+
+		org, err := findOrganization(repository, orgId)
+		if err != nil {
+			return summary, err
+		}
+		endOverride.apply(org)
+		_, err = repository.OverrideOrganization(org, models.SourceOverrides)
+		if err != nil {
+			return summary, err
+		}
+		summary.Organizations++
+		summary.Endpoints++
+	}
+	return summary, nil
+}
+
+// findOrganization returns the organization with the id. Overrides identify organizations by NPI, see
+// database.SqliteRepository.FindOrganizationByNPI.
+func findOrganization(repository *database.SqliteRepository, orgId string) (*models.Organization, error) {
+	orgs, err := repository.FindOrganizationsByIds([]string{orgId})
+	if err != nil {
+		return nil, err
+	} else if len(orgs) == 0 {
+		return nil, fmt.Errorf("organization (%s) does not exist", orgId)
+	}
+	return &orgs[0], nil
+}
+
+// apply updates the organization (in memory) with the override
+func (orgOverride *OrganizationOverride) apply(org *models.Organization) error {
+	addAliases := orgOverride.AddAliases
+	if orgOverride.Name != nil {
+		org.Name = strings.TrimSpace(*orgOverride.Name)
+		//the curated name must be searchable, like an alias
+		addAliases = append([]string{org.Name}, addAliases...)
+	}
+	if orgOverride.Taxonomy != nil {
+		org.Taxonomy = orgOverride.Taxonomy
+	}
+	if orgOverride.RelatedUrls != nil {
+		org.RelatedUrls = nil
+		for _, rawUrl := range orgOverride.RelatedUrls {
+			relatedUrl, _ := utils.CanonicalizeRelatedURL(rawUrl)
+			org.RelatedUrls = append(org.RelatedUrls, relatedUrl)
+		}
+	}
+	if orgOverride.FacilityType != nil {
+		org.FacilityType = *orgOverride.FacilityType
+	}
+	if orgOverride.Ownership != nil {
+		org.Ownership = *orgOverride.Ownership
+	}
+	if orgOverride.BedCount != nil {
+		org.BedCount = *orgOverride.BedCount
+	}
+	if orgOverride.EmergencyServices != nil {
+		org.EmergencyServices = orgOverride.EmergencyServices
+	}
+	if orgOverride.Hidden != nil {
+		org.Hidden = *orgOverride.Hidden
+	}
+
+	for _, alias := range orgOverride.RemoveAliases {
+		normalizedAlias, err := utils.NormalizeOrganizationName(alias)
+		if err != nil {
+			return err
+		}
+		var identifiers []models.OrganizationIdentifier
+		for _, identifier := range org.OrganizationIdentifiers {
+			if identifier.IdentifierType != models.OrganizationIdentifierTypeName || identifier.IdentifierValue != normalizedAlias {
+				identifiers = append(identifiers, identifier)
+			}
+		}
+		org.OrganizationIdentifiers = identifiers
+	}
+	for _, alias := range addAliases {
+		normalizedAlias, err := utils.NormalizeOrganizationName(alias)
+		if err != nil {
+			return err
+		}
+		org.MergeOrganizationIdentifiers(&models.Organization{
+			OrganizationIdentifiers: []models.OrganizationIdentifier{{
+				IdentifierType:    models.OrganizationIdentifierTypeName,
+				IdentifierValue:   normalizedAlias,
+				IdentifierDisplay: alias,
+			}},
+		})
+	}
+
+	for _, locOverride := range orgOverride.RemoveLocations {
+		locId, _ := locOverride.location().ComputeId()
+		var locations []models.Location
+		for _, loc := range org.Locations {
+			if loc.ID != locId {
+				locations = append(locations, loc)
+			}
+		}
+		org.Locations = locations
+	}
+	for _, locOverride := range orgOverride.AddLocations {
+		loc := locOverride.location()
+		loc.ID, _ = loc.ComputeId()
+		if !hasLocation(org.Locations, loc.ID) {
+			org.Locations = append(org.Locations, *loc)
+		}
+	}
+
+	for ndx := range orgOverride.AddEndpoints {
+		orgOverride.AddEndpoints[ndx].apply(org)
+	}
+	return nil
+}
+
+// apply attaches the endpoint to the organization (in memory), or updates it if it is already attached
+func (endOverride *EndpointOverride) apply(org *models.Organization) {
+	endpointId := utils.NormalizeEndpointId(endOverride.URL)
+	for ndx := range org.Endpoints {
+		if org.Endpoints[ndx].ID == endpointId {
+			if endOverride.PlatformType != "" {
+				org.Endpoints[ndx].PlatformType = endOverride.PlatformType
+			}
+			if endOverride.Hidden != nil {
+				org.Endpoints[ndx].Hidden = *endOverride.Hidden
+			}
+			return
+		}
+	}
+
+	end := models.Endpoint{
+		ID:           endpointId,
+		URL:          utils.NormalizeEndpointURL(endOverride.URL),
+		PlatformType: endOverride.PlatformType,
+	}
+	if endOverride.Hidden != nil {
+		end.Hidden = *endOverride.Hidden
+	}
+	org.Endpoints = append(org.Endpoints, end)
+}
+
+func hasLocation(locations []models.Location, locId string) bool {
+	for ndx := range locations {
+		if locations[ndx].ID == locId {
+			return true
+		}
+	}
+	return false
+}
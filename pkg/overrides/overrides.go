@@ -0,0 +1,237 @@
+package overrides
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"golang.org/x/exp/slices"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultPath is the version controlled overrides file, applied at the end of every import
+const DefaultPath = "data/overrides.yaml"
+
+// Overrides are hand curated fixes that must survive re-imports. Imports merge source data into organizations, which
+// reverts (or ignores) manual edits, so overrides are re-applied as the last stage of every import instead.
+type Overrides struct {
+	Organizations []OrganizationOverride `json:"organizations" yaml:"organizations"`
+	Endpoints     []EndpointOverride     `json:"endpoints" yaml:"endpoints"`
+}
+
+// OrganizationOverride pins fields of an organization (identified by its NPI), and adds or suppresses aliases,
+// locations & endpoints. Fields that are not set are left as imported.
+type OrganizationOverride struct {
+	NPI    string `json:"npi" yaml:"npi"`
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"` // why the override exists, for reviewers
+
+	// pinned fields
+	Name              *string                   `json:"name,omitempty" yaml:"name,omitempty"`
+	Taxonomy          []string                  `json:"taxonomy,omitempty" yaml:"taxonomy,omitempty"`
+	RelatedUrls       []string                  `json:"related_urls,omitempty" yaml:"related_urls,omitempty"`
+	FacilityType      *models.FacilityType      `json:"facility_type,omitempty" yaml:"facility_type,omitempty"`
+	Ownership         *models.FacilityOwnership `json:"ownership,omitempty" yaml:"ownership,omitempty"`
+	BedCount          *int                      `json:"bed_count,omitempty" yaml:"bed_count,omitempty"`
+	EmergencyServices *bool                     `json:"emergency_services,omitempty" yaml:"emergency_services,omitempty"`
+	Hidden            *bool                     `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+
+	AddAliases      []string           `json:"add_aliases,omitempty" yaml:"add_aliases,omitempty"`
+	RemoveAliases   []string           `json:"remove_aliases,omitempty" yaml:"remove_aliases,omitempty"`
+	AddLocations    []LocationOverride `json:"add_locations,omitempty" yaml:"add_locations,omitempty"`
+	RemoveLocations []LocationOverride `json:"remove_locations,omitempty" yaml:"remove_locations,omitempty"`
+	AddEndpoints    []EndpointOverride `json:"add_endpoints,omitempty" yaml:"add_endpoints,omitempty"`
+}
+
+type LocationOverride struct {
+	Line       []string `json:"line" yaml:"line"`
+	City       string   `json:"city" yaml:"city"`
+	State      string   `json:"state" yaml:"state"`
+	PostalCode string   `json:"postal_code" yaml:"postal_code"`
+	Country    string   `json:"country,omitempty" yaml:"country,omitempty"` // defaults to US
+}
+
+// EndpointOverride attaches an endpoint (identified by its url) to an organization, moving it if it belongs to another
+// organization, and pins its platform type or hides it. Endpoints that do not exist yet require an organization.
+type EndpointOverride struct {
+	URL          string `json:"url" yaml:"url"`
+	Organization string `json:"organization,omitempty" yaml:"organization,omitempty"` // NPI, not used in add_endpoints
+	PlatformType string `json:"platform_type,omitempty" yaml:"platform_type,omitempty"`
+	Hidden       *bool  `json:"hidden,omitempty" yaml:"hidden,omitempty"`
+	Reason       string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// Load reads an overrides file, in JSON (.json) or YAML format. Unknown keys are rejected, so that typos do not silently
+// disable an override.
+func Load(filePath string) (*Overrides, error) {
+	fileBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides Overrides
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(fileBytes))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&overrides)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(fileBytes))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&overrides)
+		if err == io.EOF {
+			//empty file
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing overrides file (%s): %v", filePath, err)
+	}
+	return &overrides, nil
+}
+
+// Validate checks that every override is well-formed, and that the organizations & endpoints it targets exist.
+// Values that are removed (aliases & locations) are not required to exist, since they are gone after the first run.
+// Added aliases (and curated names) must not belong to another organization, since they would not be moved.
+func (overrides *Overrides) Validate(repository *database.SqliteRepository) []error {
+	var errs []error
+	var npis, endpointIds []string
+	aliases := map[string][]string{} // by NPI
+	seenOrgs := map[string]bool{}
+	seenEndpoints := map[string]bool{}
+
+	for ndx, orgOverride := range overrides.Organizations {
+		key := fmt.Sprintf("organizations[%d] (%s)", ndx, orgOverride.NPI)
+		if orgOverride.NPI == "" {
+			errs = append(errs, fmt.Errorf("%s: npi is required", key))
+			continue
+		} else if seenOrgs[orgOverride.NPI] {
+			errs = append(errs, fmt.Errorf("%s: duplicate override, each organization may only be overridden once", key))
+		}
+		seenOrgs[orgOverride.NPI] = true
+		npis = append(npis, orgOverride.NPI)
+		aliases[orgOverride.NPI] = orgOverride.AddAliases
+		if orgOverride.Name != nil {
+			aliases[orgOverride.NPI] = append([]string{*orgOverride.Name}, orgOverride.AddAliases...)
+		}
+
+		if orgOverride.Name != nil && strings.TrimSpace(*orgOverride.Name) == "" {
+			errs = append(errs, fmt.Errorf("%s: name must not be empty", key))
+		}
+		if orgOverride.FacilityType != nil && !slices.Contains(models.FacilityTypes, *orgOverride.FacilityType) {
+			errs = append(errs, fmt.Errorf("%s: invalid facility type (%s)", key, *orgOverride.FacilityType))
+		}
+		if orgOverride.Ownership != nil && !validOwnership(*orgOverride.Ownership) {
+			errs = append(errs, fmt.Errorf("%s: invalid ownership (%s)", key, *orgOverride.Ownership))
+		}
+		for _, relatedUrl := range orgOverride.RelatedUrls {
+			if _, err := utils.CanonicalizeRelatedURL(relatedUrl); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid related url (%s): %v", key, relatedUrl, err))
+			}
+		}
+		for _, locOverride := range append(append([]LocationOverride{}, orgOverride.AddLocations...), orgOverride.RemoveLocations...) {
+			if _, err := locOverride.location().ComputeId(); err != nil || locOverride.City == "" {
+				errs = append(errs, fmt.Errorf("%s: invalid location (%v, %s)", key, locOverride.Line, locOverride.City))
+			}
+		}
+		for _, endOverride := range orgOverride.AddEndpoints {
+			if err := utils.ValidateEndpointURL(endOverride.URL); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid endpoint url (%s): %v", key, endOverride.URL, err))
+			} else if seenEndpoints[utils.NormalizeEndpointId(endOverride.URL)] {
+				errs = append(errs, fmt.Errorf("%s: duplicate endpoint override (%s)", key, endOverride.URL))
+			}
+			seenEndpoints[utils.NormalizeEndpointId(endOverride.URL)] = true
+		}
+	}
+
+	for ndx, endOverride := range overrides.Endpoints {
+		key := fmt.Sprintf("endpoints[%d] (%s)", ndx, endOverride.URL)
+		if err := utils.ValidateEndpointURL(endOverride.URL); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid endpoint url: %v", key, err))
+			continue
+		}
+		endpointId := utils.NormalizeEndpointId(endOverride.URL)
+		if seenEndpoints[endpointId] {
+			errs = append(errs, fmt.Errorf("%s: duplicate endpoint override", key))
+		}
+		seenEndpoints[endpointId] = true
+		if endOverride.Organization != "" {
+			npis = append(npis, endOverride.Organization)
+		} else {
+			endpointIds = append(endpointIds, endpointId)
+		}
+	}
+
+	//targeted records must exist, organizations are identified by NPI (not their id)
+	checkedNPIs := map[string]bool{}
+	for _, npi := range npis {
+		if checkedNPIs[npi] {
+			continue
+		}
+		checkedNPIs[npi] = true
+		org, err := repository.FindOrganizationByNPI(npi)
+		if errors.Is(err, database.ErrOrganizationNotFound) {
+			errs = append(errs, fmt.Errorf("organization (%s) does not exist", npi))
+			continue
+		} else if err != nil {
+			return append(errs, err)
+		}
+		//aliases are never moved from the organization that owns them
+		for _, alias := range aliases[npi] {
+			normalizedAlias, err := utils.NormalizeOrganizationName(alias)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("organization (%s): invalid alias (%s): %v", npi, alias, err))
+				continue
+			}
+			ownerOrgId, err := repository.FindIdentifierOwner(models.OrganizationIdentifier{IdentifierType: models.OrganizationIdentifierTypeName, IdentifierValue: normalizedAlias})
+			if err != nil {
+				return append(errs, err)
+			} else if ownerOrgId != "" && ownerOrgId != org.ID {
+				errs = append(errs, fmt.Errorf("organization (%s): alias (%s) already belongs to organization (%s)", npi, alias, ownerOrgId))
+			}
+		}
+	}
+	foundEndpoints, err := repository.FindEndpointsByIds(endpointIds)
+	if err != nil {
+		return append(errs, err)
+	}
+	foundEndpointIds := map[string]bool{}
+	for _, end := range foundEndpoints {
+		foundEndpointIds[end.ID] = true
+	}
+	for _, endpointId := range endpointIds {
+		if !foundEndpointIds[endpointId] {
+			errs = append(errs, fmt.Errorf("endpoint (%s) does not exist, an organization is required to attach it", endpointId))
+		}
+	}
+	return errs
+}
+
+func (locOverride *LocationOverride) location() *models.Location {
+	loc := models.Location{
+		Line:       locOverride.Line,
+		City:       locOverride.City,
+		State:      locOverride.State,
+		PostalCode: locOverride.PostalCode,
+		Country:    locOverride.Country,
+	}
+	if loc.Country == "" {
+		loc.Country = "US"
+	}
+	loc.Standardize()
+	return &loc
+}
+
+func validOwnership(ownership models.FacilityOwnership) bool {
+	switch ownership {
+	case models.FacilityOwnershipNonProfit, models.FacilityOwnershipForProfit, models.FacilityOwnershipGovernment,
+		models.FacilityOwnershipPhysician, models.FacilityOwnershipTribal:
+		return true
+	}
+	return false
+}
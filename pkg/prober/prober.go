@@ -0,0 +1,187 @@
+package prober
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// responses larger than this are not parsed, CapabilityStatements for large servers are typically < 1MB
+const maxResponseBytes = 10 * 1024 * 1024
+
+// Prober checks whether Endpoints are reachable, and records their FHIR capabilities & SMART configuration.
+type Prober struct {
+	Logger logrus.FieldLogger
+	// Client is used for all requests. Inject a custom client to control timeouts, transports & TLS configuration.
+	Client *http.Client
+}
+
+func NewProber(client *http.Client, logger logrus.FieldLogger) *Prober {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Prober{Logger: logger, Client: client}
+}
+
+type capabilityStatement struct {
+	ResourceType string `json:"resourceType"`
+	FhirVersion  string `json:"fhirVersion"`
+	Software     struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"software"`
+	Rest []struct {
+		Mode     string `json:"mode"`
+		Security struct {
+			Extension []struct {
+				Url       string `json:"url"`
+				Extension []struct {
+					Url      string `json:"url"`
+					ValueUri string `json:"valueUri"`
+				} `json:"extension"`
+			} `json:"extension"`
+		} `json:"security"`
+		Resource []struct {
+			Type string `json:"type"`
+		} `json:"resource"`
+	} `json:"rest"`
+}
+
+type smartConfiguration struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+}
+
+// Probe fetches {endpoint}/metadata and {endpoint}/.well-known/smart-configuration.
+// Failures are recorded on the returned probe, rather than returned as errors.
+func (p *Prober) Probe(ctx context.Context, endpoint *models.Endpoint) *models.EndpointProbe {
+	probe := models.EndpointProbe{
+		EndpointID: endpoint.ID,
+		Status:     models.EndpointProbeStatusOk,
+	}
+	//Endpoint.URL is guaranteed to have a '/' suffix
+	baseUrl := endpoint.URL
+	if !strings.HasSuffix(baseUrl, "/") {
+		baseUrl += "/"
+	}
+
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	// FHIR CapabilityStatement
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	var capability capabilityStatement
+	resp, err := p.getJson(ctx, baseUrl+"metadata", "application/fhir+json", &capability)
+	probe.MetadataStatusCode = resp.statusCode
+	probe.MetadataResponseTimeMs = resp.responseTime.Milliseconds()
+	probe.TLSExpiry = resp.tlsExpiry
+	if err != nil {
+		probe.Status = models.EndpointProbeStatusError
+		probe.Error = fmt.Sprintf("metadata: %v", err)
+		return &probe
+	} else if capability.ResourceType != "CapabilityStatement" {
+		probe.Status = models.EndpointProbeStatusError
+		probe.Error = fmt.Sprintf("metadata: expected a CapabilityStatement, got %q", capability.ResourceType)
+		return &probe
+	}
+
+	probe.FhirVersion = capability.FhirVersion
+	probe.SoftwareName = capability.Software.Name
+	probe.SoftwareVersion = capability.Software.Version
+	supportedResources := map[string]bool{}
+	for _, rest := range capability.Rest {
+		if rest.Mode != "" && rest.Mode != "server" {
+			continue
+		}
+		for _, resource := range rest.Resource {
+			supportedResources[resource.Type] = true
+		}
+		//SMART endpoints may also be declared in the CapabilityStatement (deprecated in SMART v2, but still widely used)
+		for _, securityExt := range rest.Security.Extension {
+			if securityExt.Url != "http://fhir-registry.smarthealthit.org/StructureDefinition/oauth-uris" {
+				continue
+			}
+			for _, oauthExt := range securityExt.Extension {
+				switch oauthExt.Url {
+				case "authorize":
+					probe.AuthorizeUrl = oauthExt.ValueUri
+				case "token":
+					probe.TokenUrl = oauthExt.ValueUri
+				}
+			}
+		}
+	}
+	for resourceType := range supportedResources {
+		probe.SupportedResources = append(probe.SupportedResources, resourceType)
+	}
+	sort.Strings(probe.SupportedResources)
+
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	// SMART configuration (optional, so failures are logged but do not change the probe status)
+	////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+	var smartConfig smartConfiguration
+	resp, err = p.getJson(ctx, baseUrl+".well-known/smart-configuration", "application/json", &smartConfig)
+	probe.SmartConfigurationStatusCode = resp.statusCode
+	probe.SmartConfigurationResponseTimeMs = resp.responseTime.Milliseconds()
+	if err != nil {
+		p.Logger.Debugf("smart-configuration unavailable for endpoint %s: %v", endpoint.URL, err)
+	} else {
+		if smartConfig.AuthorizationEndpoint != "" {
+			probe.AuthorizeUrl = smartConfig.AuthorizationEndpoint
+		}
+		if smartConfig.TokenEndpoint != "" {
+			probe.TokenUrl = smartConfig.TokenEndpoint
+		}
+	}
+
+	return &probe
+}
+
+type probeResponse struct {
+	statusCode   int
+	responseTime time.Duration
+	tlsExpiry    *time.Time
+}
+
+func (p *Prober) getJson(ctx context.Context, requestUrl string, accept string, result interface{}) (probeResponse, error) {
+	probeResp := probeResponse{}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return probeResp, err
+	}
+	req.Header.Set("Accept", accept)
+
+	start := time.Now()
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		probeResp.responseTime = time.Since(start)
+		return probeResp, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	probeResp.responseTime = time.Since(start)
+	probeResp.statusCode = resp.StatusCode
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		notAfter := resp.TLS.PeerCertificates[0].NotAfter
+		probeResp.tlsExpiry = &notAfter
+	}
+	if err != nil {
+		return probeResp, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return probeResp, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	err = json.Unmarshal(body, result)
+	if err != nil {
+		return probeResp, fmt.Errorf("invalid json response: %v", err)
+	}
+	return probeResp, nil
+}
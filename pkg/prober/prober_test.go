@@ -0,0 +1,230 @@
+package prober
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/sirupsen/logrus"
+)
+
+const testCapabilityStatement = `{
+	"resourceType": "CapabilityStatement",
+	"fhirVersion": "4.0.1",
+	"software": {"name": "Epic", "version": "May 2022"},
+	"rest": [
+		{
+			"mode": "server",
+			"security": {
+				"extension": [{
+					"url": "http://fhir-registry.smarthealthit.org/StructureDefinition/oauth-uris",
+					"extension": [
+						{"url": "authorize", "valueUri": "https://fhir.example.com/oauth2/authorize"},
+						{"url": "token", "valueUri": "https://fhir.example.com/oauth2/token"}
+					]
+				}]
+			},
+			"resource": [{"type": "Patient"}, {"type": "Observation"}, {"type": "Patient"}]
+		},
+		{
+			"mode": "client",
+			"resource": [{"type": "Subscription"}]
+		}
+	]
+}`
+
+// newTestServer starts a TLS server that serves the FHIR api under /fhir/, using the handlers for each path (relative to
+// the base url). Unknown paths return 404.
+func newTestServer(t *testing.T, handlers map[string]http.HandlerFunc) *httptest.Server {
+	mux := http.NewServeMux()
+	for path, handler := range handlers {
+		mux.HandleFunc("/fhir/"+path, handler)
+	}
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestProber(server *httptest.Server, timeout time.Duration) *Prober {
+	client := server.Client()
+	client.Timeout = timeout
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return NewProber(client, logger)
+}
+
+func jsonHandler(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func probeTestServer(t *testing.T, server *httptest.Server, timeout time.Duration) *models.EndpointProbe {
+	endpoint := &models.Endpoint{ID: "test", URL: server.URL + "/fhir/"}
+	return newTestProber(server, timeout).Probe(context.Background(), endpoint)
+}
+
+func TestProbe_Metadata(t *testing.T) {
+	server := newTestServer(t, map[string]http.HandlerFunc{
+		"metadata": func(w http.ResponseWriter, r *http.Request) {
+			if accept := r.Header.Get("Accept"); accept != "application/fhir+json" {
+				t.Errorf("expected the fhir+json Accept header, got %q", accept)
+			}
+			jsonHandler(http.StatusOK, testCapabilityStatement)(w, r)
+		},
+	})
+
+	probe := probeTestServer(t, server, 5*time.Second)
+
+	if probe.Status != models.EndpointProbeStatusOk {
+		t.Fatalf("expected status ok, got %s (%s)", probe.Status, probe.Error)
+	}
+	if probe.EndpointID != "test" {
+		t.Errorf("expected endpoint id test, got %q", probe.EndpointID)
+	}
+	if probe.MetadataStatusCode != http.StatusOK {
+		t.Errorf("expected metadata status code 200, got %d", probe.MetadataStatusCode)
+	}
+	if probe.FhirVersion != "4.0.1" || probe.SoftwareName != "Epic" || probe.SoftwareVersion != "May 2022" {
+		t.Errorf("unexpected software: %s %s (fhir %s)", probe.SoftwareName, probe.SoftwareVersion, probe.FhirVersion)
+	}
+	// sorted & de-duplicated, client mode resources are ignored
+	if strings.Join(probe.SupportedResources, ",") != "Observation,Patient" {
+		t.Errorf("unexpected supported resources: %v", probe.SupportedResources)
+	}
+	// the smart-configuration is missing (404), so the CapabilityStatement oauth uris are used
+	if probe.SmartConfigurationStatusCode != http.StatusNotFound {
+		t.Errorf("expected smart-configuration status code 404, got %d", probe.SmartConfigurationStatusCode)
+	}
+	if probe.AuthorizeUrl != "https://fhir.example.com/oauth2/authorize" || probe.TokenUrl != "https://fhir.example.com/oauth2/token" {
+		t.Errorf("unexpected oauth uris: %s, %s", probe.AuthorizeUrl, probe.TokenUrl)
+	}
+}
+
+func TestProbe_SmartConfiguration(t *testing.T) {
+	server := newTestServer(t, map[string]http.HandlerFunc{
+		"metadata": jsonHandler(http.StatusOK, testCapabilityStatement),
+		".well-known/smart-configuration": jsonHandler(http.StatusOK, `{
+			"authorization_endpoint": "https://auth.example.com/authorize",
+			"token_endpoint": "https://auth.example.com/token",
+			"capabilities": ["launch-standalone"]
+		}`),
+	})
+
+	probe := probeTestServer(t, server, 5*time.Second)
+
+	if probe.Status != models.EndpointProbeStatusOk {
+		t.Fatalf("expected status ok, got %s (%s)", probe.Status, probe.Error)
+	}
+	if probe.SmartConfigurationStatusCode != http.StatusOK {
+		t.Errorf("expected smart-configuration status code 200, got %d", probe.SmartConfigurationStatusCode)
+	}
+	// the smart-configuration takes precedence over the CapabilityStatement
+	if probe.AuthorizeUrl != "https://auth.example.com/authorize" || probe.TokenUrl != "https://auth.example.com/token" {
+		t.Errorf("unexpected oauth uris: %s, %s", probe.AuthorizeUrl, probe.TokenUrl)
+	}
+}
+
+func TestProbe_SmartConfigurationErrorIsIgnored(t *testing.T) {
+	server := newTestServer(t, map[string]http.HandlerFunc{
+		"metadata":                        jsonHandler(http.StatusOK, testCapabilityStatement),
+		".well-known/smart-configuration": jsonHandler(http.StatusOK, `not json`),
+	})
+
+	probe := probeTestServer(t, server, 5*time.Second)
+
+	if probe.Status != models.EndpointProbeStatusOk || probe.Error != "" {
+		t.Fatalf("expected status ok, got %s (%s)", probe.Status, probe.Error)
+	}
+	if probe.AuthorizeUrl != "https://fhir.example.com/oauth2/authorize" {
+		t.Errorf("expected the CapabilityStatement authorize uri, got %s", probe.AuthorizeUrl)
+	}
+}
+
+func TestProbe_TLSExpiry(t *testing.T) {
+	server := newTestServer(t, map[string]http.HandlerFunc{
+		"metadata": jsonHandler(http.StatusOK, testCapabilityStatement),
+	})
+
+	probe := probeTestServer(t, server, 5*time.Second)
+
+	if probe.TLSExpiry == nil {
+		t.Fatalf("expected the tls expiry to be recorded")
+	}
+	if expected := server.Certificate().NotAfter; !probe.TLSExpiry.Equal(expected) {
+		t.Errorf("expected tls expiry %s, got %s", expected, probe.TLSExpiry)
+	}
+}
+
+func TestProbe_NonOkMetadata(t *testing.T) {
+	testCases := []struct {
+		name          string
+		status        int
+		body          string
+		expectedError string
+	}{
+		{"server error", http.StatusServiceUnavailable, `{"resourceType": "OperationOutcome"}`, "metadata: unexpected status code 503"},
+		{"not found", http.StatusNotFound, ``, "metadata: unexpected status code 404"},
+		{"invalid json", http.StatusOK, `<html></html>`, "metadata: invalid json response"},
+		{"not a CapabilityStatement", http.StatusOK, `{"resourceType": "OperationOutcome"}`, `metadata: expected a CapabilityStatement, got "OperationOutcome"`},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			server := newTestServer(t, map[string]http.HandlerFunc{
+				"metadata": jsonHandler(testCase.status, testCase.body),
+			})
+
+			probe := probeTestServer(t, server, 5*time.Second)
+
+			if probe.Status != models.EndpointProbeStatusError {
+				t.Fatalf("expected status error, got %s", probe.Status)
+			}
+			if !strings.HasPrefix(probe.Error, testCase.expectedError) {
+				t.Errorf("expected error %q, got %q", testCase.expectedError, probe.Error)
+			}
+			if probe.MetadataStatusCode != testCase.status {
+				t.Errorf("expected metadata status code %d, got %d", testCase.status, probe.MetadataStatusCode)
+			}
+			// the smart-configuration is not requested if the metadata request failed
+			if probe.SmartConfigurationStatusCode != 0 {
+				t.Errorf("expected no smart-configuration request, got status code %d", probe.SmartConfigurationStatusCode)
+			}
+		})
+	}
+}
+
+func TestProbe_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	server := newTestServer(t, map[string]http.HandlerFunc{
+		"metadata": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		},
+	})
+	// registered after the server, so the handler is released before the server is closed
+	t.Cleanup(func() { close(release) })
+
+	probe := probeTestServer(t, server, 100*time.Millisecond)
+
+	if probe.Status != models.EndpointProbeStatusError {
+		t.Fatalf("expected status error, got %s", probe.Status)
+	}
+	if !strings.HasPrefix(probe.Error, "metadata: ") || !strings.Contains(probe.Error, "Timeout") {
+		t.Errorf("expected a metadata timeout error, got %q", probe.Error)
+	}
+	if probe.MetadataStatusCode != 0 {
+		t.Errorf("expected no metadata status code, got %d", probe.MetadataStatusCode)
+	}
+	if probe.MetadataResponseTimeMs < 100 {
+		t.Errorf("expected the response time to include the timeout, got %dms", probe.MetadataResponseTimeMs)
+	}
+}
@@ -0,0 +1,107 @@
+package similarity
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"sort"
+)
+
+// DefaultMaxPostings is the default Index.MaxPostings
+const DefaultMaxPostings = 5000
+
+// Index is an in-memory inverted index of organization name tokens, used to find candidate organizations (blocking)
+// without comparing every pair of organizations. It also collects the TokenWeights used to score candidates.
+type Index struct {
+	// tokens found in more organizations than this are too common to be used for blocking, eg. "MEDICAL"
+	MaxPostings int
+
+	weights  *TokenWeights
+	orgIds   []string
+	postings map[string][]uint32
+}
+
+func NewIndex() *Index {
+	return &Index{
+		MaxPostings: DefaultMaxPostings,
+		weights:     NewTokenWeights(),
+		postings:    map[string][]uint32{},
+	}
+}
+
+// Add indexes the name & aliases of the organization. Only the organization ID is retained.
+func (idx *Index) Add(org *models.Organization) {
+	tokens := organizationTokens(org)
+	if len(tokens) == 0 {
+		return
+	}
+	orgNdx := uint32(len(idx.orgIds))
+	idx.orgIds = append(idx.orgIds, org.ID)
+	idx.weights.Add(tokens)
+	for _, token := range tokens {
+		idx.postings[token] = append(idx.postings[token], orgNdx)
+	}
+}
+
+func (idx *Index) Len() int {
+	return len(idx.orgIds)
+}
+
+func (idx *Index) Weights() *TokenWeights {
+	return idx.weights
+}
+
+// Similar is the same as the package level Similar, but weights tokens by their rarity across the indexed organizations
+func (idx *Index) Similar(orgA *models.Organization, orgB *models.Organization) float64 {
+	return organizationSimilarity(orgA, orgB, idx.weights)
+}
+
+// NameSimilarity is the same as the package level NameSimilarity, but weights tokens by their rarity across the indexed organizations
+func (idx *Index) NameSimilarity(nameA string, nameB string) float64 {
+	return NameSimilarity(nameA, nameB, idx.weights)
+}
+
+// Candidates returns the IDs of (up to limit) indexed organizations sharing at least one uncommon name token with the
+// organization, ordered by the total weight of the shared tokens. The organization itself is excluded.
+// If every token is too common, the rarest token is used.
+func (idx *Index) Candidates(org *models.Organization, limit int) []string {
+	tokens := organizationTokens(org)
+	if len(tokens) == 0 {
+		return nil
+	}
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return len(idx.postings[tokens[i]]) < len(idx.postings[tokens[j]])
+	})
+
+	scores := map[uint32]float64{}
+	for ndx, token := range tokens {
+		postings := idx.postings[token]
+		if len(postings) > idx.MaxPostings && ndx > 0 {
+			break
+		}
+		weight := idx.weights.Weight(token)
+		for _, orgNdx := range postings {
+			scores[orgNdx] += weight
+		}
+	}
+
+	var candidates []uint32
+	for orgNdx := range scores {
+		if idx.orgIds[orgNdx] != org.ID {
+			candidates = append(candidates, orgNdx)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if scores[candidates[i]] != scores[candidates[j]] {
+			return scores[candidates[i]] > scores[candidates[j]]
+		}
+		return idx.orgIds[candidates[i]] < idx.orgIds[candidates[j]]
+	})
+	if limit > 0 && len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	orgIds := make([]string, len(candidates))
+	for ndx, orgNdx := range candidates {
+		orgIds[ndx] = idx.orgIds[orgNdx]
+	}
+	return orgIds
+}
@@ -0,0 +1,74 @@
+package similarity
+
+// JaroWinkler returns the Jaro-Winkler similarity (0-1) of two strings, which favours strings with a common prefix.
+// See https://en.wikipedia.org/wiki/Jaro%E2%80%93Winkler_distance
+func JaroWinkler(a string, b string) float64 {
+	runesA, runesB := []rune(a), []rune(b)
+	jaro := jaroSimilarity(runesA, runesB)
+
+	prefix := 0
+	for prefix < len(runesA) && prefix < len(runesB) && prefix < 4 && runesA[prefix] == runesB[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+func jaroSimilarity(a []rune, b []rune) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	} else if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	matchDistance := len(a)
+	if len(b) > matchDistance {
+		matchDistance = len(b)
+	}
+	matchDistance = matchDistance/2 - 1
+	if matchDistance < 0 {
+		matchDistance = 0
+	}
+
+	matchedA := make([]bool, len(a))
+	matchedB := make([]bool, len(b))
+	matches := 0
+	for i := range a {
+		start := i - matchDistance
+		if start < 0 {
+			start = 0
+		}
+		end := i + matchDistance + 1
+		if end > len(b) {
+			end = len(b)
+		}
+		for j := start; j < end; j++ {
+			if matchedB[j] || a[i] != b[j] {
+				continue
+			}
+			matchedA[i], matchedB[j] = true, true
+			matches++
+			break
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range a {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if a[i] != b[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	return (m/float64(len(a)) + m/float64(len(b)) + (m-float64(transpositions)/2)/m) / 3
+}
@@ -0,0 +1,113 @@
+package similarity
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"math"
+	"strings"
+)
+
+const (
+	// tokens with a Jaro-Winkler similarity below this are not considered to be the same word (eg. typos)
+	tokenMatchThreshold = 0.9
+
+	// weights of the combined name score, must sum to 1
+	tokenOverlapWeight = 0.7
+	jaroWinklerWeight  = 0.3
+)
+
+// TokenWeights weights name tokens by their rarity (inverse document frequency) across all organizations, so that
+// sharing a rare word ("SUTTER") counts for more than sharing a common one ("MEDICAL").
+// The zero value weights every token equally.
+type TokenWeights struct {
+	documents      int
+	tokenDocuments map[string]int
+}
+
+func NewTokenWeights() *TokenWeights {
+	return &TokenWeights{tokenDocuments: map[string]int{}}
+}
+
+// Add counts the (distinct) tokens of an organization
+func (tw *TokenWeights) Add(tokens []string) {
+	if tw.tokenDocuments == nil {
+		tw.tokenDocuments = map[string]int{}
+	}
+	tw.documents++
+	seen := map[string]bool{}
+	for _, token := range tokens {
+		if !seen[token] {
+			seen[token] = true
+			tw.tokenDocuments[token]++
+		}
+	}
+}
+
+// Weight returns the inverse document frequency of the token. Unseen tokens are weighted as the rarest possible token.
+func (tw *TokenWeights) Weight(token string) float64 {
+	if tw == nil || tw.documents == 0 {
+		return 1
+	}
+	return math.Log(1 + float64(tw.documents)/float64(1+tw.tokenDocuments[token]))
+}
+
+// NameSimilarity returns a similarity score (0-1) for two organization names, combining a rarity weighted (soft) token
+// overlap with the Jaro-Winkler similarity of the full names. weights may be nil.
+func NameSimilarity(nameA string, nameB string, weights *TokenWeights) float64 {
+	tokensA, tokensB := Tokenize(nameA), Tokenize(nameB)
+	return tokenSimilarity(tokensA, tokensB, weights)
+}
+
+// Similar returns the best NameSimilarity of any name (or alias) of orgA to any name (or alias) of orgB, weighting every
+// token equally. Use Index.Similar to weight tokens by their rarity.
+func Similar(orgA *models.Organization, orgB *models.Organization) float64 {
+	return organizationSimilarity(orgA, orgB, nil)
+}
+
+func organizationSimilarity(orgA *models.Organization, orgB *models.Organization, weights *TokenWeights) float64 {
+	best := 0.0
+	for _, nameA := range OrganizationNames(orgA) {
+		for _, nameB := range OrganizationNames(orgB) {
+			if score := tokenSimilarity(strings.Fields(nameA), strings.Fields(nameB), weights); score > best {
+				best = score
+			}
+		}
+	}
+	return best
+}
+
+func tokenSimilarity(tokensA []string, tokensB []string, weights *TokenWeights) float64 {
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+	joinedA, joinedB := strings.Join(tokensA, " "), strings.Join(tokensB, " ")
+	if joinedA == joinedB {
+		return 1
+	}
+	overlap := (softTokenOverlap(tokensA, tokensB, weights) + softTokenOverlap(tokensB, tokensA, weights)) / 2
+	return tokenOverlapWeight*overlap + jaroWinklerWeight*JaroWinkler(joinedA, joinedB)
+}
+
+// softTokenOverlap is the weighted fraction of tokensA that are (approximately) present in tokensB
+func softTokenOverlap(tokensA []string, tokensB []string, weights *TokenWeights) float64 {
+	matched, total := 0.0, 0.0
+	for _, tokenA := range tokensA {
+		weight := weights.Weight(tokenA)
+		total += weight
+
+		best := 0.0
+		for _, tokenB := range tokensB {
+			if tokenA == tokenB {
+				best = 1
+				break
+			}
+			if score := JaroWinkler(tokenA, tokenB); score >= tokenMatchThreshold && score > best {
+				best = score
+			}
+		}
+		matched += weight * best
+	}
+	if total == 0 {
+		return 0
+	}
+	return matched / total
+}
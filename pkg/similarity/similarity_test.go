@@ -0,0 +1,186 @@
+package similarity
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	testCases := []struct {
+		a        string
+		b        string
+		expected float64
+	}{
+		{"", "", 1},
+		{"MARTHA", "", 0},
+		{"", "MARTHA", 0},
+		{"MARTHA", "MARTHA", 1},
+		{"ABC", "XYZ", 0},
+		{"MARTHA", "MARHTA", 0.9611},
+		{"DWAYNE", "DUANE", 0.84},
+		{"DIXON", "DICKSONX", 0.8133},
+		{"JELLYFISH", "SMELLYFISH", 0.8963},
+		// multi-byte runes are compared as characters
+		{"CL\u00cdNICA", "CLINICA", 0.8794},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.a+"/"+testCase.b, func(t *testing.T) {
+			score := JaroWinkler(testCase.a, testCase.b)
+			if math.Abs(score-testCase.expected) > 0.0001 {
+				t.Errorf("expected %.4f, got %.4f", testCase.expected, score)
+			}
+			if reverse := JaroWinkler(testCase.b, testCase.a); math.Abs(score-reverse) > 0.0001 {
+				t.Errorf("expected a symmetric score, got %.4f and %.4f", score, reverse)
+			}
+		})
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	testCases := []struct {
+		nameA string
+		nameB string
+		min   float64
+		max   float64
+	}{
+		// names that canonicalize to the same value are identical
+		{"St. Mary's Hospital", "SAINT MARYS HOSP", 1, 1},
+		{"Alpha Clinic, Inc.", "ALPHA CLINIC", 1, 1},
+		// typos & missing words are similar
+		{"Sutter Medical Center", "Suter Medical Center", 0.9, 0.99},
+		{"Sutter Medical Center Sacramento", "Sutter Medical Center", 0.8, 0.99},
+		// unrelated names are not
+		{"Sutter Medical Center", "Kaiser Permanente", 0, 0.5},
+		{"", "Sutter Medical Center", 0, 0},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.nameA+"/"+testCase.nameB, func(t *testing.T) {
+			score := NameSimilarity(testCase.nameA, testCase.nameB, nil)
+			if score < testCase.min || score > testCase.max {
+				t.Errorf("expected a score between %.2f and %.2f, got %.4f", testCase.min, testCase.max, score)
+			}
+		})
+	}
+}
+
+func TestTokenWeights(t *testing.T) {
+	weights := NewTokenWeights()
+	weights.Add([]string{"SUTTER", "MEDICAL", "CENTER"})
+	weights.Add([]string{"KAISER", "MEDICAL", "CENTER"})
+	weights.Add([]string{"ALPHA", "MEDICAL", "MEDICAL"})
+
+	if weights.Weight("SUTTER") <= weights.Weight("MEDICAL") {
+		t.Errorf("expected rare tokens to weigh more than common tokens")
+	}
+	if weights.Weight("UNSEEN") <= weights.Weight("SUTTER") {
+		t.Errorf("expected unseen tokens to weigh the most")
+	}
+	var empty *TokenWeights
+	if empty.Weight("SUTTER") != 1 || NewTokenWeights().Weight("SUTTER") != 1 {
+		t.Errorf("expected empty weights to weigh every token equally")
+	}
+
+	// sharing a rare token scores higher than sharing a common token
+	rare := NameSimilarity("Sutter Clinic", "Sutter Hospital", weights)
+	common := NameSimilarity("Medical Clinic", "Medical Hospital", weights)
+	if rare <= common {
+		t.Errorf("expected sharing a rare token (%.4f) to score higher than a common token (%.4f)", rare, common)
+	}
+}
+
+func testOrganization(id string, name string, aliases ...string) *models.Organization {
+	org := &models.Organization{ID: id, Name: name}
+	for _, alias := range aliases {
+		org.OrganizationIdentifiers = append(org.OrganizationIdentifiers, models.OrganizationIdentifier{
+			IdentifierType:  models.OrganizationIdentifierTypeName,
+			IdentifierValue: alias,
+		})
+	}
+	return org
+}
+
+func TestOrganizationNames(t *testing.T) {
+	org := testOrganization("1", "St. Mary's Hospital", "SAINT MARYS HOSPITAL", "Mercy Clinic", "")
+	org.OrganizationIdentifiers = append(org.OrganizationIdentifiers, models.OrganizationIdentifier{
+		IdentifierType:  models.OrganizationIdentifierTypeNPI,
+		IdentifierValue: "1234567893",
+	})
+
+	expected := []string{"MERCY CLINIC", "SAINT MARYS HOSPITAL"}
+	if names := OrganizationNames(org); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
+
+func TestSimilar_UsesAliases(t *testing.T) {
+	orgA := testOrganization("1", "Sutter Medical Center", "Sutter Health Sacramento")
+	orgB := testOrganization("2", "Sutter Health Sacramento")
+	if score := Similar(orgA, orgB); score != 1 {
+		t.Errorf("expected an alias match to score 1, got %.4f", score)
+	}
+}
+
+func TestIndex_Candidates(t *testing.T) {
+	index := NewIndex()
+	for _, org := range []*models.Organization{
+		testOrganization("1", "Sutter Medical Center"),
+		testOrganization("2", "Sutter Health", "Sutter Roseville Medical Center"),
+		testOrganization("3", "Kaiser Medical Center"),
+		testOrganization("4", "Alpha Medical Center"),
+		testOrganization("5", "Roseville Family Clinic"),
+		testOrganization("6", ""),
+	} {
+		index.Add(org)
+	}
+	if index.Len() != 5 {
+		t.Fatalf("expected organizations without a name to be skipped, got %d indexed", index.Len())
+	}
+
+	testCases := []struct {
+		name     string
+		org      *models.Organization
+		limit    int
+		expected []string
+	}{
+		{"shared tokens, ordered by weight", testOrganization("new", "Sutter Roseville"), 0, []string{"2", "1", "5"}},
+		{"limit", testOrganization("new", "Sutter Roseville"), 1, []string{"2"}},
+		{"itself is excluded", testOrganization("1", "Sutter Medical Center"), 0, []string{"2", "3", "4"}},
+		{"no shared tokens", testOrganization("new", "Beta Clinic"), 0, []string{"5"}},
+		{"no tokens", testOrganization("new", ""), 0, nil},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			candidates := index.Candidates(testCase.org, testCase.limit)
+			if len(candidates) == 0 && len(testCase.expected) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(candidates, testCase.expected) {
+				t.Errorf("expected %v, got %v", testCase.expected, candidates)
+			}
+		})
+	}
+}
+
+func TestIndex_CandidatesSkipsCommonTokens(t *testing.T) {
+	index := NewIndex()
+	index.MaxPostings = 2
+	for _, org := range []*models.Organization{
+		testOrganization("1", "Sutter Medical Center"),
+		testOrganization("2", "Kaiser Medical Center"),
+		testOrganization("3", "Alpha Medical Center"),
+	} {
+		index.Add(org)
+	}
+
+	// MEDICAL & CENTER are in every organization, so only SUTTER is used for blocking
+	if candidates := index.Candidates(testOrganization("new", "Sutter Medical Center"), 0); !reflect.DeepEqual(candidates, []string{"1"}) {
+		t.Errorf("expected only the organization sharing the rare token, got %v", candidates)
+	}
+	// if every token is too common, the rarest token is still used
+	if candidates := index.Candidates(testOrganization("new", "Medical Center"), 0); len(candidates) != 3 {
+		t.Errorf("expected the rarest token to be used, got %v", candidates)
+	}
+}
@@ -0,0 +1,59 @@
+package similarity
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"sort"
+	"strings"
+)
+
+// Tokenize canonicalizes an organization name (see utils.NormalizeOrganizationName), which expands abbreviations and
+// removes stop words & legal suffixes, then splits it into words. Token order is preserved.
+func Tokenize(name string) []string {
+	normalizedName, err := utils.NormalizeOrganizationName(name)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(normalizedName)
+}
+
+// OrganizationNames returns the name & aliases (name identifiers) of the organization, without duplicates.
+func OrganizationNames(org *models.Organization) []string {
+	names := map[string]bool{}
+	if org.Name != "" {
+		names[org.Name] = true
+	}
+	for _, identifier := range org.OrganizationIdentifiers {
+		if identifier.IdentifierType == models.OrganizationIdentifierTypeName && identifier.IdentifierValue != "" {
+			names[identifier.IdentifierValue] = true
+		}
+	}
+
+	//names that only differ by case or punctuation are duplicates
+	normalizedNames := map[string]bool{}
+	var nameList []string
+	for name := range names {
+		normalizedName := strings.Join(Tokenize(name), " ")
+		if normalizedName == "" || normalizedNames[normalizedName] {
+			continue
+		}
+		normalizedNames[normalizedName] = true
+		nameList = append(nameList, normalizedName)
+	}
+	sort.Strings(nameList)
+	return nameList
+}
+
+func organizationTokens(org *models.Organization) []string {
+	tokenSet := map[string]bool{}
+	var tokens []string
+	for _, name := range OrganizationNames(org) {
+		for _, token := range strings.Fields(name) {
+			if !tokenSet[token] {
+				tokenSet[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
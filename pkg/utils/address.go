@@ -0,0 +1,339 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// USPS Publication 28 address standardization.
+// See https://pe.usps.com/text/pub28/welcome.htm
+
+// Street suffixes (Appendix C1), standard abbreviation -> common spellings
+var uspsStreetSuffixes = standardAbbreviations(map[string][]string{
+	"ALY":  {"ALLEY", "ALLEE", "ALLY"},
+	"ANX":  {"ANNEX", "ANNX"},
+	"ARC":  {"ARCADE"},
+	"AVE":  {"AVENUE", "AV", "AVEN", "AVENU", "AVN", "AVNUE"},
+	"BYU":  {"BAYOU"},
+	"BCH":  {"BEACH"},
+	"BND":  {"BEND"},
+	"BLF":  {"BLUFF"},
+	"BTM":  {"BOTTOM"},
+	"BLVD": {"BOULEVARD", "BOUL", "BOULV"},
+	"BR":   {"BRANCH"},
+	"BRG":  {"BRIDGE"},
+	"BRK":  {"BROOK"},
+	"BYP":  {"BYPASS"},
+	"CP":   {"CAMP"},
+	"CYN":  {"CANYON"},
+	"CPE":  {"CAPE"},
+	"CSWY": {"CAUSEWAY"},
+	"CTR":  {"CENTER", "CENTRE", "CENTR", "CNTER", "CNTR", "CEN", "CENT"},
+	"CIR":  {"CIRCLE", "CIRC", "CIRCL", "CRCL", "CRCLE"},
+	"CLF":  {"CLIFF"},
+	"CLB":  {"CLUB"},
+	"CMN":  {"COMMON"},
+	"COR":  {"CORNER"},
+	"CORS": {"CORNERS"},
+	"CRSE": {"COURSE"},
+	"CT":   {"COURT"},
+	"CTS":  {"COURTS"},
+	"CV":   {"COVE"},
+	"CRK":  {"CREEK"},
+	"CRES": {"CRESCENT"},
+	"XING": {"CROSSING"},
+	"XRD":  {"CROSSROAD"},
+	"CURV": {"CURVE"},
+	"DL":   {"DALE"},
+	"DM":   {"DAM"},
+	"DV":   {"DIVIDE"},
+	"DR":   {"DRIVE", "DRIV", "DRV"},
+	"EST":  {"ESTATE"},
+	"ESTS": {"ESTATES"},
+	"EXPY": {"EXPRESSWAY", "EXPRESS", "EXPR", "EXPW"},
+	"EXT":  {"EXTENSION", "EXTN", "EXTNSN"},
+	"FLS":  {"FALLS"},
+	"FRY":  {"FERRY"},
+	"FLD":  {"FIELD"},
+	"FLDS": {"FIELDS"},
+	"FLT":  {"FLAT"},
+	"FRD":  {"FORD"},
+	"FRST": {"FOREST"},
+	"FRG":  {"FORGE"},
+	"FRK":  {"FORK"},
+	"FT":   {"FORT"},
+	"FWY":  {"FREEWAY", "FREEWY", "FRWAY", "FRWY"},
+	"GDN":  {"GARDEN"},
+	"GDNS": {"GARDENS"},
+	"GTWY": {"GATEWAY"},
+	"GLN":  {"GLEN"},
+	"GRN":  {"GREEN"},
+	"GRV":  {"GROVE"},
+	"HBR":  {"HARBOR"},
+	"HVN":  {"HAVEN"},
+	"HTS":  {"HEIGHTS", "HT"},
+	"HWY":  {"HIGHWAY", "HIGHWY", "HIWAY", "HIWY", "HWAY"},
+	"HL":   {"HILL"},
+	"HLS":  {"HILLS"},
+	"HOLW": {"HOLLOW"},
+	"IS":   {"ISLAND"},
+	"JCT":  {"JUNCTION"},
+	"KNL":  {"KNOLL"},
+	"LK":   {"LAKE"},
+	"LKS":  {"LAKES"},
+	"LNDG": {"LANDING"},
+	"LN":   {"LANE"},
+	"LGT":  {"LIGHT"},
+	"LOOP": {},
+	"MALL": {},
+	"MNR":  {"MANOR"},
+	"MDW":  {"MEADOW"},
+	"MDWS": {"MEADOWS"},
+	"ML":   {"MILL"},
+	"MSN":  {"MISSION"},
+	"MTWY": {"MOTORWAY"},
+	"MT":   {"MOUNT"},
+	"MTN":  {"MOUNTAIN"},
+	"ORCH": {"ORCHARD"},
+	"OVAL": {},
+	"PARK": {},
+	"PKWY": {"PARKWAY", "PARKWY", "PKWAY", "PKY"},
+	"PASS": {},
+	"PATH": {},
+	"PIKE": {},
+	"PNE":  {"PINE"},
+	"PNES": {"PINES"},
+	"PL":   {"PLACE"},
+	"PLN":  {"PLAIN"},
+	"PLNS": {"PLAINS"},
+	"PLZ":  {"PLAZA", "PLZA"},
+	"PT":   {"POINT"},
+	"PTS":  {"POINTS"},
+	"PRT":  {"PORT"},
+	"PR":   {"PRAIRIE"},
+	"RNCH": {"RANCH"},
+	"RDG":  {"RIDGE"},
+	"RIV":  {"RIVER"},
+	"RD":   {"ROAD"},
+	"RDS":  {"ROADS"},
+	"RTE":  {"ROUTE"},
+	"ROW":  {},
+	"RUN":  {},
+	"SHR":  {"SHORE"},
+	"SKWY": {"SKYWAY"},
+	"SPG":  {"SPRING"},
+	"SPGS": {"SPRINGS"},
+	"SQ":   {"SQUARE", "SQR", "SQRE", "SQU"},
+	"STA":  {"STATION", "STATN", "STN"},
+	"STRM": {"STREAM"},
+	"ST":   {"STREET", "STR", "STRT"},
+	"STS":  {"STREETS"},
+	"SMT":  {"SUMMIT"},
+	"TER":  {"TERRACE", "TERR"},
+	"TRCE": {"TRACE"},
+	"TRL":  {"TRAIL", "TRAILS", "TRLS"},
+	"TUNL": {"TUNNEL"},
+	"TPKE": {"TURNPIKE", "TURNPK", "TRNPK"},
+	"UN":   {"UNION"},
+	"VLY":  {"VALLEY"},
+	"VIA":  {"VIADUCT"},
+	"VW":   {"VIEW"},
+	"VLG":  {"VILLAGE"},
+	"VL":   {"VILLE"},
+	"VIS":  {"VISTA"},
+	"WALK": {},
+	"WAY":  {},
+	"WLS":  {"WELLS"},
+})
+
+// Directionals (Appendix B)
+var uspsDirectionals = standardAbbreviations(map[string][]string{
+	"N":  {"NORTH"},
+	"S":  {"SOUTH"},
+	"E":  {"EAST"},
+	"W":  {"WEST"},
+	"NE": {"NORTHEAST"},
+	"NW": {"NORTHWEST"},
+	"SE": {"SOUTHEAST"},
+	"SW": {"SOUTHWEST"},
+})
+
+// Secondary unit designators (Appendix C2)
+var uspsUnitDesignators = standardAbbreviations(map[string][]string{
+	"APT":  {"APARTMENT"},
+	"BSMT": {"BASEMENT"},
+	"BLDG": {"BUILDING", "BLD"},
+	"DEPT": {"DEPARTMENT"},
+	"FL":   {"FLOOR", "FLR"},
+	"FRNT": {"FRONT"},
+	"HNGR": {"HANGAR"},
+	"LBBY": {"LOBBY"},
+	"LOT":  {},
+	"LOWR": {"LOWER"},
+	"OFC":  {"OFFICE"},
+	"PH":   {"PENTHOUSE"},
+	"PIER": {},
+	"REAR": {},
+	"RM":   {"ROOM"},
+	"SIDE": {},
+	"SLIP": {},
+	"SPC":  {"SPACE"},
+	"STOP": {},
+	"STE":  {"SUITE", "SUIT", "SUITES"},
+	"TRLR": {"TRAILER"},
+	"UNIT": {},
+	"UPPR": {"UPPER"},
+	"#":    {},
+})
+
+var (
+	addressPunctuationRegex = regexp.MustCompile(`[^A-Z0-9#/\-\s]+`)
+	addressHashRegex        = regexp.MustCompile(`#`)
+	poBoxRegex              = regexp.MustCompile(`^(P\s*O|POST\s+OFFICE|POST|P\s+O\s+B)\s+(BOX|BX|B)\s+`)
+	postalCodeDigitsRegex   = regexp.MustCompile(`[^0-9]+`)
+)
+
+// StandardizeAddressLine converts a street address line to the USPS standard form: upper case, without punctuation, with
+// standard street suffix, directional & secondary unit abbreviations. eg. "123 North Main Street, Suite #100" -> "123 N MAIN ST STE 100"
+func StandardizeAddressLine(line string) string {
+	line = strings.ToUpper(line)
+	line = strings.ReplaceAll(line, ".", "")
+	line = addressPunctuationRegex.ReplaceAllString(line, " ")
+	line = addressHashRegex.ReplaceAllString(line, " # ")
+	line = strings.Join(strings.Fields(line), " ")
+	if line == "" {
+		return ""
+	}
+	line = poBoxRegex.ReplaceAllString(line+" ", "PO BOX ")
+	words := strings.Fields(line)
+	if len(words) >= 2 && words[0] == "PO" && words[1] == "BOX" {
+		return strings.Join(words, " ")
+	}
+
+	// the secondary unit starts at the first unit designator followed by a unit number (eg. STE 100, FL 2, # 3B).
+	// designators such as FRONT or LOT are also common street names, so designators without a number are ignored.
+	unitNdx := len(words)
+	for ndx, word := range words {
+		if _, ok := uspsUnitDesignators[word]; ok && ndx+1 < len(words) && isUnitNumber(words[ndx+1]) {
+			unitNdx = ndx
+			break
+		}
+	}
+	street, unit := words[:unitNdx], words[unitNdx:]
+
+	// trailing directional, the street suffix and leading directional (after the house number). The street name is
+	// never abbreviated, eg. "NORTH STREET" (rather than "N STREET") & "WEST PARK".
+	nameStart := 0
+	if len(street) > 0 && isAddressNumber(street[0]) {
+		nameStart = 1
+	}
+	nameEnd := len(street)
+	if nameEnd-nameStart > 1 {
+		if directional, ok := uspsDirectionals[street[nameEnd-1]]; ok {
+			street[nameEnd-1] = directional
+			nameEnd--
+		}
+	}
+	if nameEnd-nameStart > 1 {
+		if suffix, ok := uspsStreetSuffixes[street[nameEnd-1]]; ok {
+			street[nameEnd-1] = suffix
+			nameEnd--
+		}
+	}
+	if nameEnd-nameStart > 1 {
+		if directional, ok := uspsDirectionals[street[nameStart]]; ok {
+			street[nameStart] = directional
+		}
+	}
+
+	// secondary units, "SUITE # 100" -> "STE 100"
+	var standardizedUnit []string
+	for ndx := 0; ndx < len(unit); ndx++ {
+		if designator, ok := uspsUnitDesignators[unit[ndx]]; ok {
+			standardizedUnit = append(standardizedUnit, designator)
+			if designator != "#" && ndx+1 < len(unit) && unit[ndx+1] == "#" {
+				ndx++
+			}
+		} else {
+			standardizedUnit = append(standardizedUnit, unit[ndx])
+		}
+	}
+
+	return strings.Join(append(street, standardizedUnit...), " ")
+}
+
+// StandardizeCity upper cases the city, and removes punctuation
+func StandardizeCity(city string) string {
+	city = strings.ReplaceAll(strings.ToUpper(city), ".", "")
+	city = addressPunctuationRegex.ReplaceAllString(city, " ")
+	return strings.Join(strings.Fields(city), " ")
+}
+
+// StandardizeState converts US state & territory names to their two-letter abbreviation. Unknown values are upper cased.
+func StandardizeState(state string) string {
+	state = strings.Join(strings.Fields(strings.ToUpper(strings.ReplaceAll(state, ".", ""))), " ")
+	if _, ok := USStateNames[state]; ok {
+		return state
+	}
+	for code, name := range USStateNames {
+		if name == state {
+			return code
+		}
+	}
+	return state
+}
+
+// StandardizePostalCode returns the five digit ZIP code and (optional) four digit ZIP+4 extension.
+// Values that are not US ZIP codes are returned (upper cased) as the postal code, without an extension.
+func StandardizePostalCode(postalCode string) (string, string) {
+	postalCode = strings.TrimSpace(strings.ToUpper(postalCode))
+	digits := postalCodeDigitsRegex.ReplaceAllString(postalCode, "")
+	if len(digits) != len(strings.ReplaceAll(strings.ReplaceAll(postalCode, "-", ""), " ", "")) {
+		return postalCode, ""
+	}
+	switch len(digits) {
+	case 5:
+		return digits, ""
+	case 9:
+		return digits[:5], digits[5:]
+	default:
+		return postalCode, ""
+	}
+}
+
+// standardAbbreviations converts a list of spellings for each standard abbreviation into a lookup table.
+// The standard abbreviation is always included as one of its own spellings.
+func standardAbbreviations(spellings map[string][]string) map[string]string {
+	lookup := map[string]string{}
+	for abbreviation, abbreviationSpellings := range spellings {
+		lookup[abbreviation] = abbreviation
+		for _, spelling := range abbreviationSpellings {
+			lookup[spelling] = abbreviation
+		}
+	}
+	return lookup
+}
+
+func isUnitNumber(word string) bool {
+	return word == "#" || len(word) == 1 || strings.ContainsAny(word, "0123456789")
+}
+
+func isAddressNumber(word string) bool {
+	return len(word) > 0 && word[0] >= '0' && word[0] <= '9'
+}
+
+// USStateNames contains the USPS two-letter abbreviations of US states, DC, territories & military "states" (Appendix B)
+var USStateNames = map[string]string{
+	"AL": "ALABAMA", "AK": "ALASKA", "AZ": "ARIZONA", "AR": "ARKANSAS", "CA": "CALIFORNIA", "CO": "COLORADO",
+	"CT": "CONNECTICUT", "DE": "DELAWARE", "DC": "DISTRICT OF COLUMBIA", "FL": "FLORIDA", "GA": "GEORGIA", "HI": "HAWAII",
+	"ID": "IDAHO", "IL": "ILLINOIS", "IN": "INDIANA", "IA": "IOWA", "KS": "KANSAS", "KY": "KENTUCKY", "LA": "LOUISIANA",
+	"ME": "MAINE", "MD": "MARYLAND", "MA": "MASSACHUSETTS", "MI": "MICHIGAN", "MN": "MINNESOTA", "MS": "MISSISSIPPI",
+	"MO": "MISSOURI", "MT": "MONTANA", "NE": "NEBRASKA", "NV": "NEVADA", "NH": "NEW HAMPSHIRE", "NJ": "NEW JERSEY",
+	"NM": "NEW MEXICO", "NY": "NEW YORK", "NC": "NORTH CAROLINA", "ND": "NORTH DAKOTA", "OH": "OHIO", "OK": "OKLAHOMA",
+	"OR": "OREGON", "PA": "PENNSYLVANIA", "RI": "RHODE ISLAND", "SC": "SOUTH CAROLINA", "SD": "SOUTH DAKOTA",
+	"TN": "TENNESSEE", "TX": "TEXAS", "UT": "UTAH", "VT": "VERMONT", "VA": "VIRGINIA", "WA": "WASHINGTON",
+	"WV": "WEST VIRGINIA", "WI": "WISCONSIN", "WY": "WYOMING",
+	"AS": "AMERICAN SAMOA", "GU": "GUAM", "MP": "NORTHERN MARIANA ISLANDS", "PR": "PUERTO RICO", "VI": "VIRGIN ISLANDS",
+	"FM": "FEDERATED STATES OF MICRONESIA", "MH": "MARSHALL ISLANDS", "PW": "PALAU",
+	"AA": "ARMED FORCES AMERICAS", "AE": "ARMED FORCES EUROPE", "AP": "ARMED FORCES PACIFIC",
+}
@@ -0,0 +1,105 @@
+package utils
+
+import "testing"
+
+func TestStandardizeAddressLine(t *testing.T) {
+	testCases := []struct {
+		line     string
+		expected string
+	}{
+		{"123 North Main Street, Suite #100", "123 N MAIN ST STE 100"},
+		{"123 N. Main St.", "123 N MAIN ST"},
+		{"  456   elm avenue  ", "456 ELM AVE"},
+		{"789 Park Boulevard Southwest", "789 PARK BLVD SW"},
+		// only the last suffix is abbreviated
+		{"1 Medical Center Drive Building 2 Floor 3", "1 MEDICAL CENTER DR BLDG 2 FL 3"},
+		{"10 Oak Street Apt # 4B", "10 OAK ST APT 4B"},
+		{"10 Oak Street #4B", "10 OAK ST # 4B"},
+		{"P.O. Box 123", "PO BOX 123"},
+		{"Post Office Box 456", "PO BOX 456"},
+		{"POB 789", "POB 789"},
+		// directionals & suffixes are only abbreviated when they are not the street name
+		{"100 North Street", "100 NORTH ST"},
+		{"200 Avenue", "200 AVENUE"},
+		{"300 West Park", "300 WEST PARK"},
+		{"300 West Park Avenue", "300 W PARK AVE"},
+		{"400 North Street South", "400 NORTH ST S"},
+		// designators without a unit number are street names
+		{"12 Front Street", "12 FRONT ST"},
+		{"12 Lot Road Lot 5", "12 LOT RD LOT 5"},
+		{"", ""},
+		{" , . ", ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.line, func(t *testing.T) {
+			if standardized := StandardizeAddressLine(testCase.line); standardized != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, standardized)
+			}
+		})
+	}
+}
+
+func TestStandardizeCity(t *testing.T) {
+	testCases := []struct {
+		city     string
+		expected string
+	}{
+		{"St. Louis", "ST LOUIS"},
+		{"  san   francisco ", "SAN FRANCISCO"},
+		{"Winston-Salem", "WINSTON-SALEM"},
+		{"Coeur d'Alene", "COEUR D ALENE"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.city, func(t *testing.T) {
+			if standardized := StandardizeCity(testCase.city); standardized != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, standardized)
+			}
+		})
+	}
+}
+
+func TestStandardizeState(t *testing.T) {
+	testCases := []struct {
+		state    string
+		expected string
+	}{
+		{"CA", "CA"},
+		{"ca", "CA"},
+		{"California", "CA"},
+		{"new  york", "NY"},
+		{"District of Columbia", "DC"},
+		{"Puerto Rico", "PR"},
+		{"Ontario", "ONTARIO"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.state, func(t *testing.T) {
+			if standardized := StandardizeState(testCase.state); standardized != testCase.expected {
+				t.Errorf("expected %q, got %q", testCase.expected, standardized)
+			}
+		})
+	}
+}
+
+func TestStandardizePostalCode(t *testing.T) {
+	testCases := []struct {
+		postalCode        string
+		expectedZip       string
+		expectedExtension string
+	}{
+		{"94105", "94105", ""},
+		{"94105-1234", "94105", "1234"},
+		{"941051234", "94105", "1234"},
+		{" 94105 1234 ", "94105", "1234"},
+		{"9410", "9410", ""},
+		{"k1a 0b1", "K1A 0B1", ""},
+		{"", "", ""},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.postalCode, func(t *testing.T) {
+			zip, extension := StandardizePostalCode(testCase.postalCode)
+			if zip != testCase.expectedZip || extension != testCase.expectedExtension {
+				t.Errorf("expected %q %q, got %q %q", testCase.expectedZip, testCase.expectedExtension, zip, extension)
+			}
+		})
+	}
+}
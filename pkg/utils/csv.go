@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// CSVRow is a row of a CSV file with a header, columns are looked up by name (case insensitive)
+type CSVRow struct {
+	columns map[string]int
+	record  []string
+}
+
+// Get returns the (trimmed) value of the first column that exists, or "" if none of the columns exist.
+// Datasets are republished with slightly different column names, eg. "City" & "City/Town".
+func (row CSVRow) Get(names ...string) string {
+	for _, name := range names {
+		if ndx, ok := row.columns[strings.ToUpper(name)]; ok && ndx < len(row.record) {
+			return strings.TrimSpace(row.record[ndx])
+		}
+	}
+	return ""
+}
+
+// ReadCSV calls the callback for every row of the CSV file (with its 1-based line number). Returns an error if the
+// header is missing any of the required columns (each required column is a list of alternative names).
+func ReadCSV(filePath string, required [][]string, callback func(row CSVRow, line int) error) error {
+	csvFile, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer csvFile.Close()
+	reader := csv.NewReader(csvFile)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("error reading CSV header (%s): %v", filePath, err)
+	}
+	columns := map[string]int{}
+	for ndx, name := range header {
+		name = strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, exists := columns[name]; !exists {
+			columns[name] = ndx
+		}
+	}
+	for _, alternatives := range required {
+		found := false
+		for _, name := range alternatives {
+			if _, found = columns[strings.ToUpper(name)]; found {
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("CSV file (%s) is missing the %s column", filePath, strings.Join(alternatives, " or "))
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("error reading CSV file (%s): %v", filePath, err)
+		}
+		line, _ := reader.FieldPos(0)
+		err = callback(CSVRow{columns: columns, record: record}, line)
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestCSV(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "test.csv")
+	err := os.WriteFile(filePath, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return filePath
+}
+
+func TestReadCSV(t *testing.T) {
+	filePath := writeTestCSV(t, "\ufeffFacility ID,City/Town, Name \n001, Dothan ,\"Foo \"Bar\" Clinic\"\n002\n")
+
+	var rows []string
+	var lines []int
+	err := ReadCSV(filePath, [][]string{{"facility id"}, {"City", "City/Town"}}, func(row CSVRow, line int) error {
+		rows = append(rows, strings.Join([]string{row.Get("FACILITY ID"), row.Get("City", "City/Town"), row.Get("name"), row.Get("missing")}, "|"))
+		lines = append(lines, line)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{`001|Dothan|Foo "Bar" Clinic|`, "002|||"}
+	if strings.Join(rows, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %q, got %q", expected, rows)
+	}
+	if len(lines) != 2 || lines[0] != 2 || lines[1] != 3 {
+		t.Errorf("expected lines [2 3], got %v", lines)
+	}
+}
+
+func TestReadCSV_MissingColumn(t *testing.T) {
+	filePath := writeTestCSV(t, "npi,name\n1234567893,Foo Clinic\n")
+
+	err := ReadCSV(filePath, [][]string{{"url", "website"}}, func(row CSVRow, line int) error {
+		t.Errorf("unexpected row (line %d)", line)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "url or website") {
+		t.Errorf("expected missing column error, got %v", err)
+	}
+}
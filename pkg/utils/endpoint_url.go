@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	schemePrefixRegex   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]*://`)
+	duplicateSlashRegex = regexp.MustCompile(`/{2,}`)
+	// hostnames are limited to letters, digits & hyphens (after IDNA conversion)
+	hostnameLabelRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9\-]*[a-z0-9])?$`)
+	numericRegex       = regexp.MustCompile(`^[0-9]+$`)
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// hostnames that can never be reached from the public internet
+var privateHostnameSuffixes = []string{
+	".localhost",
+	".local",
+	".internal",
+	".intranet",
+	".lan",
+	".corp",
+	".home.arpa",
+}
+
+// CanonicalizeEndpointURL converts the many ways of writing the same FHIR endpoint into a single canonical form, so that
+// eg. `HTTPS://Host:443/FHIR/metadata`, `host/FHIR` and `host/FHIR/` are all stored as `https://host/FHIR/`
+//
+// - the scheme defaults to https, and is lowercased
+// - the host is lowercased and converted to ASCII (IDNA), default ports are removed
+// - duplicate slashes, a trailing `metadata` segment, query strings and fragments are removed
+// - the path always ends with `/`
+//
+// Path case is preserved, as FHIR servers may be case-sensitive.
+func CanonicalizeEndpointURL(rawUrl string) (string, error) {
+	trimmedUrl := strings.TrimSpace(rawUrl)
+	if trimmedUrl == "" {
+		return "", fmt.Errorf("url is empty")
+	}
+	if !schemePrefixRegex.MatchString(trimmedUrl) {
+		trimmedUrl = "https://" + trimmedUrl
+	}
+
+	parsedUrl, err := url.Parse(trimmedUrl)
+	if err != nil {
+		return "", fmt.Errorf("url could not be parsed: %v", err)
+	}
+	parsedUrl.Scheme = strings.ToLower(parsedUrl.Scheme)
+
+	hostname := strings.TrimSuffix(strings.ToLower(parsedUrl.Hostname()), ".")
+	if hostname == "" {
+		return "", fmt.Errorf("url is missing a host")
+	}
+	if net.ParseIP(hostname) == nil {
+		hostname, err = idna.Lookup.ToASCII(hostname)
+		if err != nil {
+			return "", fmt.Errorf("url host is not a valid domain name: %v", err)
+		}
+	} else if strings.Contains(hostname, ":") {
+		//IPv6 literal
+		hostname = "[" + hostname + "]"
+	}
+	port := parsedUrl.Port()
+	if port == "" || defaultPorts[parsedUrl.Scheme] == port {
+		parsedUrl.Host = hostname
+	} else {
+		parsedUrl.Host = hostname + ":" + port
+	}
+
+	path := duplicateSlashRegex.ReplaceAllString(parsedUrl.Path, "/")
+	path = strings.TrimSuffix(path, "/")
+	for strings.HasSuffix(strings.ToLower(path), "/metadata") {
+		path = path[:len(path)-len("/metadata")]
+	}
+	parsedUrl.Path = path + "/"
+	parsedUrl.RawPath = ""
+
+	parsedUrl.RawQuery = ""
+	parsedUrl.ForceQuery = false
+	parsedUrl.Fragment = ""
+	parsedUrl.RawFragment = ""
+
+	return parsedUrl.String(), nil
+}
+
+// EndpointURLValidationError lists every reason an endpoint url was rejected
+type EndpointURLValidationError struct {
+	URL     string
+	Reasons []string
+}
+
+func (e *EndpointURLValidationError) Error() string {
+	return fmt.Sprintf("invalid endpoint url (%s): %s", e.URL, strings.Join(e.Reasons, ", "))
+}
+
+// ValidateEndpointURL rejects endpoint urls that are unusable from the public internet: non-http(s) schemes,
+// private, loopback & link-local hosts, and obviously broken urls. Returns an *EndpointURLValidationError.
+func ValidateEndpointURL(rawUrl string) error {
+	validationErr := &EndpointURLValidationError{URL: rawUrl}
+
+	canonicalUrl, err := CanonicalizeEndpointURL(rawUrl)
+	if err != nil {
+		validationErr.Reasons = append(validationErr.Reasons, err.Error())
+		return validationErr
+	}
+	parsedUrl, err := url.Parse(canonicalUrl)
+	if err != nil {
+		validationErr.Reasons = append(validationErr.Reasons, fmt.Sprintf("url could not be parsed: %v", err))
+		return validationErr
+	}
+
+	if parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https" {
+		validationErr.Reasons = append(validationErr.Reasons, fmt.Sprintf("unsupported scheme %q", parsedUrl.Scheme))
+	}
+	if parsedUrl.User != nil {
+		validationErr.Reasons = append(validationErr.Reasons, "url must not contain credentials")
+	}
+	if strings.ContainsAny(strings.TrimSpace(rawUrl), " \t\r\n") {
+		validationErr.Reasons = append(validationErr.Reasons, "url contains whitespace")
+	}
+
+	hostname := parsedUrl.Hostname()
+	if ip := net.ParseIP(hostname); ip != nil {
+		if ip.IsLoopback() {
+			validationErr.Reasons = append(validationErr.Reasons, "host is a loopback address")
+		} else if ip.IsPrivate() {
+			validationErr.Reasons = append(validationErr.Reasons, "host is a private address")
+		} else if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			validationErr.Reasons = append(validationErr.Reasons, "host is a link-local address")
+		} else if ip.IsUnspecified() || ip.IsMulticast() {
+			validationErr.Reasons = append(validationErr.Reasons, "host is not a unicast address")
+		}
+	} else {
+		if hostname == "localhost" {
+			validationErr.Reasons = append(validationErr.Reasons, "host is a loopback address")
+		}
+		for _, privateSuffix := range privateHostnameSuffixes {
+			if strings.HasSuffix(hostname, privateSuffix) {
+				validationErr.Reasons = append(validationErr.Reasons, fmt.Sprintf("host is a private domain (%s)", privateSuffix))
+				break
+			}
+		}
+
+		labels := strings.Split(hostname, ".")
+		if len(labels) < 2 {
+			validationErr.Reasons = append(validationErr.Reasons, "host is not a fully qualified domain name")
+		}
+		for _, label := range labels {
+			if len(label) > 63 || !hostnameLabelRegex.MatchString(label) {
+				validationErr.Reasons = append(validationErr.Reasons, fmt.Sprintf("host contains an invalid label %q", label))
+				break
+			}
+		}
+		if numericRegex.MatchString(labels[len(labels)-1]) {
+			validationErr.Reasons = append(validationErr.Reasons, "host has a numeric top level domain")
+		}
+	}
+
+	if len(validationErr.Reasons) > 0 {
+		return validationErr
+	}
+	return nil
+}
@@ -1,9 +1,9 @@
 package utils
 
 import (
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
 	"github.com/Boostport/address"
-	"regexp"
 	"strings"
 )
 
@@ -18,8 +18,14 @@ func NormalizeURL(url string) string {
 	return normalized
 }
 
-// Prepends url with https:// and appends with metadata/ if needed
+// Canonicalizes the endpoint url (see CanonicalizeEndpointURL).
+// Urls that cannot be canonicalized are prepended with https:// and appended with / if needed
 func NormalizeEndpointURL(url string) string {
+	canonical, err := CanonicalizeEndpointURL(url)
+	if err == nil {
+		return canonical
+	}
+
 	normalized := NormalizeURL(url)
 
 	// for cases such as foobar.com/
@@ -29,42 +35,43 @@ func NormalizeEndpointURL(url string) string {
 	return normalized
 }
 
+// NormalizeEndpointId identifies an endpoint by its normalized url (see NormalizeEndpointURL). Only the scheme & host are
+// case-insensitive, endpoints whose paths differ by case are different endpoints.
 func NormalizeEndpointId(url string) string {
-	return strings.ToLower(NormalizeEndpointURL(url))
+	return NormalizeEndpointURL(url)
 }
 
+// NormalizeOrganizationName canonicalizes the organization name using the DefaultNameCanonicalizer
 func NormalizeOrganizationName(orgName string) (string, error) {
-	orgName = strings.ReplaceAll(orgName, "-", " ")
-	orgName = strings.ReplaceAll(orgName, "/", " ")
-	orgName = strings.ReplaceAll(orgName, ",", " ")
-	// Regex for only letters
-	reg, err := regexp.Compile(`[^a-zA-Z0-9\s]+`)
-	if err != nil {
-		return "", fmt.Errorf("error compiling regex for normalizing organization name: %v", err)
-	}
-	characterStrippedName := reg.ReplaceAllString(orgName, "")
-	return strings.ToUpper(characterStrippedName), nil
+	return DefaultNameCanonicalizer.Canonicalize(orgName)
 }
 
+// NormalizeLocationId identifies a location by its USPS standardized address (see StandardizeAddressLine), so that
+// different spellings of the same address (eg. "123 Main Street Suite 100" and "123 MAIN ST STE 100") have the same id.
 func NormalizeLocationId(addrLines []string, addrCity string, addrState string, addrZip string, addrCountry string) (string, error) {
-
-	if len(addrZip) > 5 {
-		addrZip = addrZip[:5]
+	var standardizedLines []string
+	for _, addrLine := range addrLines {
+		if standardizedLine := StandardizeAddressLine(addrLine); standardizedLine != "" {
+			standardizedLines = append(standardizedLines, standardizedLine)
+		}
 	}
+	addrCity = StandardizeCity(addrCity)
+	addrState = StandardizeState(addrState)
+	addrZip, _ = StandardizePostalCode(addrZip)
+	addrCountry = strings.ToUpper(strings.TrimSpace(addrCountry))
 
-	addr, _ := address.NewValid(
-		address.WithStreetAddress(addrLines),
+	addr, err := address.NewValid(
+		address.WithStreetAddress(standardizedLines),
 		address.WithLocality(addrCity),
 		address.WithAdministrativeArea(addrState),
 		address.WithPostCode(addrZip),
 		address.WithCountry(addrCountry),
 	)
-	//if err != nil {
-	//	log.Printf("addr: %s", addr)
-	//	addrStr := fmt.Sprintf("address: %v, %s, %s, %s, %s", addrLines, addrCity, addrState, addrZip, addrCountry)
-	//
-	//	return "", fmt.Errorf("error normalizing location(%s) id: %v", addrStr, err)
-	//}
+	if err != nil {
+		// addresses that cannot be formatted for their country (eg. missing a required field) are still identified by
+		// their standardized components, rather than by an empty/partial address
+		return strings.Join(append(standardizedLines, addrCity, addrState, addrZip, addrCountry), ","), nil
+	}
 
 	defStringFormatter := address.DefaultFormatter{
 		Output: address.StringOutputter{},
@@ -74,3 +81,13 @@ func NormalizeLocationId(addrLines []string, addrCity string, addrState string,
 
 	return locationId, nil
 }
+
+// LocationId returns a stable identifier for an address: the (truncated) SHA-256 hash of NormalizeLocationId.
+func LocationId(addrLines []string, addrCity string, addrState string, addrZip string, addrCountry string) (string, error) {
+	normalizedLocation, err := NormalizeLocationId(addrLines, addrCity, addrState, addrZip, addrCountry)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(normalizedLocation))
+	return hex.EncodeToString(hash[:])[:32], nil
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"fmt"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// NameCanonicalizationRules configures a NameCanonicalizer.
+// Version must be incremented whenever the rules change, so that stored names can be recomputed.
+type NameCanonicalizationRules struct {
+	Version int
+
+	// Transliterate converts accented & other latin letters to ASCII (eg. Clínica -> CLINICA), rather than removing them
+	Transliterate bool
+	// Synonyms replaces abbreviations (and other variations) of a word with a single form, eg. ST -> SAINT
+	Synonyms map[string]string
+	// StopWords are removed wherever they occur in the name
+	StopWords []string
+	// LegalSuffixes are removed from the end of the name, eg. INC, LLC
+	LegalSuffixes []string
+}
+
+var DefaultNameCanonicalizationRules = NameCanonicalizationRules{
+	Version:       2,
+	Transliterate: true,
+	Synonyms: map[string]string{
+		"ST":     "SAINT",
+		"STE":    "SAINTE",
+		"MT":     "MOUNT",
+		"FT":     "FORT",
+		"HOSP":   "HOSPITAL",
+		"HSP":    "HOSPITAL",
+		"MED":    "MEDICAL",
+		"CTR":    "CENTER",
+		"CNTR":   "CENTER",
+		"CENTRE": "CENTER",
+		"UNIV":   "UNIVERSITY",
+		"CLIN":   "CLINIC",
+		"REG":    "REGIONAL",
+		"REGL":   "REGIONAL",
+		"MEM":    "MEMORIAL",
+		"MEML":   "MEMORIAL",
+		"COMM":   "COMMUNITY",
+		"GEN":    "GENERAL",
+		"HLTH":   "HEALTH",
+		"HLTHCR": "HEALTHCARE",
+		"SYS":    "SYSTEM",
+		"SVC":    "SERVICE",
+		"SVCS":   "SERVICES",
+		"ASSOC":  "ASSOCIATES",
+		"ASSN":   "ASSOCIATION",
+		"DEPT":   "DEPARTMENT",
+		"NATL":   "NATIONAL",
+		"PHYS":   "PHYSICIANS",
+		"GRP":    "GROUP",
+		"PEDS":   "PEDIATRICS",
+	},
+	StopWords: []string{"THE", "AND", "OF"},
+	LegalSuffixes: []string{
+		"INC", "INCORPORATED",
+		"LLC", "PLLC", "LLP", "LP", "LTD", "LIMITED",
+		"CORP", "CORPORATION", "CO", "COMPANY",
+		"PC", "PA", "PSC", "SC",
+	},
+}
+
+// DefaultNameCanonicalizer is used by NormalizeOrganizationName
+var DefaultNameCanonicalizer = NewNameCanonicalizer(DefaultNameCanonicalizationRules)
+
+// letters that are not decomposed by unicode normalization
+var transliterations = strings.NewReplacer(
+	"ß", "SS", "ẞ", "SS",
+	"Æ", "AE", "æ", "AE",
+	"Œ", "OE", "œ", "OE",
+	"Ø", "O", "ø", "O",
+	"Ł", "L", "ł", "L",
+	"Đ", "D", "đ", "D",
+	"Þ", "TH", "þ", "TH",
+	"ı", "I",
+)
+
+var (
+	nameSeparatorRegex  = regexp.MustCompile(`[\-/,&+]+`)
+	nameCharactersRegex = regexp.MustCompile(`[^A-Z0-9\s]+`)
+)
+
+// NameCanonicalizer converts organization names into the canonical form stored as OrganizationIdentifierTypeName values:
+// transliterate -> upper case -> remove punctuation -> synonyms -> stop words -> legal suffixes
+type NameCanonicalizer struct {
+	Rules NameCanonicalizationRules
+
+	stopWords     map[string]bool
+	legalSuffixes map[string]bool
+}
+
+func NewNameCanonicalizer(rules NameCanonicalizationRules) *NameCanonicalizer {
+	canonicalizer := NameCanonicalizer{
+		Rules:         rules,
+		stopWords:     map[string]bool{},
+		legalSuffixes: map[string]bool{},
+	}
+	for _, stopWord := range rules.StopWords {
+		canonicalizer.stopWords[strings.ToUpper(stopWord)] = true
+	}
+	for _, legalSuffix := range rules.LegalSuffixes {
+		canonicalizer.legalSuffixes[strings.ToUpper(legalSuffix)] = true
+	}
+	return &canonicalizer
+}
+
+func (nc *NameCanonicalizer) Version() int {
+	return nc.Rules.Version
+}
+
+// Canonicalize returns the canonical form of the organization name.
+// Words are only removed if the name has other words, eg. "THE COMPANY" is not canonicalized to an empty string.
+func (nc *NameCanonicalizer) Canonicalize(orgName string) (string, error) {
+	if nc.Rules.Transliterate {
+		transliterated, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), transliterations.Replace(orgName))
+		if err != nil {
+			return "", fmt.Errorf("error transliterating organization name (%s): %v", orgName, err)
+		}
+		orgName = transliterated
+	}
+	orgName = strings.ToUpper(orgName)
+	orgName = nameSeparatorRegex.ReplaceAllString(orgName, " ")
+	orgName = nameCharactersRegex.ReplaceAllString(orgName, "")
+
+	words := strings.Fields(orgName)
+	for ndx, word := range words {
+		if synonym, ok := nc.Rules.Synonyms[word]; ok {
+			words[ndx] = synonym
+		}
+	}
+
+	var significantWords []string
+	for _, word := range words {
+		if !nc.stopWords[word] {
+			significantWords = append(significantWords, word)
+		}
+	}
+	for len(significantWords) > 1 && nc.legalSuffixes[significantWords[len(significantWords)-1]] {
+		significantWords = significantWords[:len(significantWords)-1]
+	}
+	if len(significantWords) == 0 {
+		significantWords = words
+	}
+	return strings.Join(significantWords, " "), nil
+}
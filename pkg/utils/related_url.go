@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"net/url"
+	"strings"
+)
+
+// CanonicalizeRelatedURL converts a website or portal url into a canonical form, so the same page is only stored once:
+//
+// - the scheme defaults to https, and is lowercased
+// - the host is lowercased and converted to ASCII (IDNA), default ports are removed
+// - fragments, tracking parameters (utm_*) and a trailing `/` are removed
+//
+// Unlike endpoint urls, query strings are kept, since portal urls often select a practice with a query parameter.
+func CanonicalizeRelatedURL(rawUrl string) (string, error) {
+	trimmedUrl := strings.TrimSpace(rawUrl)
+	if trimmedUrl == "" {
+		return "", fmt.Errorf("url is empty")
+	}
+	if !schemePrefixRegex.MatchString(trimmedUrl) {
+		trimmedUrl = "https://" + trimmedUrl
+	}
+
+	parsedUrl, err := url.Parse(trimmedUrl)
+	if err != nil {
+		return "", fmt.Errorf("url could not be parsed: %v", err)
+	}
+	parsedUrl.Scheme = strings.ToLower(parsedUrl.Scheme)
+	if parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q", parsedUrl.Scheme)
+	}
+
+	hostname := strings.TrimSuffix(strings.ToLower(parsedUrl.Hostname()), ".")
+	if hostname == "" || !strings.Contains(hostname, ".") {
+		return "", fmt.Errorf("url is missing a host")
+	}
+	hostname, err = idna.Lookup.ToASCII(hostname)
+	if err != nil {
+		return "", fmt.Errorf("url host is not a valid domain name: %v", err)
+	}
+	if port := parsedUrl.Port(); port == "" || defaultPorts[parsedUrl.Scheme] == port {
+		parsedUrl.Host = hostname
+	} else {
+		parsedUrl.Host = hostname + ":" + port
+	}
+
+	parsedUrl.Path = strings.TrimSuffix(duplicateSlashRegex.ReplaceAllString(parsedUrl.Path, "/"), "/")
+	parsedUrl.RawPath = ""
+	query := parsedUrl.Query()
+	for key := range query {
+		if strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	parsedUrl.RawQuery = query.Encode()
+	parsedUrl.ForceQuery = false
+	parsedUrl.Fragment = ""
+	parsedUrl.RawFragment = ""
+
+	return parsedUrl.String(), nil
+}
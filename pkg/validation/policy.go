@@ -0,0 +1,102 @@
+package validation
+
+import (
+	"fmt"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"sort"
+	"strings"
+)
+
+// Action is what happens to an imported record with validation findings. Actions are ordered from least to most severe.
+type Action string
+
+const (
+	ActionKeep       Action = "keep"       // the record is merged, findings are not stored
+	ActionFlag       Action = "flag"       // the record is merged, findings are stored on the organization
+	ActionQuarantine Action = "quarantine" // the record is not merged, it is saved to the quarantine table for review
+	ActionReject     Action = "reject"     // the record is discarded
+)
+
+var actionRanks = map[Action]int{
+	ActionKeep:       0,
+	ActionFlag:       1,
+	ActionQuarantine: 2,
+	ActionReject:     3,
+}
+
+// Policy decides the Action for a record, using the most severe action of its findings. Each finding uses the action
+// configured for its code, or failing that, for its severity.
+type Policy struct {
+	Severities map[models.ValidationSeverity]Action
+	Codes      map[models.ValidationCode]Action
+}
+
+// DefaultPolicy quarantines records with errors (eg. an invalid NPI check digit), and flags records with warnings.
+func DefaultPolicy() Policy {
+	return Policy{
+		Severities: map[models.ValidationSeverity]Action{
+			models.ValidationSeverityError:   ActionQuarantine,
+			models.ValidationSeverityWarning: ActionFlag,
+		},
+		Codes: map[models.ValidationCode]Action{},
+	}
+}
+
+// ParsePolicy overrides the actions of the default policy, using a comma separated list of severity or code
+// assignments, eg. "error=reject,invalid_state=keep"
+func ParsePolicy(spec string) (Policy, error) {
+	policy := DefaultPolicy()
+	for _, assignment := range strings.Split(spec, ",") {
+		assignment = strings.TrimSpace(assignment)
+		if assignment == "" {
+			continue
+		}
+		key, value, found := strings.Cut(assignment, "=")
+		key = strings.TrimSpace(key)
+		action := Action(strings.TrimSpace(value))
+		if _, ok := actionRanks[action]; !found || !ok || key == "" {
+			return policy, fmt.Errorf("invalid validation policy (%s), expected severity=action or code=action (actions: keep, flag, quarantine, reject)", assignment)
+		}
+		switch severity := models.ValidationSeverity(key); severity {
+		case models.ValidationSeverityError, models.ValidationSeverityWarning:
+			policy.Severities[severity] = action
+		default:
+			policy.Codes[models.ValidationCode(key)] = action
+		}
+	}
+	return policy, nil
+}
+
+// ActionFor returns the action for a single finding
+func (policy Policy) ActionFor(finding *models.ValidationFinding) Action {
+	if action, ok := policy.Codes[finding.Code]; ok {
+		return action
+	}
+	if action, ok := policy.Severities[finding.Severity]; ok {
+		return action
+	}
+	return ActionFlag
+}
+
+// Decide returns the most severe action of the findings, or ActionKeep if there are none
+func (policy Policy) Decide(findings []models.ValidationFinding) Action {
+	decision := ActionKeep
+	for ndx := range findings {
+		if action := policy.ActionFor(&findings[ndx]); actionRanks[action] > actionRanks[decision] {
+			decision = action
+		}
+	}
+	return decision
+}
+
+func (policy Policy) String() string {
+	var assignments []string
+	for severity, action := range policy.Severities {
+		assignments = append(assignments, fmt.Sprintf("%s=%s", severity, action))
+	}
+	for code, action := range policy.Codes {
+		assignments = append(assignments, fmt.Sprintf("%s=%s", code, action))
+	}
+	sort.Strings(assignments)
+	return strings.Join(assignments, ",")
+}
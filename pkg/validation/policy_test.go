@@ -0,0 +1,51 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+)
+
+var (
+	testErrorFinding   = models.ValidationFinding{Code: models.ValidationCodeInvalidNPI, Severity: models.ValidationSeverityError}
+	testWarningFinding = models.ValidationFinding{Code: models.ValidationCodeInvalidState, Severity: models.ValidationSeverityWarning}
+)
+
+func TestPolicy_Decide(t *testing.T) {
+	testCases := []struct {
+		name     string
+		spec     string
+		findings []models.ValidationFinding
+		expected Action
+	}{
+		{"no findings", "", nil, ActionKeep},
+		{"warning", "", []models.ValidationFinding{testWarningFinding}, ActionFlag},
+		{"error", "", []models.ValidationFinding{testErrorFinding}, ActionQuarantine},
+		{"most severe finding", "", []models.ValidationFinding{testWarningFinding, testErrorFinding}, ActionQuarantine},
+		{"severity override", "error=reject", []models.ValidationFinding{testErrorFinding}, ActionReject},
+		{"code override", "invalid_state=keep", []models.ValidationFinding{testWarningFinding}, ActionKeep},
+		{"code overrides severity", "warning=reject,invalid_state=flag", []models.ValidationFinding{testWarningFinding}, ActionFlag},
+		{"unconfigured severity", "", []models.ValidationFinding{{Code: "unknown", Severity: "info"}}, ActionFlag},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			policy, err := ParsePolicy(testCase.spec)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if action := policy.Decide(testCase.findings); action != testCase.expected {
+				t.Errorf("expected %s, got %s", testCase.expected, action)
+			}
+		})
+	}
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	for _, spec := range []string{"error", "error=delete", "=reject"} {
+		t.Run(spec, func(t *testing.T) {
+			if _, err := ParsePolicy(spec); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package validation
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/utils"
+	"regexp"
+	"strings"
+)
+
+var (
+	einRegex      = regexp.MustCompile(`^\d{2}-?\d{7}$`)
+	taxonomyRegex = regexp.MustCompile(`^\d{3}[0-9A-Z]{6}X$`)
+)
+
+// ValidateOrganization checks the identifiers, taxonomy codes & locations of an imported record. The findings are
+// returned (and not stored), so that the caller can apply a Policy.
+func ValidateOrganization(org *models.Organization) []models.ValidationFinding {
+	var findings []models.ValidationFinding
+	add := func(code models.ValidationCode, severity models.ValidationSeverity, field string, value string) {
+		finding := models.ValidationFinding{Code: code, Severity: severity, Field: field, Value: value}
+		for _, existing := range findings {
+			if existing.Equal(&finding) {
+				return
+			}
+		}
+		findings = append(findings, finding)
+	}
+
+	for _, identifier := range org.AllIdentifiers() {
+		switch identifier.IdentifierType {
+		case models.OrganizationIdentifierTypeNPI, models.OrganizationIdentifierTypePrimaryNPI:
+			if !ValidNPI(identifier.IdentifierValue) {
+				add(models.ValidationCodeInvalidNPI, models.ValidationSeverityError, string(identifier.IdentifierType), identifier.IdentifierValue)
+			}
+		case models.OrganizationIdentifierTypeEIN:
+			if !ValidEIN(identifier.IdentifierValue) {
+				add(models.ValidationCodeInvalidEIN, models.ValidationSeverityWarning, string(identifier.IdentifierType), identifier.IdentifierValue)
+			}
+		}
+	}
+
+	for _, taxonomy := range org.Taxonomy {
+		if !ValidTaxonomyCode(taxonomy) {
+			add(models.ValidationCodeInvalidTaxonomy, models.ValidationSeverityWarning, "taxonomy", taxonomy)
+		}
+	}
+
+	for _, loc := range org.Locations {
+		country := strings.ToUpper(strings.TrimSpace(loc.Country))
+		if country != "" && !ValidCountryCode(country) {
+			add(models.ValidationCodeInvalidCountry, models.ValidationSeverityWarning, "country", loc.Country)
+			continue
+		}
+		// states are only validated for US addresses
+		if (country == "" || country == "US") && !ValidStateCode(loc.State) {
+			add(models.ValidationCodeInvalidState, models.ValidationSeverityWarning, "state", loc.State)
+		}
+	}
+	return findings
+}
+
+// ValidNPI returns true if the NPI is 10 digits, with a valid Luhn check digit. The check digit is calculated over the
+// NPI prefixed with 80840 (the ISO card issuer prefix for US health applications).
+func ValidNPI(npi string) bool {
+	if len(npi) != 10 || strings.Trim(npi, "0123456789") != "" {
+		return false
+	}
+	sum := 0
+	digits := "80840" + npi
+	for ndx := len(digits) - 1; ndx >= 0; ndx-- {
+		digit := int(digits[ndx] - '0')
+		// double every second digit, starting from the right of the check digit
+		if (len(digits)-1-ndx)%2 == 1 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return sum%10 == 0
+}
+
+// ValidEIN returns true if the EIN is 9 digits, optionally formatted as 12-3456789. EINs of all zeros are invalid.
+func ValidEIN(ein string) bool {
+	ein = strings.TrimSpace(ein)
+	return einRegex.MatchString(ein) && strings.Trim(ein, "0-") != ""
+}
+
+// ValidStateCode returns true if the state is a USPS two-letter state, DC, territory or military state code.
+// Full state names (eg. California) are accepted, since locations are standardized before they are saved.
+func ValidStateCode(state string) bool {
+	_, ok := utils.USStateNames[utils.StandardizeState(state)]
+	return ok
+}
+
+// ValidCountryCode returns true if the country is an officially assigned ISO 3166-1 two-letter country code, eg. US
+// (but not UK, see iso3166Alpha2)
+func ValidCountryCode(country string) bool {
+	return iso3166Alpha2[strings.ToUpper(strings.TrimSpace(country))]
+}
+
+// ValidTaxonomyCode returns true if the taxonomy is a NUCC Health Care Provider Taxonomy code, eg. 207Q00000X.
+// NPPES taxonomy group columns include a description after the code (eg. "193200000X MULTI-SPECIALTY GROUP"), only the
+// code is checked.
+func ValidTaxonomyCode(taxonomy string) bool {
+	fields := strings.Fields(strings.ToUpper(taxonomy))
+	return len(fields) > 0 && taxonomyRegex.MatchString(fields[0])
+}
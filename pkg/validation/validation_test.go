@@ -0,0 +1,157 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+)
+
+func TestValidNPI(t *testing.T) {
+	testCases := []struct {
+		npi   string
+		valid bool
+	}{
+		{"1234567893", true},
+		{"1245319599", true},
+		{"1234567890", false},
+		{"123456789", false},
+		{"12345678930", false},
+		{"12345678A3", false},
+		{" 1234567893", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.npi, func(t *testing.T) {
+			if valid := ValidNPI(testCase.npi); valid != testCase.valid {
+				t.Errorf("expected %v, got %v", testCase.valid, valid)
+			}
+		})
+	}
+}
+
+func TestValidEIN(t *testing.T) {
+	testCases := []struct {
+		ein   string
+		valid bool
+	}{
+		{"12-3456789", true},
+		{"123456789", true},
+		{" 12-3456789 ", true},
+		{"00-0000000", false},
+		{"000000000", false},
+		{"123-456789", false},
+		{"12345678", false},
+		{"12-345678A", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.ein, func(t *testing.T) {
+			if valid := ValidEIN(testCase.ein); valid != testCase.valid {
+				t.Errorf("expected %v, got %v", testCase.valid, valid)
+			}
+		})
+	}
+}
+
+func TestValidTaxonomyCode(t *testing.T) {
+	testCases := []struct {
+		taxonomy string
+		valid    bool
+	}{
+		{"207Q00000X", true},
+		{"282N00000X", true},
+		{"207q00000x", true},
+		{"193200000X MULTI-SPECIALTY GROUP", true},
+		{"207Q00000", false},
+		{"207Q00000Y", false},
+		{"A07Q00000X", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.taxonomy, func(t *testing.T) {
+			if valid := ValidTaxonomyCode(testCase.taxonomy); valid != testCase.valid {
+				t.Errorf("expected %v, got %v", testCase.valid, valid)
+			}
+		})
+	}
+}
+
+func TestValidCountryCode(t *testing.T) {
+	testCases := []struct {
+		country string
+		valid   bool
+	}{
+		{"US", true},
+		{"us", true},
+		{" CA ", true},
+		{"GB", true},
+		{"PR", true},
+		{"UK", false},
+		{"EU", false},
+		{"XK", false},
+		{"ZZ", false},
+		{"USA", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.country, func(t *testing.T) {
+			if valid := ValidCountryCode(testCase.country); valid != testCase.valid {
+				t.Errorf("expected %v, got %v", testCase.valid, valid)
+			}
+		})
+	}
+}
+
+func TestValidStateCode(t *testing.T) {
+	testCases := []struct {
+		state string
+		valid bool
+	}{
+		{"CA", true},
+		{"california", true},
+		{"DC", true},
+		{"AE", true},
+		{"XX", false},
+		{"", false},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.state, func(t *testing.T) {
+			if valid := ValidStateCode(testCase.state); valid != testCase.valid {
+				t.Errorf("expected %v, got %v", testCase.valid, valid)
+			}
+		})
+	}
+}
+
+func TestValidateOrganization(t *testing.T) {
+	org := &models.Organization{
+		Taxonomy: []string{"207Q00000X", "INVALID"},
+		OrganizationIdentifiers: []models.OrganizationIdentifier{
+			{IdentifierType: models.OrganizationIdentifierTypeNPI, IdentifierValue: "1234567890"},
+			{IdentifierType: models.OrganizationIdentifierTypeEIN, IdentifierValue: "12-3456789"},
+		},
+		Locations: []models.Location{
+			{State: "CA", Country: "US"},
+			{State: "XX", Country: "US"},
+			{State: "ON", Country: "CA"},
+			{State: "", Country: "UK"},
+		},
+	}
+
+	findings := ValidateOrganization(org)
+
+	expected := []models.ValidationFinding{
+		{Code: models.ValidationCodeInvalidNPI, Severity: models.ValidationSeverityError, Field: string(models.OrganizationIdentifierTypeNPI), Value: "1234567890"},
+		{Code: models.ValidationCodeInvalidTaxonomy, Severity: models.ValidationSeverityWarning, Field: "taxonomy", Value: "INVALID"},
+		{Code: models.ValidationCodeInvalidState, Severity: models.ValidationSeverityWarning, Field: "state", Value: "XX"},
+		{Code: models.ValidationCodeInvalidCountry, Severity: models.ValidationSeverityWarning, Field: "country", Value: "UK"},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got %v", len(expected), findings)
+	}
+	for ndx := range expected {
+		if !findings[ndx].Equal(&expected[ndx]) {
+			t.Errorf("expected finding %v, got %v", expected[ndx], findings[ndx])
+		}
+	}
+}
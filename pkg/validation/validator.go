@@ -0,0 +1,52 @@
+package validation
+
+import (
+	"github.com/fastenhealth/fasten-sources-etl/pkg/database"
+	"github.com/fastenhealth/fasten-sources-etl/pkg/models"
+)
+
+// ValidationSummary counts the actions taken by a Validator
+type ValidationSummary struct {
+	Kept        int
+	Flagged     int
+	Quarantined int
+	Rejected    int
+}
+
+// Validator applies a Policy to imported records before they are merged. Quarantined records are saved to the
+// repository (see models.QuarantinedOrganization).
+type Validator struct {
+	Policy     Policy
+	Repository *database.SqliteRepository
+	Summary    ValidationSummary
+}
+
+func NewValidator(repository *database.SqliteRepository, policy Policy) *Validator {
+	return &Validator{Policy: policy, Repository: repository}
+}
+
+// Admit returns true if the organization should be merged. The organization's ValidationFindings must already be
+// populated (see ValidateOrganization), findings the policy keeps are removed.
+func (v *Validator) Admit(org *models.Organization, source string) (bool, error) {
+	switch v.Policy.Decide(org.ValidationFindings) {
+	case ActionReject:
+		v.Summary.Rejected++
+		return false, nil
+	case ActionQuarantine:
+		v.Summary.Quarantined++
+		return false, v.Repository.QuarantineOrganization(org, source)
+	case ActionFlag:
+		v.Summary.Flagged++
+	default:
+		v.Summary.Kept++
+	}
+
+	var flagged []models.ValidationFinding
+	for ndx := range org.ValidationFindings {
+		if v.Policy.ActionFor(&org.ValidationFindings[ndx]) != ActionKeep {
+			flagged = append(flagged, org.ValidationFindings[ndx])
+		}
+	}
+	org.ValidationFindings = flagged
+	return true, nil
+}